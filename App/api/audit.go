@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Події журналу аудиту
+const (
+	auditSubmit   = "submit"
+	auditDownload = "download"
+	auditDelete   = "delete"
+	auditRequeue  = "requeue"
+	// auditRateLimited підсумовує події автора, пропущені через AUDIT_RATE_LIMIT
+	auditRateLimited = "rate_limited"
+)
+
+// auditEvent - один запис журналу аудиту (рядок JSON)
+type auditEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	JobID  string    `json:"job_id,omitempty"`
+	Action string    `json:"action,omitempty"`
+	auditSource
+	// Details - додаткові поля події (наприклад, кількість видалених завдань)
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// auditSource - хто виконав запит
+type auditSource struct {
+	Owner string `json:"owner,omitempty"`
+	// Credential - HMAC-SHA256 заголовка Authorization з ключем AUDIT_SECRET (перші 16 символів):
+	// дозволяє розрізнити ключі, не зберігаючи їх у журналі. Без секрету короткі ключі можна було б
+	// підібрати перебором за їх хешем.
+	Credential   string `json:"credential,omitempty"`
+	ClientIP     string `json:"client_ip"`
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+}
+
+// auditSourceKey - ключ auditSource у контексті запиту
+type auditSourceKey struct{}
+
+// withAuditSource зберігає дані про автора запиту в контексті, щоб події аудиту можна було
+// записати і там, де є лише ctx (наприклад, enqueueJob)
+func withAuditSource(r *http.Request) *http.Request {
+	source := auditSource{Owner: requestOwner(r), ClientIP: r.RemoteAddr, ForwardedFor: r.Header.Get("X-Forwarded-For")}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		source.ClientIP = host
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		mac := hmac.New(sha256.New, auditSecret)
+		mac.Write([]byte(auth))
+		source.Credential = hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	return r.WithContext(context.WithValue(r.Context(), auditSourceKey{}, source))
+}
+
+// auditSecret - ключ HMAC для Credential (AUDIT_SECRET). Без нього ключ випадковий на кожен запуск:
+// ключі все ще розрізняються, але записи різних запусків не зіставити.
+var auditSecret = randomAuditSecret()
+
+func randomAuditSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// auditRateLimit - найбільша кількість подій аудиту від одного автора (ключа або IP) за секунду
+// (AUDIT_RATE_LIMIT, 0 - без обмеження), щоб потік запитів не залив журнал. Пропущені події
+// не губляться безслідно: їх кількість пишеться подією rate_limited на початку наступної секунди.
+var auditRateLimit = 50
+
+// auditLogger - журнал аудиту, окремий від журналу застосунку: записи пишуться завжди,
+// незалежно від LOG_LEVEL, і лише дописуються в кінець
+type auditLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// window - поточна секунда, counts - події кожного автора в ній
+	window time.Time
+	counts map[string]*auditCount
+}
+
+// auditCount - записані й пропущені події автора за секунду
+type auditCount struct {
+	source              auditSource
+	written, suppressed int
+}
+
+// auditLog - журнал аудиту (AUDIT_LOG: stdout, stderr або шлях до файлу; за замовчуванням stdout)
+var auditLog = &auditLogger{enc: json.NewEncoder(os.Stdout)}
+
+// openAuditLog відкриває призначення журналу аудиту. Файл відкривається лише для дописування.
+func openAuditLog(dest string) (*auditLogger, error) {
+	var w io.Writer
+	switch dest {
+	case "", "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		file, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log '%s': %w", dest, err)
+		}
+		w = file
+	}
+	return &auditLogger{enc: json.NewEncoder(w)}, nil
+}
+
+// record записує подію з автором запиту з ctx. Помилка запису лише логується: аудит не повинен
+// зривати сам запит.
+func (l *auditLogger) record(ctx context.Context, event auditEvent) {
+	event.Time = time.Now().UTC()
+	event.auditSource, _ = ctx.Value(auditSourceKey{}).(auditSource)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.allow(event.auditSource, event.Time) {
+		l.write(event)
+	}
+}
+
+// allow рахує подію автора в поточній секунді і повідомляє, чи вона вкладається в AUDIT_RATE_LIMIT.
+// На початку нової секунди пише підсумки пропущених подій попередньої.
+func (l *auditLogger) allow(source auditSource, now time.Time) bool {
+	if auditRateLimit <= 0 {
+		return true
+	}
+	if window := now.Truncate(time.Second); !window.Equal(l.window) {
+		for _, c := range l.counts {
+			if c.suppressed > 0 {
+				l.write(auditEvent{Time: now, Event: auditRateLimited, auditSource: c.source,
+					Details: map[string]any{"suppressed": c.suppressed, "window": l.window}})
+			}
+		}
+		l.window, l.counts = window, make(map[string]*auditCount)
+	}
+
+	key := source.Credential
+	if key == "" {
+		key = source.ClientIP
+	}
+	c, ok := l.counts[key]
+	if !ok {
+		c = &auditCount{source: source}
+		l.counts[key] = c
+	}
+	if c.written >= auditRateLimit {
+		c.suppressed++
+		return false
+	}
+	c.written++
+	return true
+}
+
+func (l *auditLogger) write(event auditEvent) {
+	if err := l.enc.Encode(event); err != nil {
+		log.Printf("ERROR: Failed to write audit event %s for job %s: %v", event.Event, event.JobID, err)
+	}
+}
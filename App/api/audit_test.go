@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuditCredentialIsKeyed(t *testing.T) {
+	oldSecret := auditSecret
+	t.Cleanup(func() { auditSecret = oldSecret })
+
+	credential := func(secret, auth string) string {
+		auditSecret = []byte(secret)
+		req := httptest.NewRequest("GET", "/job/status", nil)
+		req.Header.Set("Authorization", auth)
+		source, _ := withAuditSource(req).Context().Value(auditSourceKey{}).(auditSource)
+		return source.Credential
+	}
+
+	a := credential("secret-1", "Bearer key-a")
+	if len(a) != 16 {
+		t.Fatalf("credential %q, want 16 hex characters", a)
+	}
+	if again := credential("secret-1", "Bearer key-a"); again != a {
+		t.Fatalf("same key and secret gave %q and %q", a, again)
+	}
+	if b := credential("secret-1", "Bearer key-b"); b == a {
+		t.Fatal("different keys gave the same credential")
+	}
+	if other := credential("secret-2", "Bearer key-a"); other == a {
+		t.Fatal("credential does not depend on AUDIT_SECRET")
+	}
+	sum := sha256.Sum256([]byte("Bearer key-a"))
+	if a == hex.EncodeToString(sum[:8]) {
+		t.Fatal("credential is a plain SHA-256 of the key")
+	}
+}
+
+func TestAuditRateLimit(t *testing.T) {
+	oldLimit := auditRateLimit
+	t.Cleanup(func() { auditRateLimit = oldLimit })
+	auditRateLimit = 2
+
+	var buf bytes.Buffer
+	l := &auditLogger{enc: json.NewEncoder(&buf)}
+	busy := auditSource{Credential: "aaaa", ClientIP: "10.0.0.1"}
+	quiet := auditSource{ClientIP: "10.0.0.2"}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var allowed []bool
+	for i := range 5 {
+		allowed = append(allowed, l.allow(busy, start.Add(time.Duration(i)*100*time.Millisecond)))
+	}
+	if want := []bool{true, true, false, false, false}; !slices.Equal(allowed, want) {
+		t.Fatalf("allowed = %v, want %v", allowed, want)
+	}
+	// Ліміт окремий для кожного автора
+	if !l.allow(quiet, start.Add(600*time.Millisecond)) {
+		t.Fatal("another client was limited by the busy one")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("summary written before the window ended: %s", buf.String())
+	}
+
+	// Наступна секунда: підсумок пропущених подій і новий ліміт
+	if !l.allow(busy, start.Add(time.Second)) {
+		t.Fatal("limit was not reset in the next second")
+	}
+	var summary auditEvent
+	if err := json.Unmarshal(buf.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Event != auditRateLimited || summary.Credential != "aaaa" || summary.Details["suppressed"] != float64(3) {
+		t.Fatalf("summary = %+v, want rate_limited with 3 suppressed events for credential aaaa", summary)
+	}
+
+	auditRateLimit = 0
+	for range 10 {
+		if !l.allow(busy, start.Add(time.Second)) {
+			t.Fatal("AUDIT_RATE_LIMIT=0 limited events")
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"image_common/storage"
+)
+
+func TestMain(m *testing.M) {
+	// Події аудиту не потрібні у виводі тестів
+	auditLog = &auditLogger{enc: json.NewEncoder(io.Discard)}
+	os.Exit(m.Run())
+}
+
+// useTempStorage спрямовує сховище і тимчасові файли завантажень у тимчасовий каталог тесту
+func useTempStorage(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldInput, oldOutput, oldTmp := storage.InputPath, storage.OutputPath, uploadTempDir
+	storage.InputPath, storage.OutputPath, uploadTempDir = dir, dir, dir
+	t.Cleanup(func() { storage.InputPath, storage.OutputPath, uploadTempDir = oldInput, oldOutput, oldTmp })
+}
+
+// fakeQueue - Queue у пам'яті: XAdd додає повідомлення до streams, err імітує недоступний Redis
+type fakeQueue struct {
+	mu      sync.Mutex
+	streams map[string][]string
+	err     error
+}
+
+func newFakeQueue() *fakeQueue {
+	return &fakeQueue{streams: map[string][]string{}}
+}
+
+func (q *fakeQueue) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return redis.NewStringResult("", q.err)
+	}
+	values, _ := a.Values.(map[string]interface{})
+	task, _ := values["task"].(string)
+	q.streams[a.Stream] = append(q.streams[a.Stream], task)
+	return redis.NewStringResult(fmt.Sprintf("%d-0", len(q.streams[a.Stream])), nil)
+}
+
+func (q *fakeQueue) XLen(ctx context.Context, stream string) *redis.IntCmd {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return redis.NewIntResult(int64(len(q.streams[stream])), q.err)
+}
+
+// fakeDB - DB у пам'яті з таблицями jobs і job_outputs. Розуміє лише запити, які виконують
+// обробники: рядки обираються за WHERE, а колонки - за переліком між SELECT і FROM.
+type fakeDB struct {
+	mu      sync.Mutex
+	jobs    map[string]map[string]any
+	outputs map[string]map[string]string // job_id -> name -> output_path
+	err     error                        // якщо задано, кожен запит повертає цю помилку
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{jobs: map[string]map[string]any{}, outputs: map[string]map[string]string{}}
+}
+
+// addJob додає рядок jobs з колонками за замовчуванням
+func (db *fakeDB) addJob(id string, columns map[string]any) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	job := map[string]any{"id": id, "status": "QUEUED", "input_path": "", "action": "grayscale", "enqueued": true}
+	for k, v := range columns {
+		job[k] = v
+	}
+	db.jobs[id] = job
+}
+
+func (db *fakeDB) job(id string) map[string]any {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.jobs[id]
+}
+
+var selectColumns = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+(\w+)`)
+
+func (db *fakeDB) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.err != nil {
+		return pgconn.CommandTag{}, db.err
+	}
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO jobs"):
+		id := fmt.Sprint(args[0])
+		db.jobs[id] = map[string]any{
+			"id": id, "status": args[1], "input_path": args[2], "action": args[3], "params": args[4],
+			"callback_url": args[5], "content_hash": args[6], "owner": args[7], "metadata": args[8], "enqueued": false,
+		}
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.HasPrefix(query, "UPDATE jobs SET enqueued = TRUE WHERE id = $1"):
+		if job, ok := db.jobs[fmt.Sprint(args[0])]; ok {
+			job["enqueued"] = true
+			return pgconn.NewCommandTag("UPDATE 1"), nil
+		}
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	case strings.HasPrefix(query, "DELETE FROM jobs WHERE id = $1"):
+		if _, ok := db.jobs[fmt.Sprint(args[0])]; ok {
+			delete(db.jobs, fmt.Sprint(args[0]))
+			return pgconn.NewCommandTag("DELETE 1"), nil
+		}
+		return pgconn.NewCommandTag("DELETE 0"), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("fakeDB: unsupported statement %q", query)
+}
+
+// selectRows повертає значення колонок рядків, що відповідають запиту
+func (db *fakeDB) selectRows(query string, args []any) ([][]any, error) {
+	match, whereAt := selectColumns.FindStringSubmatch(query), strings.Index(query, "WHERE")
+	if match == nil || whereAt < 0 {
+		return nil, fmt.Errorf("fakeDB: unsupported query %q", query)
+	}
+	columns := strings.Split(match[1], ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	var rows []map[string]any
+	switch where := strings.Join(strings.Fields(query[whereAt:]), " "); {
+	case match[2] == "jobs" && strings.HasPrefix(where, "WHERE id = $1"):
+		if job, ok := db.jobs[fmt.Sprint(args[0])]; ok {
+			rows = append(rows, job)
+		}
+	case match[2] == "jobs" && strings.HasPrefix(where, "WHERE content_hash = $1"):
+		for _, job := range db.jobs {
+			if hash, _ := job["content_hash"].(sql.NullString); hash.String == args[0] && (job["status"] == "QUEUED" || job["status"] == "PROCESSING") {
+				rows = append(rows, job)
+				break
+			}
+		}
+	case match[2] == "jobs" && strings.HasPrefix(where, "WHERE owner = $1"):
+		// Інші умови й порядок не перевіряються: тести списку розрізняють лише власників
+		for _, job := range db.jobs {
+			owner := job["owner"]
+			if valuer, ok := owner.(driver.Valuer); ok {
+				owner, _ = valuer.Value()
+			}
+			if owner == args[0] {
+				rows = append(rows, job)
+			}
+		}
+	case match[2] == "job_outputs" && strings.HasPrefix(where, "WHERE job_id = $1 AND name = $2"):
+		if path, ok := db.outputs[fmt.Sprint(args[0])][fmt.Sprint(args[1])]; ok {
+			rows = append(rows, map[string]any{"output_path": path})
+		}
+	case match[2] == "job_outputs" && strings.HasPrefix(where, "WHERE job_id = $1"):
+		// Порядок імен не важливий для тестів з одним результатом
+		for name, path := range db.outputs[fmt.Sprint(args[0])] {
+			rows = append(rows, map[string]any{"name": name, "output_path": path})
+		}
+	default:
+		return nil, fmt.Errorf("fakeDB: unsupported query %q", query)
+	}
+
+	result := make([][]any, len(rows))
+	for i, row := range rows {
+		for _, column := range columns {
+			result[i] = append(result[i], row[column])
+		}
+	}
+	return result, nil
+}
+
+func (db *fakeDB) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.err != nil {
+		return nil, db.err
+	}
+	rows, err := db.selectRows(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows, pos: -1}, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.err != nil {
+		return fakeRow{err: db.err}
+	}
+	rows, err := db.selectRows(query, args)
+	if err != nil {
+		return fakeRow{err: err}
+	}
+	if len(rows) == 0 {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	return fakeRow{values: rows[0]}
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("fakeDB: transactions are not supported")
+}
+
+// fakeRow - результат QueryRow
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanValues(r.values, dest)
+}
+
+// scanValues копіює значення колонок у dest так, як це зробив би pgx для типів, що їх
+// використовують обробники
+func scanValues(values, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("fakeDB: %d columns scanned into %d destinations", len(values), len(dest))
+	}
+	for i, value := range values {
+		// sql.NullString, uuid.UUID тощо - як їх передано в Exec
+		if valuer, ok := value.(driver.Valuer); ok {
+			value, _ = valuer.Value()
+		}
+		switch d := dest[i].(type) {
+		case sql.Scanner:
+			if err := d.Scan(value); err != nil {
+				return err
+			}
+		case *string:
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("fakeDB: cannot scan %T into *string", value)
+			}
+			*d = s
+		case *time.Time:
+			*d, _ = value.(time.Time)
+		case *[]byte:
+			if s, ok := value.(string); ok {
+				*d = []byte(s)
+			} else {
+				*d, _ = value.([]byte)
+			}
+		default:
+			return fmt.Errorf("fakeDB: unsupported scan destination %T", dest[i])
+		}
+	}
+	return nil
+}
+
+// fakeRows - результат Query
+type fakeRows struct {
+	rows [][]any
+	pos  int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+func (r *fakeRows) Values() ([]any, error)                       { return r.rows[r.pos], nil }
+func (r *fakeRows) Scan(dest ...any) error                       { return scanValues(r.rows[r.pos], dest) }
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"image_common/manifest"
+	"image_common/processing"
+	"image_common/storage"
+)
+
+// inlineFallbackMaxBytes - найбільший вхідний файл, який API обробляє сам, якщо черга Redis
+// недоступна (QUEUE_FALLBACK_INLINE_MAX_BYTES). 0 - режим вимкнено: без черги відповідь 503.
+var inlineFallbackMaxBytes int64
+
+// inlineActionLimits - обмеження розміру входу дій з ACTION_LIMITS (як у Worker)
+var inlineActionLimits = processing.ActionLimits{}
+
+// checkInlinePixels перевіряє розміри зображення за заголовком, до декодування пікселів:
+// обробка ділить слоти з /sync/process, тож діє і SYNC_MAX_PIXELS, і ліміт дії з ACTION_LIMITS
+func checkInlinePixels(action string, config image.Config) error {
+	if int64(config.Width)*int64(config.Height) > maxSyncPixels {
+		return fmt.Errorf("image %dx%d exceeds the synchronous processing limit of %d pixels", config.Width, config.Height, maxSyncPixels)
+	}
+	return inlineActionLimits.CheckPixels(action, config)
+}
+
+// canProcessInline повідомляє, чи можна обробити завдання в API замість Worker: лише дії
+// "одне зображення -> одне зображення" з файлом до inlineFallbackMaxBytes і без callback_url
+// (сповіщення надсилає лише Worker)
+func canProcessInline(filePath, action, callbackURL string) bool {
+	if inlineFallbackMaxBytes <= 0 || callbackURL != "" {
+		return false
+	}
+	if processing.IsMultiOutput(action) || processing.IsCombine(action) || processing.IsFrames(action) {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular() && info.Size() <= inlineFallbackMaxBytes
+}
+
+// processInline обробляє вже записане в jobs завдання так само, як Worker: результат і маніфест
+// зберігаються у сховищі результатів, завдання позначається COMPLETED, а вхідний файл видаляється.
+// Повертає помилку обробки, якщо результат не отримано (статус завдання тоді не змінюється).
+func (a *API) processInline(ctx context.Context, jobID, filePath, action, params string) error {
+	startTime := time.Now()
+	actionParams, outOpts, err := processing.SplitOutputOptions(params)
+	if err != nil {
+		return err
+	}
+	if info, ok := processing.Lookup(action); ok && info.OutputFormat != "" {
+		outOpts.Format = info.OutputFormat
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return processing.WrapDecodeError(err)
+	}
+	// Розміри полотна перевіряються до підрахунку кадрів GIF, який декодує їх усі
+	if err := checkInlinePixels(action, config); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// Анімований GIF обробляє Worker за своєю ANIMATED_INPUT_POLICY
+	if format == "gif" && outOpts.Page <= 1 {
+		frames, err := processing.GIFFrameCount(file)
+		if err != nil {
+			return err
+		}
+		if frames > 1 {
+			return fmt.Errorf("animated input (%d frames) is left to the worker", frames)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	src, err := processing.SelectPage(file, format, outOpts.Page)
+	if err != nil {
+		return err
+	}
+	// Вибрана сторінка TIFF має власні розміри - їх теж перевіряємо до декодування
+	config, format, err = image.DecodeConfig(src)
+	if err != nil {
+		return processing.WrapDecodeError(err)
+	}
+	if err := processing.CheckInput(action, format); err != nil {
+		return err
+	}
+	if err := checkInlinePixels(action, config); err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return processing.WrapDecodeError(err)
+	}
+	if outOpts.PreserveMetadata {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			outOpts.Metadata, _ = processing.ReadJPEGMetadata(file)
+		}
+	}
+	if outOpts.KeepICC {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			outOpts.ICCProfile, _ = processing.ExtractICCProfile(file)
+		}
+	}
+
+	inputs := manifest.DescribeFiles(filePath)
+	actionStart := time.Now()
+	processedImg, err := processing.Process(processing.NormalizeColorSpace(img, src), action, actionParams)
+	if err != nil {
+		return err
+	}
+	processingTime := time.Since(actionStart)
+	outOpts = outOpts.ForImage(processedImg)
+
+	outputPath := storage.OutputFilePath(jobID, action, "", outOpts.Extension())
+	output, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	encodeErr := processing.Encode(output, processedImg, outOpts)
+	closeErr := output.Close()
+	if encodeErr != nil || closeErr != nil {
+		os.Remove(outputPath)
+		return errors.Join(encodeErr, closeErr)
+	}
+
+	// Маніфест записується до позначення COMPLETED, щоб GET /job/manifest завершеного завдання не повертав 404
+	err = manifest.Write(manifest.Manifest{
+		JobID:         jobID,
+		Action:        action,
+		Params:        params,
+		Inputs:        inputs,
+		Outputs:       manifest.DescribeFiles(outputPath),
+		ProcessingMs:  processingTime.Milliseconds(),
+		TotalMs:       time.Since(startTime).Milliseconds(),
+		WorkerVersion: "api-" + version,
+		CompletedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("WARNING: Failed to write manifest for job %s: %v", jobID, err)
+	}
+
+	size := processedImg.Bounds().Size()
+	_, err = a.PGDB.Exec(ctx, `UPDATE jobs SET status = 'COMPLETED', output_path = $1, output_format = $2,
+		output_width = $3, output_height = $4 WHERE id = $5`, outputPath, outOpts.Format, size.X, size.Y, jobID)
+	if err != nil {
+		os.Remove(outputPath)
+		os.Remove(manifest.Path(jobID))
+		return err
+	}
+	if err := os.Remove(filePath); err != nil {
+		log.Printf("Warning: Failed to remove original input %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// completeInline намагається обробити завдання в API, коли його не вдалося поставити в чергу.
+// Повертає true, якщо завдання виконано і відповідь 200 з job_id вже записана у w.
+func (a *API) completeInline(ctx context.Context, w http.ResponseWriter, jobID, filePath, action, params, callbackURL string) bool {
+	if !canProcessInline(filePath, action, callbackURL) {
+		return false
+	}
+	// Обробка ділить слоти з /sync/process, щоб під час збою черги API не зайняв усі ядра
+	select {
+	case syncSlots <- struct{}{}:
+		defer func() { <-syncSlots }()
+	default:
+		return false
+	}
+	if err := a.processInline(ctx, jobID, filePath, action, params); err != nil {
+		log.Printf("Inline fallback for job %s failed: %v", jobID, err)
+		return false
+	}
+
+	inlineFallbackJobs.Inc()
+	log.Printf("Job %s processed inline: the queue is unavailable", jobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"job_id": "%s", "status": "COMPLETED"}`, jobID)
+	return true
+}
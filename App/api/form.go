@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+)
+
+// uploadForm - розібрана multipart-форма. На відміну від r.ParseMultipartForm, що пише великі файли
+// у os.TempDir(), файли, які не вмістилися у поріг пам'яті, записуються в uploadTempDir.
+type uploadForm struct {
+	files map[string][]*uploadFile
+}
+
+// uploadFile - один файл форми: у пам'яті (content) або в тимчасовому файлі (tmpPath)
+type uploadFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+	content  []byte
+	tmpPath  string
+}
+
+// memoryFile - файл форми в пам'яті з інтерфейсом multipart.File
+type memoryFile struct {
+	*io.SectionReader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// Open відкриває вміст файлу форми для читання
+func (f *uploadFile) Open() (multipart.File, error) {
+	if f.tmpPath != "" {
+		return os.Open(f.tmpPath)
+	}
+	return memoryFile{io.NewSectionReader(bytes.NewReader(f.content), 0, int64(len(f.content)))}, nil
+}
+
+// parseUploadForm читає multipart-тіло запиту. Файли сумарно до maxMemory байтів лишаються в пам'яті,
+// решта записується в uploadTempDir; текстові поля (до maxFormFieldBytes кожне) разом з query string
+// стають доступні через r.FormValue. Тимчасові файли видаляє RemoveAll.
+func parseUploadForm(r *http.Request, maxMemory int64) (*uploadForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &uploadForm{files: map[string][]*uploadFile{}}
+	values := url.Values{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes+1))
+			part.Close()
+			if err == nil && len(value) > maxFormFieldBytes {
+				err = fmt.Errorf("form field '%s' is too large", name)
+			}
+			if err != nil {
+				form.RemoveAll()
+				return nil, err
+			}
+			values.Add(name, string(value))
+			continue
+		}
+
+		file, err := readUploadFile(part, maxMemory)
+		part.Close()
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		if file.tmpPath == "" {
+			maxMemory -= file.Size
+		}
+		form.files[name] = append(form.files[name], file)
+	}
+
+	// Як і ParseMultipartForm: спершу поля форми, потім параметри query string
+	r.PostForm = values
+	r.Form = url.Values{}
+	for k, v := range values {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	return form, nil
+}
+
+// readUploadFile читає файл форми в пам'ять, а якщо він більший за maxMemory - у тимчасовий файл
+func readUploadFile(part *multipart.Part, maxMemory int64) (*uploadFile, error) {
+	file := &uploadFile{Filename: part.FileName(), Header: part.Header}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, part, max(maxMemory, 0)+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n <= maxMemory {
+		file.content, file.Size = buf.Bytes(), n
+		return file, nil
+	}
+
+	tmp, err := os.CreateTemp(uploadTempDir, "multipart-*")
+	if err != nil {
+		return nil, err
+	}
+	size, copyErr := io.CopyBuffer(tmp, io.MultiReader(&buf, part), make([]byte, uploadBufferSize))
+	closeErr := tmp.Close()
+	if copyErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return nil, errors.Join(copyErr, closeErr)
+	}
+	file.tmpPath, file.Size = tmp.Name(), size
+	return file, nil
+}
+
+// File повертає перший файл поля name (як r.FormFile); http.ErrMissingFile, якщо його немає
+func (f *uploadForm) File(name string) (multipart.File, *uploadFile, error) {
+	files := f.files[name]
+	if len(files) == 0 {
+		return nil, nil, http.ErrMissingFile
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, files[0], nil
+}
+
+// Files повертає всі файли поля name
+func (f *uploadForm) Files(name string) []*uploadFile {
+	return f.files[name]
+}
+
+// RemoveAll видаляє тимчасові файли форми
+func (f *uploadForm) RemoveAll() {
+	for _, files := range f.files {
+		for _, file := range files {
+			if file.tmpPath != "" {
+				os.Remove(file.tmpPath)
+			}
+		}
+	}
+}
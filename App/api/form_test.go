@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestParseUploadFormSpillsToUploadTempDir(t *testing.T) {
+	useTempStorage(t)
+	upload := testPNG(t)
+	body, contentType := multipartBody(t, map[string]string{"action": "grayscale"}, upload)
+	req := httptest.NewRequest("POST", "/sync/process?action=ignored&size=64", body)
+	req.Header.Set("Content-Type", contentType)
+
+	// Поріг менший за файл: файл має потрапити в uploadTempDir, а не в os.TempDir()
+	form, err := parseUploadForm(req, int64(len(upload)/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, header, err := form.File("image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || !bytes.Equal(data, upload) {
+		t.Fatalf("file content differs from the upload (err %v)", err)
+	}
+	if header.Filename != "photo.png" || header.Size != int64(len(upload)) {
+		t.Fatalf("header = %q (%d bytes), want photo.png (%d bytes)", header.Filename, header.Size, len(upload))
+	}
+
+	entries, _ := os.ReadDir(uploadTempDir)
+	if len(entries) != 1 {
+		t.Fatalf("%d files in uploadTempDir, want the spilled upload", len(entries))
+	}
+	// Поля форми мають перевагу над query string, як у ParseMultipartForm
+	if got := req.FormValue("action"); got != "grayscale" {
+		t.Fatalf("FormValue(action) = %q, want grayscale", got)
+	}
+	if got := req.FormValue("size"); got != "64" {
+		t.Fatalf("FormValue(size) = %q, want 64", got)
+	}
+
+	form.RemoveAll()
+	if entries, _ := os.ReadDir(uploadTempDir); len(entries) != 0 {
+		t.Fatalf("%d files left in uploadTempDir after RemoveAll", len(entries))
+	}
+}
+
+func TestParseUploadFormKeepsSmallFilesInMemory(t *testing.T) {
+	useTempStorage(t)
+	upload := testPNG(t)
+	body, contentType := multipartBody(t, nil, upload)
+	req := httptest.NewRequest("POST", "/sync/preview", body)
+	req.Header.Set("Content-Type", contentType)
+
+	form, err := parseUploadForm(req, int64(len(upload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+	if entries, _ := os.ReadDir(uploadTempDir); len(entries) != 0 {
+		t.Fatalf("%d files in uploadTempDir, want the upload kept in memory", len(entries))
+	}
+	if _, _, err := form.File("images"); err == nil {
+		t.Fatal("File(images) succeeded for a missing field")
+	}
+}
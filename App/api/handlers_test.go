@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"image_common/queue"
+)
+
+// testPNG - мале зображення PNG для завантажень
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// multipartBody збирає форму з полями fields і (якщо file не nil) файлом у полі image
+func multipartBody(t *testing.T, fields map[string]string, file []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	if file != nil {
+		part, err := mw.CreateFormFile("image", "photo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(file)
+	}
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestSubmitJobHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		fields      map[string]string
+		withFile    bool
+		oversized   bool // файл більший за maxUploadBytes
+		queueErr    error
+		queueLength int   // повідомлень у черзі до запиту
+		maxQueue    int64 // MAX_QUEUE_LENGTH
+		wantStatus  int
+		wantQueued  bool // завдання лишилося в jobs і потрапило в чергу
+	}{
+		{name: "queued", method: "POST", fields: map[string]string{"action": "grayscale"}, withFile: true, wantStatus: http.StatusAccepted, wantQueued: true},
+		{name: "method not allowed", method: "GET", wantStatus: http.StatusMethodNotAllowed},
+		{name: "missing image", method: "POST", fields: map[string]string{"action": "grayscale"}, wantStatus: http.StatusBadRequest},
+		{name: "unknown action", method: "POST", fields: map[string]string{"action": "sharpen-everything"}, withFile: true, wantStatus: http.StatusBadRequest},
+		{name: "invalid params", method: "POST", fields: map[string]string{"action": "resize", "params": "wide"}, withFile: true, wantStatus: http.StatusBadRequest},
+		{name: "body too large", method: "POST", fields: map[string]string{"action": "grayscale"}, oversized: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "queue unavailable", method: "POST", fields: map[string]string{"action": "grayscale"}, withFile: true, queueErr: errors.New("connection refused"), wantStatus: http.StatusServiceUnavailable},
+		{name: "queue at capacity", method: "POST", fields: map[string]string{"action": "grayscale"}, withFile: true, queueLength: 2, maxQueue: 2, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempStorage(t)
+			maxQueueLength = tt.maxQueue
+			t.Cleanup(func() { maxQueueLength = 0 })
+
+			q, db := newFakeQueue(), newFakeDB()
+			for range tt.queueLength {
+				q.streams[queue.Name] = append(q.streams[queue.Name], "{}")
+			}
+			q.err = tt.queueErr
+			api := &API{RDB: q, PGDB: db}
+
+			var file []byte
+			if tt.withFile {
+				file = testPNG(t)
+			}
+			if tt.oversized {
+				file = make([]byte, maxUploadBytes+1)
+			}
+			body, contentType := multipartBody(t, tt.fields, file)
+			req := httptest.NewRequest(tt.method, "/job/submit", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			api.submitJobHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			queued := len(q.streams[queue.Name]) > tt.queueLength
+			if queued != tt.wantQueued {
+				t.Fatalf("task queued = %v, want %v", queued, tt.wantQueued)
+			}
+			if !tt.wantQueued {
+				if len(db.jobs) != 0 {
+					t.Fatalf("rejected submission left %d job(s) in the database", len(db.jobs))
+				}
+				return
+			}
+
+			var response struct {
+				JobID string `json:"job_id"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			job := db.job(response.JobID)
+			if job == nil || job["status"] != "QUEUED" || job["enqueued"] != true {
+				t.Fatalf("job row = %v, want a QUEUED job marked enqueued", job)
+			}
+			task, err := queue.ParseTask(q.streams[queue.Name][0])
+			if err != nil || task.JobID != response.JobID || task.Action != "grayscale" {
+				t.Fatalf("queued task = %+v, %v; want job %s", task, err, response.JobID)
+			}
+			if stored, err := os.ReadFile(task.InputPath); err != nil || !bytes.Equal(stored, file) {
+				t.Fatalf("stored input differs from the upload (err %v)", err)
+			}
+		})
+	}
+}
+
+func TestGetJobStatusHandler(t *testing.T) {
+	const (
+		queuedID    = "6f1d1f5e-0000-4000-8000-000000000001"
+		failedID    = "6f1d1f5e-0000-4000-8000-000000000002"
+		completedID = "6f1d1f5e-0000-4000-8000-000000000003"
+		missingID   = "6f1d1f5e-0000-4000-8000-000000000004"
+	)
+	db := newFakeDB()
+	db.addJob(queuedID, nil)
+	db.addJob(failedID, map[string]any{"status": "FAILED", "error_message": "error decoding image"})
+	db.addJob(completedID, map[string]any{"status": "COMPLETED", "output_format": "png", "output_width": 4, "output_height": 4})
+	api := &API{RDB: newFakeQueue(), PGDB: db}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       jobStatusResponse
+	}{
+		{"missing id", "", http.StatusBadRequest, jobStatusResponse{}},
+		{"unknown job", "?id=" + missingID, http.StatusNotFound, jobStatusResponse{JobID: missingID, Status: "UNKNOWN"}},
+		{"queued", "?id=" + queuedID, http.StatusOK, jobStatusResponse{JobID: queuedID, Status: "QUEUED", Action: "grayscale"}},
+		{"failed", "?id=" + failedID, http.StatusOK, jobStatusResponse{JobID: failedID, Status: "FAILED", Action: "grayscale", ErrorMessage: "error decoding image"}},
+		{"completed", "?id=" + completedID, http.StatusOK, jobStatusResponse{
+			JobID: completedID, Status: "COMPLETED", Action: "grayscale", DownloadURL: "/job/download?id=" + completedID,
+			OutputFormat: "png", OutputWidth: 4, OutputHeight: 4,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.getJobStatusHandler(rec, httptest.NewRequest("GET", "/job/status"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.want.JobID == "" {
+				return
+			}
+			var got jobStatusResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.JobID != tt.want.JobID || got.Status != tt.want.Status || got.Action != tt.want.Action ||
+				got.DownloadURL != tt.want.DownloadURL || got.ErrorMessage != tt.want.ErrorMessage ||
+				got.OutputFormat != tt.want.OutputFormat || got.OutputWidth != tt.want.OutputWidth || got.OutputHeight != tt.want.OutputHeight {
+				t.Fatalf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadProcessedImageHandler(t *testing.T) {
+	const (
+		queuedID    = "6f1d1f5e-0000-4000-8000-000000000011"
+		failedID    = "6f1d1f5e-0000-4000-8000-000000000012"
+		completedID = "6f1d1f5e-0000-4000-8000-000000000013"
+		goneID      = "6f1d1f5e-0000-4000-8000-000000000014"
+		missingID   = "6f1d1f5e-0000-4000-8000-000000000015"
+	)
+	useTempStorage(t)
+	result := testPNG(t)
+	resultPath := filepath.Join(t.TempDir(), completedID+"_grayscale.png")
+	if err := os.WriteFile(resultPath, result, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := newFakeDB()
+	db.addJob(queuedID, nil)
+	db.addJob(failedID, map[string]any{"status": "FAILED", "error_message": "error decoding image"})
+	db.addJob(completedID, map[string]any{"status": "COMPLETED", "output_path": resultPath, "input_path": "photo.png"})
+	db.addJob(goneID, map[string]any{"status": "COMPLETED", "output_path": filepath.Join(t.TempDir(), "deleted.png")})
+	api := &API{RDB: newFakeQueue(), PGDB: db}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   []byte
+	}{
+		{"missing id", "", http.StatusBadRequest, nil},
+		{"unknown job", "?id=" + missingID, http.StatusNotFound, nil},
+		{"not completed", "?id=" + queuedID, http.StatusAccepted, nil},
+		{"failed", "?id=" + failedID, http.StatusUnprocessableEntity, nil},
+		{"result deleted", "?id=" + goneID, http.StatusNotFound, nil},
+		{"unknown output name", "?id=" + completedID + "&name=face_1", http.StatusNotFound, nil},
+		{"completed", "?id=" + completedID, http.StatusOK, result},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			api.downloadProcessedImageHandler(rec, httptest.NewRequest("GET", "/job/download"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != nil && !bytes.Equal(rec.Body.Bytes(), tt.wantBody) {
+				t.Fatalf("body differs from the stored result (%d bytes, want %d)", rec.Body.Len(), len(tt.wantBody))
+			}
+			if tt.wantStatus == http.StatusOK && !strings.HasPrefix(rec.Header().Get("Content-Type"), "image/png") {
+				t.Fatalf("Content-Type = %q, want image/png", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestListJobsHandler(t *testing.T) {
+	const (
+		aliceID = "6f1d1f5e-0000-4000-8000-000000000021"
+		bobID   = "6f1d1f5e-0000-4000-8000-000000000022"
+		noneID  = "6f1d1f5e-0000-4000-8000-000000000023"
+	)
+	oldToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = oldToken })
+
+	db := newFakeDB()
+	db.addJob(aliceID, map[string]any{"owner": "alice"})
+	db.addJob(bobID, map[string]any{"owner": "bob"})
+	db.addJob(noneID, nil)
+	api := &API{RDB: newFakeQueue(), PGDB: db}
+
+	tests := []struct {
+		name       string
+		query      string
+		headers    map[string]string
+		wantStatus int
+		wantJobs   []string
+	}{
+		{"anonymous", "", nil, http.StatusUnauthorized, nil},
+		{"owner", "", map[string]string{ownerHeader: "alice"}, http.StatusOK, []string{aliceID}},
+		{"owner param ignored without admin", "?owner=bob", map[string]string{ownerHeader: "alice"}, http.StatusOK, []string{aliceID}},
+		{"invalid admin token", "?owner=bob", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized, nil},
+		{"admin without owner", "", map[string]string{"Authorization": "Bearer secret"}, http.StatusBadRequest, nil},
+		{"admin", "?owner=bob", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK, []string{bobID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/jobs"+tt.query, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			api.listJobsHandler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got map[string][]jobListItem
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, job := range got["jobs"] {
+				ids = append(ids, job.JobID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantJobs, ",") {
+				t.Fatalf("jobs = %v, want %v", ids, tt.wantJobs)
+			}
+		})
+	}
+}
@@ -1,26 +1,37 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
-	"image/jpeg"
 	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 
 	_ "image/gif"
 	_ "image/png"
@@ -28,50 +39,205 @@ import (
 	_ "golang.org/x/image/bmp"
 	_ "golang.org/x/image/tiff"
 
+	// HEIC/HEIF (формат фото за замовчуванням на iPhone); декодер на WASM, без cgo
+	_ "github.com/gen2brain/heic"
+
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
-	"github.com/nfnt/resize"
+
+	"image_common/manifest"
+	"image_common/metrics"
+	"image_common/migrations"
+	"image_common/processing"
+	"image_common/queue"
+	"image_common/storage"
 )
 
 // API struct to hold shared resources: Redis for Queue, PG for Persistence
 type API struct {
-	RDB  *redis.Client
-	PGDB *pgx.Conn
+	RDB  Queue
+	PGDB DB
+}
+
+// Queue - операції черги Redis, які використовують обробники (реалізується *redis.Client).
+// Інтерфейс дозволяє підставити фейкову реалізацію замість реального Redis.
+type Queue interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XLen(ctx context.Context, stream string) *redis.IntCmd
+}
+
+// DB - операції PostgreSQL, які використовують обробники (реалізується *pgx.Conn).
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 var (
-	// Глобальний контекст
-	ctx  = context.Background()
 	rdb  *redis.Client
 	pgDB *pgx.Conn
 
 	httpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests processed, labeled by handler and status code.",
+			Namespace: metrics.Namespace,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests processed, labeled by handler and status code.",
 		},
 		[]string{"handler", "method", "code"},
 	)
+	httpRequestsByClass = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "http_requests_by_class_total",
+			Help:      "Total number of HTTP requests processed, labeled by handler and status class (2xx, 3xx, 4xx, 5xx).",
+		},
+		[]string{"handler", "class"},
+	)
+	responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Histogram of HTTP response body sizes in bytes, labeled by handler.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 10), // 256 B - 64 MB
+		},
+		[]string{"handler"},
+	)
+	storageErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "storage_errors_total",
+			Help:      "Total number of failed writes to storage because the disk is full or read-only.",
+		},
+		[]string{"reason"}, // reason: disk_full, read_only
+	)
+	jobsSubmitted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "api_jobs_submitted_total",
+			Help:      "Total number of job submissions by action and outcome.",
+		},
+		[]string{"action", "outcome"}, // outcome: metrics.OutcomeQueued, metrics.OutcomeRejected
+	)
+	uploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "api_upload_bytes_total",
+		Help:      "Total number of image bytes received by job submission endpoints.",
+	})
+	downloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "api_download_bytes_total",
+		Help:      "Total number of result file bytes sent to clients.",
+	})
+	queueRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "job_queue_rejections_total",
+		Help:      "Total number of job submissions rejected because the queue reached MAX_QUEUE_LENGTH.",
+	})
+	inlineFallbackJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "api_jobs_inline_fallback_total",
+		Help:      "Total number of jobs processed inline by the API because the Redis queue was unavailable.",
+	})
+	downloadFileMissing = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "download_file_missing_total",
+		Help:      "Total number of result requests for COMPLETED jobs whose output file is missing on disk.",
+	})
 	requestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Histogram of the latency for HTTP requests.",
-			Buckets: []float64{0.1, 0.5, 1, 2.5, 5, 10},
+			Namespace: metrics.Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Histogram of the latency for HTTP requests.",
+			Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10},
 		},
 		[]string{"handler"},
 	)
 )
 
-const storagePath = "./storage"
 const metricsPort = "8081"
 
+// maxUploadBytes - максимальний розмір завантажуваного зображення (усього тіла запиту,
+// обмежується через http.MaxBytesReader)
+const maxUploadBytes = 25 * 1024 * 1024
+
+// multipartMemoryBytes - скільки даних multipart-форми parseUploadForm тримає в пам'яті
+// (MULTIPART_MAX_MEMORY_BYTES). Це окремий від maxUploadBytes поріг: більші файли не відхиляються,
+// а записуються у тимчасовий файл (UPLOAD_TMP_DIR), тож у контейнерах з малою пам'яттю варто
+// ставити його значно меншим за ліміт завантаження. За замовчуванням - увесь ліміт, як раніше.
+var multipartMemoryBytes int64 = maxUploadBytes
+
+// queueRetryAfterSeconds - значення заголовка Retry-After, коли черга переповнена
+const queueRetryAfterSeconds = 30
+
+// maxInlineResultBytes обмежує розмір результату, що повертається у JSON через /job/result (RESULT_INLINE_MAX_BYTES)
+var maxInlineResultBytes int64 = 1024 * 1024
+
+// maxSyncUploadBytes обмежує розмір зображення для /sync/process (SYNC_MAX_UPLOAD_BYTES)
+var maxSyncUploadBytes int64 = maxUploadBytes
+
+// maxSyncPixels обмежує кількість пікселів декодованого зображення для /sync/process (SYNC_MAX_PIXELS),
+// захищаючи від "декомпресійних бомб" - маленьких файлів з величезними розмірами
+var maxSyncPixels int64 = 40_000_000
+
+// defaultSyncAction - дія /sync/process, коли action не передано (DEFAULT_SYNC_ACTION);
+// за замовчуванням convert - лише перекодування без зміни пікселів
+var defaultSyncAction = "convert"
+
+// syncSlots обмежує кількість одночасних синхронних обробок (/sync/process, /sync/preview)
+// значенням SYNC_MAX_CONCURRENCY (за замовчуванням - кількість CPU), щоб сплеск синхронних
+// запитів не зайняв усі ядра і не загальмував решту API
+var syncSlots = make(chan struct{}, runtime.NumCPU())
+
+// syncRetryAfterSeconds - значення заголовка Retry-After, коли всі синхронні слоти зайняті
+const syncRetryAfterSeconds = 1
+
+// maxSyncTimeout - найбільше значення timeout_ms для /sync/process з переходом в асинхронний режим
+const maxSyncTimeout = 30 * time.Second
+
+// uploadTempDir - каталог для тимчасових файлів завантаження (UPLOAD_TMP_DIR); за замовчуванням
+// це storage.InputPath, щоб готовий файл переміщувався у кінцеве місце простим rename
+var uploadTempDir = storage.InputPath
+
+// uploadBufferSize - розмір буфера при записі завантаження на диск
+const uploadBufferSize = 64 * 1024
+
+// maxFormFieldBytes обмежує розмір текстових полів форми при потоковому читанні
+const maxFormFieldBytes = 64 * 1024
+
+// maxQueueLength обмежує довжину черги Redis (MAX_QUEUE_LENGTH); 0 - без обмеження
+var maxQueueLength int64
+
+// adminToken - Bearer-токен для адміністративних ендпоінтів (ADMIN_TOKEN); порожній вимикає їх
+var adminToken string
+
+// ownerHeader - заголовок з ідентифікатором користувача, який встановлює автентифікуючий проксі перед API
+const ownerHeader = "X-Owner-ID"
+
+// purgeBatchSize - кількість завдань, що видаляються однією транзакцією при очищенні даних власника
+const purgeBatchSize = 500
+
 func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 	// Реєстрація метрик
 	prometheus.MustRegister(httpRequestsTotal)
+	prometheus.MustRegister(httpRequestsByClass)
+	prometheus.MustRegister(responseSize)
 	prometheus.MustRegister(requestDuration)
+	prometheus.MustRegister(storageErrors)
+	prometheus.MustRegister(downloadFileMissing)
+	prometheus.MustRegister(queueRejections)
+	prometheus.MustRegister(inlineFallbackJobs)
+	prometheus.MustRegister(jobsSubmitted)
+	prometheus.MustRegister(uploadBytes)
+	prometheus.MustRegister(downloadBytes)
+	registerBuildInfo()
+}
 
+// connectStores підключається до PostgreSQL (з міграціями схеми) і Redis. Викликається з main,
+// а не з init, щоб тести пакета не потребували баз даних.
+func connectStores() {
 	// --- 1. POSTGRESQL CONNECTION SETUP ---
 	pgHost := os.Getenv("PG_HOST")
 	pgPort := os.Getenv("PG_PORT")
@@ -79,14 +245,24 @@ func init() {
 	pgPassword := os.Getenv("PG_PASSWORD")
 	pgDBName := os.Getenv("PG_DBNAME")
 
-	if pgHost == "" || pgUser == "" || pgDBName == "" {
-		log.Fatalf("PostgreSQL environment variables (PG_HOST, PG_USER, PG_DBNAME) must be set.")
+	// DATABASE_URL (або PG_DSN) використовується як є і має пріоритет над окремими змінними
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		connStr = os.Getenv("PG_DSN")
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
-		pgUser, pgPassword, pgHost, pgPort, pgDBName)
+	if connStr == "" {
+		if pgHost == "" || pgUser == "" || pgDBName == "" {
+			log.Fatalf("PostgreSQL environment variables (DATABASE_URL, or PG_HOST, PG_USER, PG_DBNAME) must be set.")
+		}
+
+		connStr = fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
+			pgUser, pgPassword, pgHost, pgPort, pgDBName)
+	}
 
 	var err error
+	// Контекст лише для підключення та підготовки схеми під час запуску
+	ctx := context.Background()
 
 	// Підключення до БД
 	pgDB, err = pgx.Connect(ctx, connStr)
@@ -99,22 +275,10 @@ func init() {
 	}
 	log.Println("Successfully connected to PostgreSQL.")
 
-	// --- СТВОРЕННЯ ТАБЛИЦІ JOBS ---
-	createTableQuery := `
-		CREATE TABLE IF NOT EXISTS jobs (
-			id UUID PRIMARY KEY,
-			status VARCHAR(20) NOT NULL,
-			input_path VARCHAR(255) NOT NULL,
-			output_path VARCHAR(255) NULL,
-			action VARCHAR(50) NOT NULL,
-			params VARCHAR(255) NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		);`
-
-	if _, err = pgDB.Exec(ctx, createTableQuery); err != nil {
-		log.Fatalf("Failed to create 'jobs' table: %v", err)
+	// --- МІГРАЦІЇ СХЕМИ (спільні з Worker, див. image_common/migrations) ---
+	if err = migrations.Run(ctx, pgDB); err != nil {
+		log.Fatalf("Failed to apply database migrations: %v", err)
 	}
-	log.Println("'jobs' table ensured to exist.")
 
 	// --- 2. REDIS CONNECTION SETUP ---
 	redisHost := os.Getenv("REDIS_HOST")
@@ -130,10 +294,19 @@ func init() {
 
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 
+	redisTuning, err := queue.RedisTuningFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Redis configuration: %v", err)
+	}
+
 	rdb = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", redisHost, redisPort),
-		Password: redisPassword,
-		DB:       0,
+		Addr:         fmt.Sprintf("%s:%s", redisHost, redisPort),
+		Password:     redisPassword,
+		DB:           0,
+		PoolSize:     redisTuning.PoolSize,
+		DialTimeout:  redisTuning.DialTimeout,
+		ReadTimeout:  redisTuning.ReadTimeout,
+		WriteTimeout: redisTuning.WriteTimeout,
 	})
 
 	if _, err := rdb.Ping(ctx).Result(); err != nil {
@@ -141,22 +314,175 @@ func init() {
 	} else {
 		log.Println("Successfully connected to Redis.")
 	}
+}
 
-	// --- 3. STORAGE SETUP ---
-	if _, err := os.Stat(storagePath); os.IsNotExist(err) {
-		err = os.MkdirAll(storagePath, 0755)
+// loadConfig читає налаштування API зі змінних середовища і готує каталоги сховища
+func loadConfig() {
+	var err error
+	adminToken = os.Getenv("ADMIN_TOKEN")
+
+	auditLog, err = openAuditLog(os.Getenv("AUDIT_LOG"))
+	if err != nil {
+		log.Fatalf("Invalid AUDIT_LOG value: %v", err)
+	}
+	if v := os.Getenv("AUDIT_SECRET"); v != "" {
+		auditSecret = []byte(v)
+	} else {
+		log.Println("Warning: AUDIT_SECRET is not set; audit credential hashes will not match across restarts")
+	}
+	if v := os.Getenv("AUDIT_RATE_LIMIT"); v != "" {
+		auditRateLimit, err = strconv.Atoi(v)
+		if err != nil || auditRateLimit < 0 {
+			log.Fatalf("Invalid AUDIT_RATE_LIMIT value '%s': must be a non-negative integer", v)
+		}
+	}
+
+	if v := os.Getenv("MAX_QUEUE_LENGTH"); v != "" {
+		maxQueueLength, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxQueueLength < 0 {
+			log.Fatalf("Invalid MAX_QUEUE_LENGTH value '%s': must be a non-negative integer", v)
+		}
+		log.Printf("Queue backpressure enabled: MAX_QUEUE_LENGTH=%d", maxQueueLength)
+	}
+
+	// API ставить завдання лише в першу чергу з QUEUE_NAME; решта - для Worker
+	if len(queue.Names) > 1 {
+		log.Printf("QUEUE_NAME lists several queues; jobs are enqueued to '%s'.", queue.Name)
+	}
+
+	if v := os.Getenv("RESULT_INLINE_MAX_BYTES"); v != "" {
+		maxInlineResultBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxInlineResultBytes < 0 {
+			log.Fatalf("Invalid RESULT_INLINE_MAX_BYTES value '%s': must be a non-negative integer", v)
+		}
+	}
+
+	if v := os.Getenv("SYNC_MAX_UPLOAD_BYTES"); v != "" {
+		maxSyncUploadBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxSyncUploadBytes <= 0 {
+			log.Fatalf("Invalid SYNC_MAX_UPLOAD_BYTES value '%s': must be a positive integer", v)
+		}
+	}
+
+	if v := os.Getenv("MULTIPART_MAX_MEMORY_BYTES"); v != "" {
+		multipartMemoryBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || multipartMemoryBytes < 0 {
+			log.Fatalf("Invalid MULTIPART_MAX_MEMORY_BYTES value '%s': must be a non-negative integer", v)
+		}
+	}
+
+	if v := os.Getenv("QUEUE_FALLBACK_INLINE_MAX_BYTES"); v != "" {
+		inlineFallbackMaxBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || inlineFallbackMaxBytes < 0 {
+			log.Fatalf("Invalid QUEUE_FALLBACK_INLINE_MAX_BYTES value '%s': must be a non-negative integer", v)
+		}
+	}
+
+	if v := os.Getenv("SYNC_DISKLESS"); v != "" {
+		syncDiskless, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid SYNC_DISKLESS value '%s': expected true or false", v)
+		}
+	}
+
+	if v := os.Getenv("SYNC_MAX_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid SYNC_MAX_CONCURRENCY value '%s': must be a positive integer", v)
+		}
+		syncSlots = make(chan struct{}, n)
+	}
+
+	if v := os.Getenv("SYNC_MAX_PIXELS"); v != "" {
+		maxSyncPixels, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxSyncPixels <= 0 {
+			log.Fatalf("Invalid SYNC_MAX_PIXELS value '%s': must be a positive integer", v)
+		}
+	}
+
+	// Необов'язковий перелік дій, дозволених на цьому екземплярі (через кому)
+	if v := os.Getenv("ENABLED_ACTIONS"); v != "" {
+		if err := processing.SetEnabled(strings.Split(v, ",")); err != nil {
+			log.Fatalf("Invalid ENABLED_ACTIONS value '%s': %v", v, err)
+		}
+		log.Printf("Enabled actions: %s", strings.Join(processing.Names(), ", "))
+	}
+
+	// Обмеження розміру входу дій - ті самі, що й у Worker, для завдань, які API обробляє само
+	if v := os.Getenv("ACTION_LIMITS"); v != "" {
+		inlineActionLimits, err = processing.ParseActionLimits(v)
+		if err != nil {
+			log.Fatalf("Invalid ACTION_LIMITS value: %v", err)
+		}
+	}
+
+	// Колір, яким заповнюються прозорі області при збереженні у JPEG (за замовчуванням білий)
+	if v := os.Getenv("JPEG_BACKGROUND"); v != "" {
+		if err := processing.SetDefaultBackground(v); err != nil {
+			log.Fatalf("Invalid JPEG_BACKGROUND value '%s': %v", v, err)
+		}
+	}
+	if v := os.Getenv("DEFAULT_JPEG_QUALITY"); v != "" {
+		if err := processing.SetDefaultJPEGQuality(v); err != nil {
+			log.Fatalf("Invalid DEFAULT_JPEG_QUALITY value '%s': %v", v, err)
+		}
+	}
+	if v := os.Getenv("DEFAULT_PNG_COMPRESSION"); v != "" {
+		if err := processing.SetDefaultPNGCompression(v); err != nil {
+			log.Fatalf("Invalid DEFAULT_PNG_COMPRESSION value '%s': %v", v, err)
+		}
+	}
+
+	// Поріг площі мініатюри, до якого resize використовує швидку інтерполяцію (0 - завжди Lanczos3)
+	if v := os.Getenv("FAST_RESIZE_MAX_PIXELS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
 		if err != nil {
-			log.Fatalf("Failed to create storage directory: %v", err)
+			log.Fatalf("Invalid FAST_RESIZE_MAX_PIXELS value '%s': expected a non-negative integer", v)
+		}
+		processing.SetFastResizeThreshold(uint(n))
+	}
+
+	// Найбільша кількість результатів одного завдання (multicrop); 0 - без обмеження
+	if v := os.Getenv("MAX_OUTPUTS_PER_JOB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid MAX_OUTPUTS_PER_JOB value '%s': expected a non-negative integer", v)
 		}
-		log.Printf("Created storage directory: %s", storagePath)
+		processing.SetMaxOutputs(n)
+	}
+	processing.SetDebug(os.Getenv("LOG_LEVEL") == "debug")
+
+	if v := os.Getenv("DEFAULT_SYNC_ACTION"); v != "" {
+		if v == "none" {
+			v = "convert"
+		}
+		if err := processing.Validate(v, ""); err != nil || processing.IsMultiOutput(v) || processing.IsCombine(v) || processing.IsFrames(v) {
+			log.Fatalf("Invalid DEFAULT_SYNC_ACTION value '%s': must be a single-image action without required params", v)
+		}
+		defaultSyncAction = v
+	}
+
+	// UPLOAD_TMP_DIR використовують і потокові завантаження, і parseUploadForm для великих файлів форми
+	if v := os.Getenv("UPLOAD_TMP_DIR"); v != "" {
+		if err := os.MkdirAll(v, 0755); err != nil {
+			log.Fatalf("Failed to create upload temp directory '%s': %v", v, err)
+		}
+		uploadTempDir = v
+	}
+
+	// --- 3. STORAGE SETUP ---
+	if err := storage.Ensure(); err != nil {
+		log.Fatalf("%v", err)
 	}
+	log.Printf("Storage: originals in %s, results in %s", storage.InputPath, storage.OutputPath)
 }
 
 func prometheusMiddleware(handlerName string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		lw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
-		next(lw, r)
+		// Автор запиту для журналу аудиту (auditLog.record читає його з контексту)
+		next(lw, withAuditSource(r))
 		duration := time.Since(start)
 
 		httpRequestsTotal.WithLabelValues(
@@ -164,280 +490,2097 @@ func prometheusMiddleware(handlerName string, next http.HandlerFunc) http.Handle
 			r.Method,
 			strconv.Itoa(lw.status),
 		).Inc()
+		httpRequestsByClass.WithLabelValues(handlerName, statusClass(lw.status)).Inc()
+		responseSize.WithLabelValues(handlerName).Observe(float64(lw.written))
 		requestDuration.WithLabelValues(handlerName).Observe(duration.Seconds())
 	}
 }
 
+// countingResponseWriter рахує байти тіла відповіді для api_download_bytes_total
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (cw *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// statusClass повертає клас коду відповіді ("2xx", "4xx", "5xx"...) для http_requests_by_class_total,
+// щоб частку помилок можна було рахувати й алертити без переліку окремих кодів.
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// loggingResponseWriter запам'ятовує код відповіді для метрик. http.Error і http.ServeFile
+// (206, 304, 416) викликають WriteHeader, а відповідь без явного WriteHeader має код 200.
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	status int
+	status      int
+	wroteHeader bool
+	// written - кількість байтів тіла відповіді для http_response_size_bytes
+	written int64
 }
 
 func (lw *loggingResponseWriter) WriteHeader(code int) {
-	lw.status = code
+	// net/http ігнорує повторний WriteHeader, тож у метриках лишається перший код
+	if !lw.wroteHeader {
+		lw.status = code
+		lw.wroteHeader = true
+	}
 	lw.ResponseWriter.WriteHeader(code)
 }
 
+func (lw *loggingResponseWriter) Write(p []byte) (int, error) {
+	lw.wroteHeader = true
+	n, err := lw.ResponseWriter.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
+
+// Flush передає буферизовані дані клієнту, щоб потокові відповіді (SSE) працювали через middleware.
+func (lw *loggingResponseWriter) Flush() {
+	lw.wroteHeader = true
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack передає з'єднання обробнику (наприклад, для WebSocket), якщо базовий writer це підтримує.
+func (lw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	// Після перехоплення код відповіді задає сам обробник; у метриках - 101 Switching Protocols
+	if !lw.wroteHeader {
+		lw.status = http.StatusSwitchingProtocols
+		lw.wroteHeader = true
+	}
+	return h.Hijack()
+}
+
+// Unwrap дає http.ResponseController доступ до базового writer (дедлайни тощо).
+func (lw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// healthCheckHandler: GET /health - "OK"; з ?verbose=true - JSON зі статусом і даними збірки
+// (звичайна відповідь лишається простим текстом для наявних перевірок)
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("verbose") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Status string `json:"status"`
+			metrics.BuildInfo
+		}{"OK", buildInfo})
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "OK")
 }
 
-// submitJobHandler: Виконує CREATE (INSERT) в PostgreSQL та PUSH в Redis
-func (a *API) submitJobHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
+// actionsHandler: GET /actions - опис усіх увімкнених дій (params, формати входу й результату)
+// з того самого реєстру, за яким перевіряються запити.
+func actionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]processing.ActionInfo{"actions": processing.Describe()}); err != nil {
+		log.Printf("Error encoding actions response: %v", err)
+	}
+}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 25*1024*1024)
-	if err := r.ParseMultipartForm(25 * 1024 * 1024); err != nil {
-		http.Error(w, "Request body too large or bad form data", http.StatusBadRequest)
+// formatsHandler: GET /formats - формати, які ця збірка вміє читати (залежать від підключених
+// декодерів) і в які вміє кодувати результат.
+func formatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string][]string{"input": processing.InputFormats(), "output": processing.OutputFormats}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding formats response: %v", err)
+	}
+}
 
-	file, header, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "Error retrieving image file from form: "+err.Error(), http.StatusBadRequest)
+// submitJobHandler: Приймає multipart-форму та створює завдання.
+// Форма читається потоково: файл одразу пишеться на диск через буфер обмеженого розміру,
+// без ParseMultipartForm, що тримав би до maxUploadBytes у пам'яті.
+// Запит з іншим Content-Type (наприклад, image/png) обробляється як сирі байти зображення.
+func (a *API) submitJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "PUT" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer file.Close()
-
-	action := r.FormValue("action")
-	params := r.FormValue("params")
 
-	allowedActions := map[string]bool{"grayscale": true, "resize": true, "crop": true}
-	if !allowedActions[strings.ToLower(action)] {
-		http.Error(w, fmt.Sprintf("Invalid action. Allowed: %s", strings.Join([]string{"grayscale", "resize", "crop"}, ", ")), http.StatusBadRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); !strings.HasPrefix(mediaType, "multipart/") {
+		a.submitRawJob(w, r)
 		return
 	}
-
-	jobUUID := uuid.New()
-	jobID := jobUUID.String()
-	originalFilename := filepath.Base(header.Filename)
-	filename := fmt.Sprintf("%s_%s", jobID, originalFilename)
-	filePath := filepath.Join(storagePath, filename)
-
-	dst, err := os.Create(filePath)
+	reader, err := r.MultipartReader()
 	if err != nil {
-		log.Printf("Error creating file: %v", err)
-		http.Error(w, "Failed to save file on server.", http.StatusInternalServerError)
+		http.Error(w, "Bad form data: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Error copying file: %v", err)
-		http.Error(w, "Failed to copy file data.", http.StatusInternalServerError)
+	fields := make(map[string]string)
+	var tmpPath, uploadFilename, contentHash string
+	// Тимчасовий файл лишається лише якщо завдання не створено (після переміщення Remove нічого не робить)
+	defer func() {
+		if tmpPath != "" {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body exceeds the maximum upload size.", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Bad form data: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch name := part.FormName(); name {
+		case "image":
+			if tmpPath != "" {
+				part.Close()
+				http.Error(w, "Only one file in the 'image' field is allowed.", http.StatusBadRequest)
+				return
+			}
+			uploadFilename = part.FileName()
+			tmpPath, contentHash, err = streamToTempFile(part)
+			if err != nil {
+				part.Close()
+				log.Printf("Error streaming upload to disk: %v", err)
+				var maxBytesErr *http.MaxBytesError
+				switch {
+				case errors.As(err, &maxBytesErr):
+					http.Error(w, "Request body exceeds the maximum upload size.", http.StatusRequestEntityTooLarge)
+				case storageErrorReason(err) != "":
+					storageFailure(w, err, "")
+				default:
+					http.Error(w, "Bad form data: "+err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+		case "action", "params", "callback_url", "metadata":
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes+1))
+			if err != nil || len(value) > maxFormFieldBytes {
+				part.Close()
+				http.Error(w, fmt.Sprintf("Form field '%s' is too large or unreadable.", name), http.StatusBadRequest)
+				return
+			}
+			fields[name] = string(value)
+		}
+		part.Close()
+	}
+
+	callbackURL := fields["callback_url"]
+	errs := validateSubmission(fields["action"], fields["params"], callbackURL, fields["metadata"], false)
+	if tmpPath == "" {
+		errs = append([]processing.FieldError{{Field: "image", Message: "field 'image' is missing"}}, errs...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
 		return
 	}
 
-	// Створення запису в PostgreSQL
-	insertQuery := `
-		INSERT INTO jobs (id, status, input_path, action, params) 
-		VALUES ($1, $2, $3, $4, $5)`
+	a.createJob(r.Context(), w, a.dedupInput(r.Context(), tmpPath, contentHash), uploadFilename, fields["action"], fields["params"], callbackURL, contentHash, requestOwner(r), fields["metadata"])
+}
+
+// submitRawJob створює завдання з тіла запиту, що містить лише байти зображення.
+// action, params, callback_url і metadata беруться з query string або заголовків X-Action, X-Params,
+// X-Callback-URL, X-Metadata.
+func (a *API) submitRawJob(w http.ResponseWriter, r *http.Request) {
+	field := func(name, header string) string {
+		if v := r.URL.Query().Get(name); v != "" {
+			return v
+		}
+		return r.Header.Get(header)
+	}
 
-	_, err = a.PGDB.Exec(ctx, insertQuery, jobUUID, "QUEUED", filePath, action, params)
+	tmpPath, contentHash, err := streamToTempFile(r.Body)
 	if err != nil {
-		log.Printf("Error inserting job into PostgreSQL: %v", err)
-		http.Error(w, "Failed to record job in database.", http.StatusInternalServerError)
+		log.Printf("Error streaming upload to disk: %v", err)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			http.Error(w, "Request body exceeds the maximum upload size.", http.StatusRequestEntityTooLarge)
+		case storageErrorReason(err) != "":
+			storageFailure(w, err, "")
+		default:
+			http.Error(w, "Failed to read request body.", http.StatusBadRequest)
+		}
 		return
 	}
+	// Після переміщення у сховище Remove нічого не робить
+	defer os.Remove(tmpPath)
 
-	// Відправка завдання в Redis
-	jobData := fmt.Sprintf("%s|%s|%s|%s", jobID, filePath, action, params)
-	queueName := "image_processing_queue"
-
-	err = a.RDB.RPush(ctx, queueName, jobData).Err()
+	f, err := os.Open(tmpPath)
 	if err != nil {
-		log.Printf("Error pushing job to Redis queue: %v", err)
-		http.Error(w, "Failed to queue job (Redis error), database record created.", http.StatusServiceUnavailable)
+		http.Error(w, "Failed to read uploaded image.", http.StatusInternalServerError)
+		return
+	}
+	_, format, decodeErr := image.DecodeConfig(f)
+	f.Close()
+
+	action, params, callbackURL := field("action", "X-Action"), field("params", "X-Params"), field("callback_url", "X-Callback-URL")
+	metadata := field("metadata", "X-Metadata")
+	errs := validateSubmission(action, params, callbackURL, metadata, false)
+	if decodeErr != nil {
+		errs = append([]processing.FieldError{{Field: "image", Message: "request body is not a supported image: " + decodeErr.Error()}}, errs...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	fmt.Fprintf(w, `{"job_id": "%s", "status": "QUEUED"}`, jobID)
+	a.createJob(r.Context(), w, a.dedupInput(r.Context(), tmpPath, contentHash), "upload."+format, action, params, callbackURL, contentHash, requestOwner(r), metadata)
 }
 
-// getJobStatusHandler: Виконує READ (SELECT) з PostgreSQL
-func (a *API) getJobStatusHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// streamToTempFile записує вміст частини форми у тимчасовий файл у uploadTempDir і повертає його шлях
+// та SHA-256 вмісту. Частково записаний файл видаляється при помилці (наприклад, обрив з'єднання).
+func streamToTempFile(src io.Reader) (string, string, error) {
+	tmp, err := os.CreateTemp(uploadTempDir, "upload-*")
+	if err != nil {
+		return "", "", err
 	}
-	w.Header().Set("Content-Type", "application/json")
 
-	jobIDStr := r.URL.Query().Get("id")
-	if jobIDStr == "" {
-		http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
-		return
+	hasher := sha256.New()
+	n, copyErr := io.CopyBuffer(io.MultiWriter(tmp, hasher), src, make([]byte, uploadBufferSize))
+	uploadBytes.Add(float64(n))
+	closeErr := tmp.Close()
+	if copyErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return "", "", errors.Join(copyErr, closeErr)
 	}
+	return tmp.Name(), hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	// Отримання статусу, шляху та дії з PostgreSQL
-	var (
-		status     string
-		outputPath sql.NullString
-		jobAction  string
-	)
-
-	query := `SELECT status, output_path, action FROM jobs WHERE id = $1`
+// dedupInput повторно використовує вже збережений файл з тим самим вмістом: якщо в черзі є
+// завдання з таким content_hash, новий шлях стає жорстким посиланням на його вхідний файл.
+// Файлова система сама рахує посилання, тому Worker, видаляючи свій вхідний файл, не зачіпає
+// інших завдань. Якщо файл вже видалено або посилання неможливе, використовується тимчасовий файл.
+func (a *API) dedupInput(ctx context.Context, tmpPath, contentHash string) func(filePath string) error {
+	return func(filePath string) error {
+		var existingPath string
+		query := `SELECT input_path FROM jobs WHERE content_hash = $1 AND status IN ('QUEUED', 'PROCESSING') LIMIT 1`
+		err := a.PGDB.QueryRow(ctx, query, contentHash).Scan(&existingPath)
+		if err == nil {
+			if linkErr := os.Link(existingPath, filePath); linkErr == nil {
+				log.Printf("Reusing stored upload %s for identical content (sha256 %s)", existingPath, contentHash)
+				return nil
+			}
+		} else if err != pgx.ErrNoRows {
+			log.Printf("PostgreSQL error looking up upload by content hash: %v", err)
+		}
+		return moveInput(tmpPath)(filePath)
+	}
+}
 
-	err := a.PGDB.QueryRow(ctx, query, jobIDStr).Scan(&status, &outputPath, &jobAction)
+// storageErrorReason розпізнає помилки запису через переповнений (ENOSPC) чи доступний
+// лише для читання (EROFS) диск; для інших помилок повертає ""
+func storageErrorReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return "disk_full"
+	case errors.Is(err, syscall.EROFS):
+		return "read_only"
+	}
+	return ""
+}
 
-	if err == pgx.ErrNoRows {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, `{"job_id": "%s", "status": "UNKNOWN", "message": "Job not found."}`, jobIDStr)
-		return
-	} else if err != nil {
-		log.Printf("PostgreSQL error getting status: %v", err)
-		http.Error(w, "Internal server error reading job status.", http.StatusInternalServerError)
+// storageFailure відповідає 507 Insufficient Storage, якщо сховище переповнене чи недоступне для запису,
+// інакше - 500 з повідомленням fallbackMsg
+func storageFailure(w http.ResponseWriter, err error, fallbackMsg string) {
+	reason := storageErrorReason(err)
+	if reason == "" {
+		http.Error(w, fallbackMsg, http.StatusInternalServerError)
 		return
 	}
+	storageErrors.WithLabelValues(reason).Inc()
+	http.Error(w, fmt.Sprintf("Storage is unavailable (%s), please retry later.", reason), http.StatusInsufficientStorage)
+}
 
-	// Формування відповіді
-	w.WriteHeader(http.StatusOK)
-	response := fmt.Sprintf(`{"job_id": "%s", "status": "%s", "action": "%s"`, jobIDStr, status, jobAction)
+// moveInput переміщує тимчасовий файл у кінцевий шлях завдання.
+// Якщо тимчасовий каталог на іншій файловій системі і rename неможливий, файл копіюється.
+func moveInput(tmpPath string) func(filePath string) error {
+	return func(filePath string) error {
+		if err := os.Rename(tmpPath, filePath); err == nil {
+			return nil
+		}
+		src, err := os.Open(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return copyInput(src)(filePath)
+	}
+}
 
-	if status == "COMPLETED" {
-		downloadURL := fmt.Sprintf("/job/download?id=%s", jobIDStr)
-		response += fmt.Sprintf(`, "download_url": "%s"}`, downloadURL)
-	} else if status == "FAILED" {
-		response += fmt.Sprintf(`, "error_message": "%s"}`, outputPath.String)
+// copyInput записує вміст src у кінцевий шлях завдання, видаляючи частковий файл при помилці.
+func copyInput(src io.Reader) func(filePath string) error {
+	return func(filePath string) error {
+		dst, err := os.Create(filePath)
+		if err != nil {
+			return err
+		}
+
+		_, copyErr := io.CopyBuffer(dst, src, make([]byte, uploadBufferSize))
+		closeErr := dst.Close()
+		if copyErr != nil || closeErr != nil {
+			os.Remove(filePath)
+			return errors.Join(copyErr, closeErr)
+		}
+		return nil
 	}
-	response += "}"
+}
 
-	fmt.Fprint(w, response)
+// jsonSubmitRequest - тіло запиту /job/submit-json (та /job/submit/json)
+type jsonSubmitRequest struct {
+	Action      string `json:"action"`
+	Params      string `json:"params"`
+	ImageBase64 string `json:"image_base64"`
+	CallbackURL string `json:"callback_url"`
+	// Metadata - довільний JSON-об'єкт міток завдання
+	Metadata json.RawMessage `json:"metadata"`
 }
 
-// downloadProcessedImageHandler: Виконує READ (SELECT) output_path з PostgreSQL
-func (a *API) downloadProcessedImageHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
+// submitJSONJobHandler: Приймає JSON з зображенням у base64 та створює завдання так само, як submitJobHandler
+func (a *API) submitJSONJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	jobIDStr := r.URL.Query().Get("id")
-	if jobIDStr == "" {
-		http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+	// base64 збільшує розмір приблизно на третину, плюс запас на решту полів JSON
+	r.Body = http.MaxBytesReader(w, r.Body, int64(base64.StdEncoding.EncodedLen(maxUploadBytes)+64*1024))
+
+	var req jsonSubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Request body too large or invalid JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Отримання статусу та шляху до файлу з PostgreSQL
-	var (
-		status   string
-		filePath sql.NullString
-	)
-
-	query := `SELECT status, output_path FROM jobs WHERE id = $1`
-	err := a.PGDB.QueryRow(ctx, query, jobIDStr).Scan(&status, &filePath)
+	// Підтримуємо також формат data URL ("data:image/png;base64,....")
+	encoded := req.ImageBase64
+	if strings.HasPrefix(encoded, "data:") {
+		if idx := strings.Index(encoded, ","); idx >= 0 {
+			encoded = encoded[idx+1:]
+		}
+	}
 
-	if err == pgx.ErrNoRows {
-		http.Error(w, "Job not found.", http.StatusNotFound)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if len(data) > maxUploadBytes {
+		http.Error(w, "Decoded image exceeds the maximum upload size.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	uploadBytes.Add(float64(len(data)))
+
+	metadata := string(req.Metadata)
+	if metadata == "null" {
+		metadata = ""
+	}
+	errs := validateSubmission(req.Action, req.Params, req.CallbackURL, metadata, false)
+	var format string
+	if err != nil || len(data) == 0 {
+		errs = append([]processing.FieldError{{Field: "image_base64", Message: "field 'image_base64' is missing or is not valid base64"}}, errs...)
+	} else if _, format, err = image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		errs = append([]processing.FieldError{{Field: "image_base64", Message: "field 'image_base64' does not contain a supported image: " + err.Error()}}, errs...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	a.createJob(r.Context(), w, copyInput(bytes.NewReader(data)), "upload."+format, req.Action, req.Params, req.CallbackURL, "", requestOwner(r), metadata)
+}
+
+// validateCallbackURL перевіряє, що callback_url (якщо заданий) є абсолютною http(s) адресою
+func validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid 'callback_url': expected an absolute http(s) URL")
+	}
+	return nil
+}
+
+// validateSubmission перевіряє текстові поля запиту на створення завдання і повертає помилки
+// всіх невалідних полів одразу. combine - чи очікується дія з кількома вхідними зображеннями.
+func validateSubmission(action, params, callbackURL, metadata string, combine bool) []processing.FieldError {
+	errs := processing.ValidateFields(action, params)
+	if len(errs) == 0 || errs[0].Field != "action" {
+		if combine && !processing.IsCombine(action) {
+			errs = append(errs, processing.FieldError{Field: "action", Message: fmt.Sprintf("action '%s' does not combine images; submit it via /job/submit", action)})
+		} else if !combine && processing.IsCombine(action) {
+			errs = append(errs, processing.FieldError{Field: "action", Message: fmt.Sprintf("action '%s' combines several images; submit it via /job/combine", action)})
+		}
+	}
+	if err := validateCallbackURL(callbackURL); err != nil {
+		errs = append(errs, processing.FieldError{Field: "callback_url", Message: err.Error()})
+	}
+	if err := validateMetadata(metadata); err != nil {
+		errs = append(errs, processing.FieldError{Field: "metadata", Message: err.Error()})
+	}
+	return errs
+}
+
+// validateMetadata перевіряє, що metadata (якщо задане) - JSON-об'єкт
+func validateMetadata(metadata string) error {
+	if metadata == "" {
+		return nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(metadata), &object); err != nil {
+		return fmt.Errorf("Invalid 'metadata': expected a JSON object")
+	}
+	return nil
+}
+
+// validationErrorResponse - тіло відповіді 400 зі списком усіх невалідних полів запиту
+type validationErrorResponse struct {
+	Error  string                  `json:"error"`
+	Fields []processing.FieldError `json:"fields"`
+}
+
+// writeValidationErrors відповідає 400 з JSON-списком помилок полів
+func writeValidationErrors(w http.ResponseWriter, errs []processing.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(validationErrorResponse{Error: "invalid request", Fields: errs}); err != nil {
+		log.Printf("Error encoding validation errors: %v", err)
+	}
+}
+
+// createJob: Зберігає одне завантажене зображення (через store) та ставить завдання в чергу.
+// Поля запиту вже перевірив обробник (validateSubmission разом з перевіркою самого зображення).
+func (a *API) createJob(ctx context.Context, w http.ResponseWriter, store func(filePath string) error, uploadFilename, action, params, callbackURL, contentHash, owner, metadata string) {
+	queued := false
+	defer recordSubmission(action, &queued)
+
+	if !a.checkQueueCapacity(ctx, w) {
+		return
+	}
+
+	jobUUID := uuid.New()
+	jobID := jobUUID.String()
+	originalFilename := filepath.Base(uploadFilename)
+	filename := fmt.Sprintf("%s_%s", jobID, originalFilename)
+	filePath := filepath.Join(storage.InputPath, filename)
+
+	if err := store(filePath); err != nil {
+		log.Printf("Error saving file: %v", err)
+		storageFailure(w, err, "Failed to save file on server.")
+		return
+	}
+
+	// Файл лишається на диску лише якщо завдання успішно поставлене в чергу
+	defer func() {
+		if !queued {
+			os.Remove(filePath)
+		}
+	}()
+
+	queued = a.enqueueJob(ctx, w, jobUUID, filePath, action, params, callbackURL, contentHash, owner, metadata)
+}
+
+// recordSubmission рахує спробу створення завдання з тими самими мітками action/outcome, що й Worker.
+// Викликається через defer, тому queued передається вказівником і читається наприкінці обробника.
+func recordSubmission(action string, queued *bool) {
+	outcome := metrics.OutcomeRejected
+	if *queued {
+		outcome = metrics.OutcomeQueued
+	}
+	jobsSubmitted.WithLabelValues(metrics.ActionLabel(action), outcome).Inc()
+}
+
+// combineJobHandler: Приймає кілька зображень (поле "images") для дій, що їх об'єднують (montage).
+// Файли зберігаються в окремий каталог завдання, шлях до якого записується як input_path.
+func (a *API) combineJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	form, err := parseUploadForm(r, min(multipartMemoryBytes, maxUploadBytes))
+	if err != nil {
+		http.Error(w, "Request body too large or bad form data", http.StatusBadRequest)
+		return
+	}
+	defer form.RemoveAll()
+
+	action := r.FormValue("action")
+	params := r.FormValue("params")
+	callbackURL := r.FormValue("callback_url")
+	metadata := r.FormValue("metadata")
+
+	queued := false
+	defer recordSubmission(action, &queued)
+
+	errs := validateSubmission(action, params, callbackURL, metadata, true)
+	files := form.Files("images")
+	if len(files) == 0 {
+		errs = append([]processing.FieldError{{Field: "images", Message: "at least one file in the 'images' field is required"}}, errs...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	actionParams, _, _ := processing.SplitOutputOptions(params)
+	if cells, err := processing.MontageCells(actionParams); err == nil && len(files) > cells {
+		http.Error(w, fmt.Sprintf("Too many images: the grid has room for %d, got %d.", cells, len(files)), http.StatusBadRequest)
+		return
+	}
+
+	if !a.checkQueueCapacity(r.Context(), w) {
+		return
+	}
+
+	jobUUID := uuid.New()
+	inputDir := filepath.Join(storage.InputPath, jobUUID.String()+"_inputs")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		log.Printf("Error creating input directory: %v", err)
+		storageFailure(w, err, "Failed to save files on server.")
+		return
+	}
+
+	defer func() {
+		if !queued {
+			os.RemoveAll(inputDir)
+		}
+	}()
+
+	// Порядковий префікс зберігає порядок файлів у сітці
+	for i, fh := range files {
+		if err := saveUploadedFile(fh, filepath.Join(inputDir, fmt.Sprintf("%03d_%s", i, filepath.Base(fh.Filename)))); err != nil {
+			log.Printf("Error saving uploaded file %s: %v", fh.Filename, err)
+			storageFailure(w, err, "Failed to save files on server.")
+			return
+		}
+	}
+
+	queued = a.enqueueJob(r.Context(), w, jobUUID, inputDir, action, params, callbackURL, "", requestOwner(r), metadata)
+}
+
+// saveUploadedFile копіює один файл multipart-форми у вказаний шлях
+func saveUploadedFile(fh *uploadFile, filePath string) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	n, err := io.Copy(dst, src)
+	uploadBytes.Add(float64(n))
+	return err
+}
+
+// checkQueueCapacity: Зворотний тиск - не приймаємо нові завдання, якщо черга вже переповнена.
+// Повертає false, якщо відповідь з помилкою вже записана у w.
+func (a *API) checkQueueCapacity(ctx context.Context, w http.ResponseWriter) bool {
+	if maxQueueLength <= 0 {
+		return true
+	}
+
+	queueLength, err := a.RDB.XLen(ctx, queue.Name).Result()
+	if err != nil {
+		log.Printf("Error reading Redis queue length: %v", err)
+		if inlineFallbackMaxBytes > 0 {
+			// Рішення приймає enqueueJob: невелике завдання API обробить сам
+			return true
+		}
+		http.Error(w, "Job queue is unavailable.", http.StatusServiceUnavailable)
+		return false
+	}
+	if queueLength >= maxQueueLength {
+		queueRejections.Inc()
+		log.Printf("Rejecting job submission: queue length %d reached limit %d", queueLength, maxQueueLength)
+		w.Header().Set("Retry-After", strconv.Itoa(queueRetryAfterSeconds))
+		http.Error(w, "Job queue is at capacity, please retry later.", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// enqueueJob: Виконує CREATE (INSERT) в PostgreSQL та PUSH в Redis і відповідає 202 з job_id.
+// Повертає false, якщо завдання не поставлене в чергу (відповідь з помилкою вже записана у w).
+func (a *API) enqueueJob(ctx context.Context, w http.ResponseWriter, jobUUID uuid.UUID, filePath, action, params, callbackURL, contentHash, owner, metadata string) bool {
+	jobID := jobUUID.String()
+
+	// Створення запису в PostgreSQL. enqueued = FALSE до успішного XADD: якщо API зупиниться
+	// між записом і постановкою в чергу, завдання поставить у чергу Worker (outbox)
+	insertQuery := `
+		INSERT INTO jobs (id, status, input_path, action, params, callback_url, content_hash, owner, metadata, enqueued) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::jsonb, FALSE)`
+
+	callback := sql.NullString{String: callbackURL, Valid: callbackURL != ""}
+	hash := sql.NullString{String: contentHash, Valid: contentHash != ""}
+	ownerID := sql.NullString{String: owner, Valid: owner != ""}
+	meta := sql.NullString{String: metadata, Valid: metadata != ""}
+	_, err := a.PGDB.Exec(ctx, insertQuery, jobUUID, "QUEUED", filePath, action, params, callback, hash, ownerID, meta)
+	if err != nil {
+		log.Printf("Error inserting job into PostgreSQL: %v", err)
+		http.Error(w, "Failed to record job in database.", http.StatusInternalServerError)
+		return false
+	}
+
+	// Відправка завдання в Redis
+	jobData, err := queue.NewTask(jobID, filePath, action, params).Encode()
+	if err == nil {
+		err = a.pushTask(ctx, jobData)
+	}
+	if err != nil {
+		log.Printf("Error pushing job to Redis queue: %v", err)
+		// Черга недоступна - невелике завдання можна виконати одразу (QUEUE_FALLBACK_INLINE_MAX_BYTES)
+		if a.completeInline(ctx, w, jobID, filePath, action, params, callbackURL) {
+			auditLog.record(ctx, auditEvent{Event: auditSubmit, JobID: jobID, Action: action})
+			return true
+		}
+		a.discardUnqueuedJob(ctx, jobID)
+		http.Error(w, "Failed to queue job (Redis error).", http.StatusServiceUnavailable)
+		return false
+	}
+	a.markEnqueued(ctx, jobID)
+
+	auditLog.record(ctx, auditEvent{Event: auditSubmit, JobID: jobID, Action: action})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, `{"job_id": "%s", "status": "QUEUED"}`, jobID)
+	return true
+}
+
+// Повтори XADD при створенні завдання: короткий збій Redis (перепідключення, failover)
+// не повинен одразу давати клієнту 503
+const (
+	pushAttempts       = 3
+	pushInitialBackoff = 100 * time.Millisecond
+)
+
+// addTask додає повідомлення завдання в stream черги (читає його група споживачів Worker)
+func (a *API) addTask(ctx context.Context, jobData string) error {
+	return a.RDB.XAdd(ctx, &redis.XAddArgs{Stream: queue.Name, Values: map[string]interface{}{queue.TaskField: jobData}}).Err()
+}
+
+// pushTask додає повідомлення в чергу, повторюючи XADD до pushAttempts разів із подвоєнням паузи.
+// Повтори припиняються, якщо клієнт відключився.
+func (a *API) pushTask(ctx context.Context, jobData string) error {
+	backoff := pushInitialBackoff
+	var err error
+	for attempt := 1; attempt <= pushAttempts; attempt++ {
+		if err = a.addTask(ctx, jobData); err == nil {
+			return nil
+		}
+		if attempt == pushAttempts {
+			break
+		}
+		log.Printf("XADD attempt %d/%d failed: %v; retrying in %s", attempt, pushAttempts, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// markEnqueued позначає, що повідомлення завдання вже в черзі. Якщо позначка не збереглася,
+// Worker поставить завдання в чергу ще раз, і повторне повідомлення буде пропущене або оброблене повторно.
+func (a *API) markEnqueued(ctx context.Context, jobID string) {
+	if _, err := a.PGDB.Exec(context.WithoutCancel(ctx), `UPDATE jobs SET enqueued = TRUE WHERE id = $1`, jobID); err != nil {
+		log.Printf("Error marking job %s as enqueued: %v", jobID, err)
+	}
+}
+
+// discardUnqueuedJob прибирає запис завдання, яке не вдалося поставити в чергу: без повідомлення
+// в черзі воно назавжди лишилося б у QUEUED. Запис видаляється, а якщо це не вдалося -
+// позначається FAILED. Контекст запиту не використовується, бо клієнт міг уже відключитися.
+func (a *API) discardUnqueuedJob(ctx context.Context, jobID string) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := a.PGDB.Exec(ctx, "DELETE FROM jobs WHERE id = $1", jobID)
+	if err == nil {
+		return
+	}
+	log.Printf("Error deleting orphaned job %s from PostgreSQL: %v", jobID, err)
+	if _, err := a.PGDB.Exec(ctx, `UPDATE jobs SET status = 'FAILED', error_message = $1 WHERE id = $2 AND status = 'QUEUED'`,
+		"failed to queue job: queue unavailable", jobID); err != nil {
+		log.Printf("Error marking orphaned job %s as FAILED: %v", jobID, err)
+	}
+}
+
+// getJobStatusHandler: Виконує READ (SELECT) з PostgreSQL
+func (a *API) getJobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	jobIDStr := r.URL.Query().Get("id")
+	if jobIDStr == "" {
+		http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Отримання статусу, шляху та дії з PostgreSQL
+	var (
+		status       string
+		errorMessage sql.NullString
+		jobAction    string
+		metadata     []byte
+		outputFormat sql.NullString
+		warning      sql.NullString
+		outputWidth  sql.NullInt32
+		outputHeight sql.NullInt32
+	)
+
+	query := `SELECT status, error_message, action, metadata, output_format, warning, output_width, output_height FROM jobs WHERE id = $1`
+
+	err := a.PGDB.QueryRow(r.Context(), query, jobIDStr).Scan(&status, &errorMessage, &jobAction, &metadata, &outputFormat, &warning, &outputWidth, &outputHeight)
+
+	if err == pgx.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"job_id": "%s", "status": "UNKNOWN", "message": "Job not found."}`, jobIDStr)
+		return
+	} else if err != nil {
+		log.Printf("PostgreSQL error getting status: %v", err)
+		http.Error(w, "Internal server error reading job status.", http.StatusInternalServerError)
+		return
+	}
+
+	// ?include=result: для завершеного завдання одразу віддаємо зображення замість JSON,
+	// щоб клієнт не робив окремий запит на /job/download
+	if status == "COMPLETED" && r.URL.Query().Get("include") == "result" {
+		disposition, err := parseDisposition(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, ok := a.resolveResultPath(w, r, jobIDStr)
+		if !ok {
+			return
+		}
+		w.Header().Set("X-Job-Status", status)
+		serveResultFile(w, r, jobIDStr, result, disposition)
+		return
+	}
+
+	// Формування відповіді
+	response := jobStatusResponse{JobID: jobIDStr, Status: status, Action: jobAction, Metadata: metadata}
+
+	if status == "COMPLETED" {
+		response.DownloadURL = fmt.Sprintf("/job/download?id=%s", jobIDStr)
+		response.OutputFormat = outputFormat.String
+		response.Warning = warning.String
+		response.OutputWidth, response.OutputHeight = int(outputWidth.Int32), int(outputHeight.Int32)
+
+		outputs, err := a.listJobOutputs(r.Context(), jobIDStr)
+		if err != nil {
+			log.Printf("PostgreSQL error listing outputs: %v", err)
+			http.Error(w, "Internal server error reading job outputs.", http.StatusInternalServerError)
+			return
+		}
+		response.Outputs = outputs
+	} else if status == "FAILED" {
+		response.ErrorMessage = errorMessage.String
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding job status response: %v", err)
+	}
+}
+
+// jobStatusResponse - тіло відповіді /job/status
+type jobStatusResponse struct {
+	JobID       string `json:"job_id"`
+	Status      string `json:"status"`
+	Action      string `json:"action"`
+	DownloadURL string `json:"download_url,omitempty"`
+	// OutputFormat - формат основного результату (для format=smart - обраний за вмістом)
+	OutputFormat string `json:"output_format,omitempty"`
+	// OutputWidth і OutputHeight - фактичні розміри основного результату (після округлення resize)
+	OutputWidth  int         `json:"output_width,omitempty"`
+	OutputHeight int         `json:"output_height,omitempty"`
+	Outputs      []jobOutput `json:"outputs,omitempty"`
+	// Warning - попередження обробки, наприклад що з анімованого GIF оброблено лише перший кадр
+	// (ANIMATED_INPUT_POLICY=first_frame у Worker); з policy reject такий вхід дає FAILED
+	Warning      string `json:"warning,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	// Metadata - мітки, передані при створенні завдання
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// jobOutput - один іменований результат завдання (наприклад, область multicrop)
+type jobOutput struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"download_url"`
+}
+
+// listJobOutputs: Виконує READ (SELECT) додаткових результатів завдання з job_outputs
+func (a *API) listJobOutputs(ctx context.Context, jobID string) ([]jobOutput, error) {
+	rows, err := a.PGDB.Query(ctx, `SELECT name FROM job_outputs WHERE job_id = $1 ORDER BY name`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outputs []jobOutput
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, jobOutput{
+			Name:        name,
+			DownloadURL: fmt.Sprintf("/job/download?id=%s&name=%s", jobID, name),
+		})
+	}
+	return outputs, rows.Err()
+}
+
+// getJobManifestHandler: GET /job/manifest?id=... - JSON-маніфест завершеного завдання
+// (хеші та розміри входів і результатів, дія, params, тривалість, версія Worker).
+func (a *API) getJobManifestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobIDStr := r.URL.Query().Get("id")
+	if _, err := uuid.Parse(jobIDStr); err != nil {
+		http.Error(w, "Missing or invalid 'id' parameter", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	err := a.PGDB.QueryRow(r.Context(), `SELECT status FROM jobs WHERE id = $1`, jobIDStr).Scan(&status)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Job not found.", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("PostgreSQL error getting status: %v", err)
+		http.Error(w, "Internal server error reading job status.", http.StatusInternalServerError)
+		return
+	}
+	if status != "COMPLETED" {
+		http.Error(w, fmt.Sprintf("Manifest is available for completed jobs only. Current status: %s", status), http.StatusConflict)
+		return
+	}
+
+	data, err := os.ReadFile(manifest.Path(jobIDStr))
+	if errors.Is(err, os.ErrNotExist) {
+		// Завдання, завершені до появи маніфестів, їх не мають
+		http.Error(w, "Manifest not found for this job.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error reading manifest of job %s: %v", jobIDStr, err)
+		http.Error(w, "Failed to read job manifest.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// downloadProcessedImageHandler: Виконує READ (SELECT) output_path з PostgreSQL
+func (a *API) downloadProcessedImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobIDStr := r.URL.Query().Get("id")
+	if jobIDStr == "" {
+		http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+		return
+	}
+	disposition, err := parseDisposition(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, ok := a.resolveResultPath(w, r, jobIDStr)
+	if !ok || clientGone(r, "lookup") {
+		return
+	}
+
+	// ?format=jpeg|png|webp[&quality=N]: перекодування збереженого результату перед віддачею.
+	// Без ?format формат обирається за заголовком Accept (наприклад, WebP для браузерів)
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		w.Header().Add("Vary", "Accept")
+		format = negotiateFormat(r.Header.Get("Accept"), result.Path)
+	}
+	if format != "" {
+		options := "format=" + format
+		if quality := r.URL.Query().Get("quality"); quality != "" {
+			options += ",quality=" + quality
+		}
+		_, opts, err := processing.SplitOutputOptions(options)
+		if err == nil && opts.Format == processing.FormatSmart {
+			err = errors.New("format=smart is only supported when the job is submitted")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		variantPath, err := transcodeResult(result.Path, opts)
+		if err != nil {
+			log.Printf("Error transcoding result %s to %s: %v", result.Path, opts.Format, err)
+			http.Error(w, "Failed to convert the result to the requested format.", http.StatusInternalServerError)
+			return
+		}
+		result.Path = variantPath
+	}
+
+	serveResultFile(w, r, jobIDStr, result, disposition)
+}
+
+// negotiatedFormats - формати, на які /job/download перекодовує результат, якщо клієнт явно
+// вказав їх у Accept, у порядку переваги
+var negotiatedFormats = []string{"webp"}
+
+// negotiateFormat повертає формат з negotiatedFormats, який приймає клієнт, або "", якщо слід
+// віддати збережений формат. Враховуються лише явні типи: "*/*" та "image/*" нічого не змінюють,
+// а q=0 означає відмову від типу.
+func negotiateFormat(accept, resultPath string) string {
+	accepted := make(map[string]bool)
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+		accepted[mediaType] = true
+	}
+
+	for _, format := range negotiatedFormats {
+		opts := processing.OutputOptions{Format: format}
+		if filepath.Ext(resultPath) == opts.Extension() {
+			// Результат уже в кращому з прийнятних форматів
+			return ""
+		}
+		if accepted[opts.ContentType()] {
+			return format
+		}
+	}
+	return ""
+}
+
+// transcodeResult повертає шлях до варіанту результату в іншому форматі. Варіант кешується поруч
+// з оригіналом під іменем, що включає формат і якість, тому повторний запит не перекодовує файл.
+func transcodeResult(resultPath string, opts processing.OutputOptions) (string, error) {
+	base := strings.TrimSuffix(resultPath, filepath.Ext(resultPath))
+	variantPath := fmt.Sprintf("%s.q%d%s", base, opts.EffectiveQuality(), opts.Extension())
+	if _, err := os.Stat(variantPath); err == nil {
+		return variantPath, nil
+	}
+
+	src, err := os.Open(resultPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return "", err
+	}
+
+	// Запис у тимчасовий файл і rename: паралельні запити не побачать недописаний варіант
+	tmp, err := os.CreateTemp(filepath.Dir(resultPath), "variant-*")
+	if err != nil {
+		return "", err
+	}
+	encodeErr := processing.Encode(tmp, img, opts)
+	closeErr := tmp.Close()
+	if encodeErr != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Join(encodeErr, closeErr)
+	}
+	if err := os.Rename(tmp.Name(), variantPath); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return variantPath, nil
+}
+
+// parseDisposition читає ?disposition=inline|attachment (за замовчуванням attachment)
+func parseDisposition(r *http.Request) (string, error) {
+	switch d := r.URL.Query().Get("disposition"); d {
+	case "", "attachment":
+		return "attachment", nil
+	case "inline":
+		return d, nil
+	default:
+		return "", fmt.Errorf("Invalid 'disposition': expected inline or attachment")
+	}
+}
+
+// jobResultFile - файл результату завдання на диску та зрозуміле ім'я для завантаження
+type jobResultFile struct {
+	Path string
+	// Stem - ім'я для Content-Disposition без розширення ("myphoto_grayscale");
+	// розширення береться з Path, бо результат могли перекодувати (?format=)
+	Stem string
+}
+
+// Filename повертає ім'я файлу для клієнта: Stem з розширенням результату
+func (f jobResultFile) Filename() string {
+	return f.Stem + filepath.Ext(f.Path)
+}
+
+// resultStem формує ім'я результату з імені завантаженого оригіналу та дії:
+// "myphoto.jpg" + grayscale -> "myphoto_grayscale". Оригінальне ім'я зберігається у input_path
+// з префіксом "<job_id>_". Для /job/combine (каталог входів) лишається лише дія, для дій
+// з кількома результатами додається назва результату (?name=).
+func resultStem(jobID, inputPath, action, outputName string) string {
+	stem := action
+	if !processing.IsCombine(action) {
+		original := strings.TrimPrefix(filepath.Base(inputPath), jobID+"_")
+		if original = strings.TrimSuffix(original, filepath.Ext(original)); original != "" {
+			stem = original + "_" + action
+		}
+	}
+	if outputName != "" {
+		stem += "_" + outputName
+	}
+	return stem
+}
+
+// serveResultFile віддає файл результату завдання: як вкладення (attachment) або для показу
+// в браузері (inline)
+func serveResultFile(w http.ResponseWriter, r *http.Request, jobID string, result jobResultFile, disposition string) {
+	// Content-Type явно за розширенням файлу (.jpg, .png, ...): заголовок міг бути вже встановлений
+	// обробником (наприклад, application/json у /job/status), і тоді ServeFile його не змінив би
+	if contentType := mime.TypeByExtension(filepath.Ext(result.Path)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// Браузер не повинен вгадувати інший тип для вмісту, показаного inline
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// FormatMediaType екранує лапки, а не-ASCII ім'я кодує як filename*=utf-8''... (RFC 2231)
+	resultFilename := result.Filename()
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": resultFilename}))
+
+	cw := &countingResponseWriter{ResponseWriter: w}
+	http.ServeFile(cw, r, result.Path)
+	downloadBytes.Add(float64(cw.written))
+	if r.Context().Err() != nil {
+		log.Printf("Download of job result ID %s aborted: client disconnected", jobID)
+		return
+	}
+	log.Printf("Job result ID %s downloaded: %s", jobID, resultFilename)
+	auditLog.record(r.Context(), auditEvent{Event: auditDownload, JobID: jobID, Details: map[string]any{"file": resultFilename}})
+}
+
+// resolveResultPath: Виконує READ (SELECT) шляху до результату завдання з PostgreSQL.
+// Параметр запиту name обирає один з кількох результатів. У разі помилки відповідь уже записана у w.
+func (a *API) resolveResultPath(w http.ResponseWriter, r *http.Request, jobID string) (jobResultFile, bool) {
+	// Отримання статусу та шляху до файлу з PostgreSQL
+	var (
+		status       string
+		filePath     sql.NullString
+		errorMessage sql.NullString
+		inputPath    string
+		action       string
+	)
+
+	query := `SELECT status, output_path, error_message, input_path, action FROM jobs WHERE id = $1`
+	err := a.PGDB.QueryRow(r.Context(), query, jobID).Scan(&status, &filePath, &errorMessage, &inputPath, &action)
+
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Job not found.", http.StatusNotFound)
+		return jobResultFile{}, false
 	} else if err != nil {
 		log.Printf("PostgreSQL error checking status for download: %v", err)
 		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return jobResultFile{}, false
+	}
+
+	// Невдале завдання результату вже не матиме - окремий код, щоб клієнт припинив опитування
+	if status == "FAILED" {
+		http.Error(w, fmt.Sprintf("Job failed: %s", errorMessage.String), http.StatusUnprocessableEntity)
+		return jobResultFile{}, false
+	}
+
+	// Перевірка статусу та наявності шляху
+	if status != "COMPLETED" || !filePath.Valid {
+		http.Error(w, fmt.Sprintf("Job is not completed yet. Current status: %s", status), http.StatusAccepted)
+		return jobResultFile{}, false
+	}
+
+	finalFilePath := filePath.String
+
+	// Для дій з кількома результатами конкретний файл обирається за ім'ям
+	outputName := r.URL.Query().Get("name")
+	if outputName != "" {
+		query := `SELECT output_path FROM job_outputs WHERE job_id = $1 AND name = $2`
+		err := a.PGDB.QueryRow(r.Context(), query, jobID, outputName).Scan(&finalFilePath)
+		if err == pgx.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Output '%s' not found for this job.", outputName), http.StatusNotFound)
+			return jobResultFile{}, false
+		} else if err != nil {
+			log.Printf("PostgreSQL error reading job output for download: %v", err)
+			http.Error(w, "Internal server error.", http.StatusInternalServerError)
+			return jobResultFile{}, false
+		}
+	}
+
+	// Перевірка наявності файлу на диску
+	_, err = os.Stat(finalFilePath)
+	if os.IsNotExist(err) {
+		// Завдання COMPLETED, але файлу немає - найімовірніше, його видалило очищення сховища
+		downloadFileMissing.Inc()
+		log.Printf("WARNING: Result file for COMPLETED job %s is missing on disk: %s", jobID, finalFilePath)
+		http.Error(w, "Processed file not found on disk.", http.StatusNotFound)
+		return jobResultFile{}, false
+	}
+
+	return jobResultFile{Path: finalFilePath, Stem: resultStem(jobID, inputPath, action, outputName)}, true
+}
+
+// getJobResultHandler: Повертає результат завдання у JSON як base64 (для клієнтів без окремого завантаження)
+func (a *API) getJobResultHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobIDStr := r.URL.Query().Get("id")
+	if jobIDStr == "" {
+		http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+		return
+	}
+
+	result, ok := a.resolveResultPath(w, r, jobIDStr)
+	if !ok {
+		return
+	}
+	finalFilePath := result.Path
+
+	info, err := os.Stat(finalFilePath)
+	if err != nil {
+		log.Printf("Error reading result file info %s: %v", finalFilePath, err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	// Великі результати не вбудовуються у JSON - перенаправляємо на звичайне завантаження
+	if info.Size() > maxInlineResultBytes {
+		downloadURL := "/job/download?" + r.URL.RawQuery
+		http.Redirect(w, r, downloadURL, http.StatusSeeOther)
+		return
+	}
+
+	data, err := os.ReadFile(finalFilePath)
+	if err != nil {
+		log.Printf("Error reading result file %s: %v", finalFilePath, err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := jobResultResponse{
+		JobID:       jobIDStr,
+		Filename:    result.Filename(),
+		ContentType: http.DetectContentType(data),
+		DataBase64:  base64.StdEncoding.EncodeToString(data),
+	}
+	cw := &countingResponseWriter{ResponseWriter: w}
+	defer func() { downloadBytes.Add(float64(cw.written)) }()
+	if err := json.NewEncoder(cw).Encode(response); err != nil {
+		log.Printf("Error encoding job result response: %v", err)
+		return
+	}
+	auditLog.record(r.Context(), auditEvent{Event: auditDownload, JobID: jobIDStr, Details: map[string]any{"file": result.Filename()}})
+}
+
+// jobResultResponse - тіло відповіді /job/result
+type jobResultResponse struct {
+	JobID       string `json:"job_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	DataBase64  string `json:"data_base64"`
+}
+
+// synchronousImageHandler: Обробляє зображення синхронно.
+// Якщо задано timeout_ms, обробка обмежується цим часом: не встигли - зображення ставиться
+// в чергу як звичайне завдання і клієнт отримує 202 з job_id.
+func (a *API) synchronousImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSyncUploadBytes)
+	// Файли форми, більші за поріг, parseUploadForm пише у тимчасові файли, тож з
+	// MULTIPART_MAX_MEMORY_BYTES < SYNC_MAX_UPLOAD_BYTES великі завантаження потрапляють на диск.
+	// У режимі SYNC_DISKLESS поріг - увесь ліміт тіла: файли форми, що в нього вміщуються,
+	// завжди лишаються в пам'яті.
+	memoryBytes := min(multipartMemoryBytes, maxSyncUploadBytes)
+	if syncDiskless {
+		memoryBytes = maxSyncUploadBytes
+	}
+	form, err := parseUploadForm(r, memoryBytes)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Image exceeds the synchronous processing limit of %d bytes.", maxSyncUploadBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Bad form data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer form.RemoveAll()
+
+	var syncTimeout time.Duration
+	if v := r.FormValue("timeout_ms"); v != "" {
+		if syncDiskless {
+			http.Error(w, "'timeout_ms' is not available: the server processes synchronous requests without storage (SYNC_DISKLESS).", http.StatusBadRequest)
+			return
+		}
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 || time.Duration(ms)*time.Millisecond > maxSyncTimeout {
+			http.Error(w, fmt.Sprintf("Invalid 'timeout_ms': expected integer 1-%d.", maxSyncTimeout.Milliseconds()), http.StatusBadRequest)
+			return
+		}
+		syncTimeout = time.Duration(ms) * time.Millisecond
+	}
+
+	action := r.FormValue("action")
+	if action == "" {
+		action = defaultSyncAction
+	}
+	widthStr := r.FormValue("width")
+	heightStr := r.FormValue("height")
+
+	// Для сумісності resize приймає також окремі поля width та height
+	params := r.FormValue("params")
+	if params == "" && strings.ToLower(action) == "resize" {
+		params = widthStr + "x" + heightStr
+	}
+
+	if err := processing.Validate(action, params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if processing.IsMultiOutput(action) || processing.IsCombine(action) || processing.IsFrames(action) {
+		if syncTimeout > 0 {
+			http.Error(w, "'timeout_ms' is only supported for single-image actions.", http.StatusBadRequest)
+			return
+		}
+		release, ok := acquireSyncSlot(w)
+		if !ok {
+			return
+		}
+		defer release()
+		processSyncSpecial(w, r, form, action, params)
+		return
+	}
+
+	file, header, err := form.File("image")
+	if err != nil {
+		http.Error(w, "Error retrieving image file from form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Спершу читаємо лише заголовок: розміри перевіряються до виділення пам'яті під пікселі
+	config, inputFormat, err := image.DecodeConfig(file)
+	if err != nil {
+		log.Printf("Error decoding image config: %v", err)
+		http.Error(w, "Failed to decode image.", http.StatusBadRequest)
 		return
 	}
+	tooLarge := int64(config.Width)*int64(config.Height) > maxSyncPixels
+	if tooLarge && syncTimeout == 0 {
+		http.Error(w, fmt.Sprintf("Image dimensions %dx%d exceed the synchronous processing limit of %d pixels.", config.Width, config.Height, maxSyncPixels), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Error rewinding uploaded image: %v", err)
+		http.Error(w, "Failed to read image.", http.StatusInternalServerError)
+		return
+	}
+
+	if syncTimeout > 0 && tooLarge {
+		// Завелике для синхронної обробки - одразу асинхронне завдання
+		a.createJob(r.Context(), w, copyInput(file), header.Filename, action, params, "", "", requestOwner(r), "")
+		return
+	}
+
+	release, ok := acquireSyncSlot(w)
+	if !ok {
+		return
+	}
+	if syncTimeout > 0 {
+		// Слот звільняє фонова обробка, яка може тривати довше за запит
+		a.processWithFallback(w, r, file, header.Filename, action, params, syncTimeout, release)
+		return
+	}
+	defer release()
+
+	actionParams, outOpts, _ := processing.SplitOutputOptions(params)
+	src, err := processing.SelectPage(file, inputFormat, outOpts.Page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	img, format, err := image.Decode(src)
+	if err != nil {
+		log.Printf("Error decoding image: %v", err)
+		http.Error(w, "Failed to decode image.", http.StatusBadRequest)
+		return
+	}
+	if err := processing.CheckInput(action, format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img = processing.NormalizeColorSpace(img, file)
+	if outOpts.PreserveMetadata {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			outOpts.Metadata, _ = processing.ReadJPEGMetadata(file)
+		}
+	}
+	if outOpts.KeepICC {
+		if _, err := file.Seek(0, io.SeekStart); err == nil {
+			outOpts.ICCProfile, _ = processing.ExtractICCProfile(file)
+		}
+	}
 
-	// Перевірка статусу та наявності шляху
-	if status != "COMPLETED" || !filePath.Valid {
-		http.Error(w, fmt.Sprintf("Job is not completed yet. Current status: %s", status), http.StatusAccepted)
+	// Клієнт міг відключитися під час декодування - тоді обробка вже нікому не потрібна
+	if clientGone(r, "decode") {
 		return
 	}
 
-	finalFilePath := filePath.String
+	processedImg, err := processing.Process(img, action, actionParams)
+	if err != nil {
+		http.Error(w, "Failed to process image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Відправлення файлу
-	_, err = os.Stat(finalFilePath)
-	if os.IsNotExist(err) {
-		log.Printf("File not found on disk: %s", finalFilePath)
-		http.Error(w, "Processed file not found on disk.", http.StatusNotFound)
+	if clientGone(r, "processing") {
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	resultFilename := filepath.Base(finalFilePath)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", resultFilename))
+	// format=smart: формат і заголовки визначаються за обробленим зображенням
+	outOpts = outOpts.ForImage(processedImg)
+	setSyncResultHeaders(w, action, outOpts)
 
-	http.ServeFile(w, r, finalFilePath)
-	log.Printf("Job result ID %s downloaded: %s", jobIDStr, resultFilename)
+	if err := processing.Encode(w, processedImg, outOpts); err != nil {
+		log.Printf("Error encoding processed image to response: %v", err)
+		http.Error(w, "Failed to encode image response.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Synchronous action %s completed and image returned.", action)
 }
 
-// synchronousImageHandler: Обробляє зображення синхронно
-func synchronousImageHandler(w http.ResponseWriter, r *http.Request) {
+// defaultPreviewSize і maxPreviewSize - довша сторона проксі для /sync/preview (поле size)
+const (
+	defaultPreviewSize = 512
+	maxPreviewSize     = 2048
+)
+
+// previewHandler: POST /sync/preview - швидкий перегляд результату дії. Зображення спершу
+// зменшується до проксі (довша сторона до size, за замовчуванням 512), і дія виконується вже на ньому.
+// Params з абсолютними координатами (наприклад, crop) застосовуються до проксі як є.
+func (a *API) previewHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	file, _, err := r.FormFile("image")
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	form, err := parseUploadForm(r, min(multipartMemoryBytes, maxUploadBytes))
+	if err != nil {
+		http.Error(w, "Request body too large or bad form data", http.StatusBadRequest)
+		return
+	}
+	defer form.RemoveAll()
+
+	file, _, err := form.File("image")
 	if err != nil {
 		http.Error(w, "Error retrieving image file from form: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
+	size := defaultPreviewSize
+	if v := r.FormValue("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size <= 0 || size > maxPreviewSize {
+			http.Error(w, fmt.Sprintf("Invalid 'size': expected integer 1-%d.", maxPreviewSize), http.StatusBadRequest)
+			return
+		}
+	}
+
 	action := r.FormValue("action")
-	widthStr := r.FormValue("width")
-	heightStr := r.FormValue("height")
+	if action == "" {
+		action = defaultSyncAction
+	}
+	params := r.FormValue("params")
+	if errs := processing.ValidateFields(action, params); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if processing.IsMultiOutput(action) || processing.IsCombine(action) || processing.IsFrames(action) {
+		http.Error(w, "Actions with multiple inputs, outputs or animation frames cannot be previewed.", http.StatusBadRequest)
+		return
+	}
 
-	img, _, err := image.Decode(file)
+	config, inputFormat, err := image.DecodeConfig(file)
+	if err != nil {
+		http.Error(w, "Failed to decode image.", http.StatusBadRequest)
+		return
+	}
+	if int64(config.Width)*int64(config.Height) > maxSyncPixels {
+		http.Error(w, fmt.Sprintf("Image dimensions %dx%d exceed the synchronous processing limit of %d pixels.", config.Width, config.Height, maxSyncPixels), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read image.", http.StatusInternalServerError)
+		return
+	}
+
+	actionParams, outOpts, _ := processing.SplitOutputOptions(params)
+	release, ok := acquireSyncSlot(w)
+	if !ok {
+		return
+	}
+	defer release()
+
+	src, err := processing.SelectPage(file, inputFormat, outOpts.Page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img, format, err := image.Decode(src)
 	if err != nil {
-		log.Printf("Error decoding image: %v", err)
 		http.Error(w, "Failed to decode image.", http.StatusBadRequest)
 		return
 	}
+	if err := processing.CheckInput(action, format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	proxy := processing.Thumbnail(processing.NormalizeColorSpace(img, src), uint(size))
+	if clientGone(r, "decode") {
+		return
+	}
+
+	processedImg, err := processing.Process(proxy, action, actionParams)
+	if err != nil {
+		http.Error(w, "Failed to process image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pb := proxy.Bounds()
+	outOpts = outOpts.ForImage(processedImg)
+	w.Header().Set("Content-Type", outOpts.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"preview_%s%s\"", action, outOpts.Extension()))
+	w.Header().Set("X-Preview-Size", fmt.Sprintf("%dx%d", pb.Dx(), pb.Dy()))
+	if err := processing.Encode(w, processedImg, outOpts); err != nil {
+		log.Printf("Error encoding preview image to response: %v", err)
+		http.Error(w, "Failed to encode image response.", http.StatusInternalServerError)
+	}
+}
+
+// acquireSyncSlot займає слот синхронної обробки без очікування. Якщо вільних слотів немає,
+// відповідає 503 з Retry-After і повертає false; інакше повертає функцію звільнення слота.
+func acquireSyncSlot(w http.ResponseWriter) (func(), bool) {
+	select {
+	case syncSlots <- struct{}{}:
+		return func() { <-syncSlots }, true
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(syncRetryAfterSeconds))
+		http.Error(w, "Too many concurrent synchronous requests. Please retry later or submit an async job.", http.StatusServiceUnavailable)
+		return nil, false
+	}
+}
+
+// setSyncResultHeaders встановлює заголовки відповіді з обробленим зображенням
+func setSyncResultHeaders(w http.ResponseWriter, action string, opts processing.OutputOptions) {
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"processed_%s_%s%s\"", action, time.Now().Format("20060102_150405"), opts.Extension()))
+}
+
+// syncResult - результат фонової синхронної обробки для processWithFallback
+type syncResult struct {
+	data   []byte
+	opts   processing.OutputOptions
+	status int
+	err    error
+}
+
+// processWithFallback виконує обробку у фоні та чекає на неї не довше timeout.
+// Якщо час вийшов, те саме зображення ставиться в чергу як асинхронне завдання (202 з job_id).
+// Обробку не можна перервати посередині, тому фонова горутина завершиться сама, а її результат буде відкинуто;
+// release (звільнення слота синхронної обробки) викликається, коли вона завершиться.
+func (a *API) processWithFallback(w http.ResponseWriter, r *http.Request, file io.Reader, uploadFilename, action, params string, timeout time.Duration, release func()) {
+	// Файл читається в пам'ять цілком, щоб фонова обробка і постановка в чергу не ділили один reader
+	data, err := io.ReadAll(file)
+	if err != nil {
+		release()
+		log.Printf("Error reading uploaded image: %v", err)
+		http.Error(w, "Failed to read image.", http.StatusInternalServerError)
+		return
+	}
+
+	done := make(chan syncResult, 1)
+	go func() {
+		defer release()
+		actionParams, outOpts, _ := processing.SplitOutputOptions(params)
+		_, inputFormat, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Error decoding image config: %v", err)
+			done <- syncResult{status: http.StatusBadRequest, err: errors.New("Failed to decode image.")}
+			return
+		}
+		src, err := processing.SelectPage(bytes.NewReader(data), inputFormat, outOpts.Page)
+		if err != nil {
+			done <- syncResult{status: http.StatusBadRequest, err: err}
+			return
+		}
+
+		img, format, err := image.Decode(src)
+		if err != nil {
+			log.Printf("Error decoding image: %v", err)
+			done <- syncResult{status: http.StatusBadRequest, err: errors.New("Failed to decode image.")}
+			return
+		}
+		if err := processing.CheckInput(action, format); err != nil {
+			done <- syncResult{status: http.StatusBadRequest, err: err}
+			return
+		}
+		img = processing.NormalizeColorSpace(img, bytes.NewReader(data))
+		if outOpts.PreserveMetadata {
+			outOpts.Metadata, _ = processing.ReadJPEGMetadata(bytes.NewReader(data))
+		}
+		if outOpts.KeepICC {
+			outOpts.ICCProfile, _ = processing.ExtractICCProfile(bytes.NewReader(data))
+		}
+
+		processedImg, err := processing.Process(img, action, actionParams)
+		if err != nil {
+			done <- syncResult{status: http.StatusBadRequest, err: fmt.Errorf("Failed to process image: %v", err)}
+			return
+		}
+
+		outOpts = outOpts.ForImage(processedImg)
+		var buf bytes.Buffer
+		if err := processing.Encode(&buf, processedImg, outOpts); err != nil {
+			log.Printf("Error encoding processed image: %v", err)
+			done <- syncResult{status: http.StatusInternalServerError, err: errors.New("Failed to encode image response.")}
+			return
+		}
+		done <- syncResult{data: buf.Bytes(), opts: outOpts}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			http.Error(w, res.err.Error(), res.status)
+			return
+		}
+		setSyncResultHeaders(w, action, res.opts)
+		if _, err := w.Write(res.data); err != nil {
+			log.Printf("Error writing processed image to response: %v", err)
+			return
+		}
+		log.Printf("Synchronous action %s completed within %s and image returned.", action, timeout)
+	case <-timer.C:
+		log.Printf("Synchronous action %s did not finish within %s, falling back to an async job.", action, timeout)
+		a.createJob(r.Context(), w, copyInput(bytes.NewReader(data)), uploadFilename, action, params, "", "", requestOwner(r), "")
+	case <-r.Context().Done():
+		clientGone(r, "processing")
+	}
+}
+
+// requestOwner повертає власника завдання із заголовка ownerHeader (порожньо, якщо не заданий)
+func requestOwner(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(ownerHeader))
+}
+
+// requireAdmin перевіряє Bearer-токен адміністративного запиту. Без ADMIN_TOKEN адміністративні
+// ендпоінти вимкнені повністю.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminToken == "" {
+		http.Error(w, "Admin endpoints are disabled (ADMIN_TOKEN is not set).", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// purgeOwnerResponse - тіло відповіді DELETE /jobs?owner=...
+type purgeOwnerResponse struct {
+	Owner        string `json:"owner"`
+	DeletedJobs  int    `json:"deleted_jobs"`
+	DeletedFiles int    `json:"deleted_files"`
+}
+
+// purgeOwnerHandler: DELETE /jobs?owner=... видаляє всі завдання власника та їхні вхідні й вихідні файли
+// (наприклад, для запиту на стирання даних). Завдання видаляються пакетами по purgeBatchSize,
+// щоб не тримати довгу транзакцію; файли видаляються після успішного видалення записів пакета.
+func (a *API) purgeOwnerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		http.Error(w, "Missing 'owner' parameter.", http.StatusBadRequest)
+		return
+	}
+
+	response := purgeOwnerResponse{Owner: owner}
+	for {
+		paths, deleted, err := a.purgeOwnerBatch(r.Context(), owner)
+		if err != nil {
+			log.Printf("PostgreSQL error purging jobs of owner %s: %v", owner, err)
+			// Частина завдань уже видалена - це теж фіксується в аудиті
+			auditLog.record(r.Context(), auditEvent{Event: auditDelete, Details: map[string]any{
+				"target_owner": owner, "deleted_jobs": response.DeletedJobs, "error": "purge interrupted",
+			}})
+			http.Error(w, fmt.Sprintf("Failed to purge jobs (deleted %d so far).", response.DeletedJobs), http.StatusInternalServerError)
+			return
+		}
+		response.DeletedJobs += deleted
+		response.DeletedFiles += removeJobFiles(paths)
+		if deleted < purgeBatchSize {
+			break
+		}
+	}
+
+	log.Printf("Purged data of owner %s: %d jobs, %d files", owner, response.DeletedJobs, response.DeletedFiles)
+	auditLog.record(r.Context(), auditEvent{Event: auditDelete, Details: map[string]any{
+		"target_owner": owner, "deleted_jobs": response.DeletedJobs, "deleted_files": response.DeletedFiles,
+	}})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding purge response: %v", err)
+	}
+}
+
+// requeueStatuses - статуси, завдання в яких можна повторно поставити в чергу через /admin/requeue
+var requeueStatuses = map[string]bool{"FAILED": true}
+
+// requeueResponse - тіло відповіді POST /admin/requeue
+type requeueResponse struct {
+	Status   string `json:"status"`
+	Requeued int    `json:"requeued"`
+	// MissingInput - завдання, вхідний файл яких уже видалено (минув FAILED_INPUT_TTL Worker): повторити їх неможливо
+	MissingInput []string `json:"missing_input"`
+}
+
+// requeueCandidate - завдання, яке /admin/requeue намагається повторити
+type requeueCandidate struct {
+	id, inputPath, action, params string
+}
+
+// requeueJobsHandler: POST /admin/requeue?status=FAILED повторно ставить у чергу всі завдання
+// у цьому статусі, вхідний файл яких ще є на диску (наприклад, після виправлення помилки,
+// через яку впала партія завдань). Статус скидається на QUEUED, а результати попередньої спроби
+// видаляються до постановки в чергу; умова на старий статус не дає двом одночасним запитам
+// поставити те саме завдання двічі.
+func (a *API) requeueJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	if status == "" {
+		status = "FAILED"
+	}
+	if !requeueStatuses[status] {
+		http.Error(w, "Invalid 'status': only FAILED jobs can be requeued.", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := a.listRequeueCandidates(r.Context(), status)
+	if err != nil {
+		log.Printf("PostgreSQL error listing jobs to requeue: %v", err)
+		http.Error(w, "Internal server error listing jobs.", http.StatusInternalServerError)
+		return
+	}
+
+	response := requeueResponse{Status: status, MissingInput: []string{}}
+	for _, job := range candidates {
+		if _, err := os.Stat(job.inputPath); err != nil {
+			response.MissingInput = append(response.MissingInput, job.id)
+			continue
+		}
+
+		outputPaths, reset, err := a.resetRequeuedJob(r.Context(), job.id, status)
+		if err != nil {
+			log.Printf("PostgreSQL error requeuing job %s: %v", job.id, err)
+			http.Error(w, fmt.Sprintf("Failed to requeue jobs (requeued %d so far).", response.Requeued), http.StatusInternalServerError)
+			return
+		}
+		if !reset {
+			// Статус змінився після вибірки (наприклад, паралельний запит уже повторив завдання)
+			continue
+		}
+		// Результати попередньої спроби видаляються до постановки в чергу, щоб Worker записав їх наново
+		removeJobFiles(outputPaths)
 
-	var processedImg image.Image
-	switch strings.ToLower(action) {
-	case "grayscale":
-		bounds := img.Bounds()
-		grayImg := image.NewGray(bounds)
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				originalColor := img.At(x, y)
-				grayColor := color.GrayModel.Convert(originalColor)
-				grayImg.Set(x, y, grayColor)
+		jobData, err := queue.NewTask(job.id, job.inputPath, job.action, job.params).Encode()
+		if err == nil {
+			err = a.addTask(r.Context(), jobData)
+		}
+		if err != nil {
+			log.Printf("Error pushing requeued job %s to Redis queue: %v", job.id, err)
+			// Без повідомлення в черзі завдання зависло б у QUEUED - повертаємо попередній статус
+			if _, revertErr := a.PGDB.Exec(r.Context(), `UPDATE jobs SET status = $1, error_message = $2 WHERE id = $3`,
+				status, "requeue failed: queue unavailable", job.id); revertErr != nil {
+				log.Printf("Error restoring status of job %s: %v", job.id, revertErr)
 			}
+			http.Error(w, fmt.Sprintf("Failed to queue jobs (Redis error, requeued %d so far).", response.Requeued), http.StatusServiceUnavailable)
+			return
+		}
+		response.Requeued++
+		auditLog.record(r.Context(), auditEvent{Event: auditRequeue, JobID: job.id, Action: job.action})
+	}
+
+	log.Printf("Requeued %d %s jobs (%d skipped: input missing)", response.Requeued, status, len(response.MissingInput))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding requeue response: %v", err)
+	}
+}
+
+// resetRequeuedJob в одній транзакції повертає завдання у статусі status до QUEUED і видаляє його
+// рядки job_outputs (інакше повторна обробка multicrop впала б на первинному ключі). Повертає шляхи
+// видалених результатів і false, якщо статус завдання вже змінився.
+func (a *API) resetRequeuedJob(ctx context.Context, jobID, status string) ([]string, bool, error) {
+	tx, err := a.PGDB.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE jobs SET status = 'QUEUED', output_path = NULL, error_message = NULL, warning = NULL WHERE id = $1 AND status = $2`,
+		jobID, status)
+	if err != nil || tag.RowsAffected() == 0 {
+		return nil, false, err
+	}
+
+	rows, err := tx.Query(ctx, `DELETE FROM job_outputs WHERE job_id = $1 RETURNING output_path`, jobID)
+	if err != nil {
+		return nil, false, err
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		paths = append(paths, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+	return paths, true, nil
+}
+
+// listRequeueCandidates повертає завдання у статусі status (від найстаріших, щоб зберегти порядок черги)
+func (a *API) listRequeueCandidates(ctx context.Context, status string) ([]requeueCandidate, error) {
+	rows, err := a.PGDB.Query(ctx, `SELECT id, input_path, action, params FROM jobs WHERE status = $1 ORDER BY created_at`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []requeueCandidate
+	for rows.Next() {
+		var (
+			job    requeueCandidate
+			params sql.NullString
+		)
+		if err := rows.Scan(&job.id, &job.inputPath, &job.action, &params); err != nil {
+			return nil, err
+		}
+		job.params = params.String
+		candidates = append(candidates, job)
+	}
+	return candidates, rows.Err()
+}
+
+// defaultJobsListLimit і maxJobsListLimit - кількість завдань у відповіді GET /jobs (параметр limit)
+const (
+	defaultJobsListLimit = 50
+	maxJobsListLimit     = 500
+)
+
+// jobsHandler розподіляє /jobs за методом: GET - список завдань, DELETE - видалення даних власника.
+func (a *API) jobsHandler() http.HandlerFunc {
+	list := prometheusMiddleware("jobs_list", a.listJobsHandler)
+	purge := prometheusMiddleware("jobs_purge", a.purgeOwnerHandler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			list(w, r)
+			return
+		}
+		purge(w, r)
+	}
+}
+
+// jobListItem - одне завдання у відповіді GET /jobs
+type jobListItem struct {
+	JobID     string          `json:"job_id"`
+	Status    string          `json:"status"`
+	Action    string          `json:"action"`
+	CreatedAt time.Time       `json:"created_at"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+// listJobsHandler: GET /jobs - найновіші завдання власника запиту (X-Owner-ID від автентифікуючого
+// проксі; без нього - 401). Адміністратор (Bearer ADMIN_TOKEN) переглядає завдання будь-якого власника
+// через owner=.... Фільтри: status=..., metadata.<ключ>=<значення> (рядкові значення, всі мають збігтися), limit=N.
+func (a *API) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	owner := requestOwner(r)
+	if r.Header.Get("Authorization") != "" {
+		if !requireAdmin(w, r) {
+			return
 		}
-		processedImg = grayImg
-	case "resize":
-		width, errW := strconv.ParseUint(widthStr, 10, 32)
-		height, errH := strconv.ParseUint(heightStr, 10, 32)
-		if errW != nil || errH != nil || width == 0 || height == 0 {
-			http.Error(w, "Missing or invalid 'width' or 'height' parameters for resize.", http.StatusBadRequest)
+		owner = strings.TrimSpace(query.Get("owner"))
+		if owner == "" {
+			http.Error(w, "Missing 'owner' parameter.", http.StatusBadRequest)
 			return
 		}
-		processedImg = resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
-	case "crop":
-		log.Println("Note: Crop operation is not fully implemented synchronously. Returning original image.")
-		processedImg = img
-	default:
-		http.Error(w, "Unsupported action.", http.StatusBadRequest)
+	} else if owner == "" {
+		// Завдання без власника нікому не належать, тож анонімний запит не отримує жодного списку
+		http.Error(w, fmt.Sprintf("Unauthorized: the %s header is required.", ownerHeader), http.StatusUnauthorized)
 		return
 	}
 
-	newBounds := processedImg.Bounds()
-	rgbaImg := image.NewRGBA(newBounds)
-	draw.Draw(rgbaImg, newBounds, processedImg, newBounds.Min, draw.Src)
+	limit := defaultJobsListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJobsListLimit {
+			http.Error(w, fmt.Sprintf("Invalid 'limit': expected integer 1-%d.", maxJobsListLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"processed_%s_%s.jpg\"", action, time.Now().Format("20060102_150405")))
+	conditions := []string{"owner = $1"}
+	args := []any{owner}
 
-	if err := jpeg.Encode(w, rgbaImg, &jpeg.Options{Quality: 90}); err != nil {
-		log.Printf("Error encoding processed image to response: %v", err)
-		http.Error(w, "Failed to encode image response.", http.StatusInternalServerError)
+	if status := query.Get("status"); status != "" {
+		args = append(args, strings.ToUpper(status))
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	filter := map[string]string{}
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, "metadata."); ok && name != "" {
+			filter[name] = values[0]
+		}
+	}
+	if len(filter) > 0 {
+		encoded, _ := json.Marshal(filter)
+		args = append(args, string(encoded))
+		// @> використовує GIN-індекс jobs_metadata_idx
+		conditions = append(conditions, fmt.Sprintf("metadata @> $%d::jsonb", len(args)))
+	}
+
+	args = append(args, limit)
+	sqlQuery := fmt.Sprintf(`SELECT id, status, action, created_at, metadata FROM jobs WHERE %s ORDER BY created_at DESC LIMIT $%d`,
+		strings.Join(conditions, " AND "), len(args))
+
+	rows, err := a.PGDB.Query(r.Context(), sqlQuery, args...)
+	if err != nil {
+		log.Printf("PostgreSQL error listing jobs: %v", err)
+		http.Error(w, "Internal server error listing jobs.", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Synchronous action %s completed and image returned.", action)
+	defer rows.Close()
+
+	jobs := []jobListItem{}
+	for rows.Next() {
+		var (
+			item     jobListItem
+			metadata []byte
+		)
+		if err := rows.Scan(&item.JobID, &item.Status, &item.Action, &item.CreatedAt, &metadata); err != nil {
+			log.Printf("PostgreSQL error reading job list: %v", err)
+			http.Error(w, "Internal server error listing jobs.", http.StatusInternalServerError)
+			return
+		}
+		item.Metadata = metadata
+		jobs = append(jobs, item)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("PostgreSQL error listing jobs: %v", err)
+		http.Error(w, "Internal server error listing jobs.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]jobListItem{"jobs": jobs}); err != nil {
+		log.Printf("Error encoding job list: %v", err)
+	}
+}
+
+// purgeOwnerBatch в одній транзакції видаляє до purgeBatchSize завдань власника (job_outputs - каскадно)
+// і повертає шляхи їхніх файлів та кількість видалених завдань.
+func (a *API) purgeOwnerBatch(ctx context.Context, owner string) ([]string, int, error) {
+	tx, err := a.PGDB.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT j.id, j.input_path, j.output_path, o.output_path
+		FROM (SELECT id, input_path, output_path FROM jobs WHERE owner = $1 LIMIT $2 FOR UPDATE) j
+		LEFT JOIN job_outputs o ON o.job_id = j.id`, owner, purgeBatchSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		ids   []string
+		paths []string
+		seen  = map[string]bool{}
+	)
+	for rows.Next() {
+		var (
+			id                    string
+			inputPath             string
+			outputPath, extraPath sql.NullString
+		)
+		if err := rows.Scan(&id, &inputPath, &outputPath, &extraPath); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+			paths = append(paths, inputPath, manifest.Path(id))
+			if outputPath.Valid {
+				paths = append(paths, outputPath.String)
+			}
+		}
+		if extraPath.Valid && extraPath.String != outputPath.String {
+			paths = append(paths, extraPath.String)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return nil, 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM jobs WHERE id = ANY($1::uuid[])`, ids); err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, err
+	}
+	return paths, len(ids), nil
+}
+
+// removeJobFiles видаляє файли (і каталоги входів /job/combine) завдань разом з перекодованими
+// варіантами результатів (<base>.q<quality><ext>, див. transcodeResult) і повертає кількість видалених.
+// Файли, яких уже немає (наприклад, вхід, видалений Worker після обробки), не рахуються.
+func removeJobFiles(paths []string) int {
+	removed := 0
+	for _, path := range paths {
+		variants, _ := filepath.Glob(strings.TrimSuffix(path, filepath.Ext(path)) + ".q*")
+		for _, p := range append([]string{path}, variants...) {
+			if _, err := os.Lstat(p); err != nil {
+				continue
+			}
+			if err := os.RemoveAll(p); err != nil {
+				log.Printf("Error removing file %s: %v", p, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed
+}
+
+// clientGone перевіряє, чи не скасовано запит (клієнт відключився), і логує етап, на якому це виявлено
+func clientGone(r *http.Request, stage string) bool {
+	if err := r.Context().Err(); err != nil {
+		log.Printf("Client disconnected after %s stage of %s: %v. Aborting.", stage, r.URL.Path, err)
+		return true
+	}
+	return false
 }
 
 // startMetricsServer: Запускає окремий сервер метрик
 func startMetricsServer() {
 	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", promhttp.Handler())
+	metricsMux.Handle(metrics.Path, promhttp.Handler())
 
 	log.Printf("Starting Prometheus metrics server on port %s", metricsPort)
 	if err := http.ListenAndServe(":"+metricsPort, metricsMux); err != nil {
@@ -446,12 +2589,15 @@ func startMetricsServer() {
 }
 
 func main() {
+	loadConfig()
+	connectStores()
+
 	// Створення єдиного екземпляру API з усіма підключеннями
 	apiInstance := &API{RDB: rdb, PGDB: pgDB}
 
 	// Обов'язкове закриття підключень при виході з main
-	defer apiInstance.PGDB.Close(ctx)
-	defer apiInstance.RDB.Close()
+	defer pgDB.Close(context.Background())
+	defer rdb.Close()
 
 	// go startMetricsServer()
 
@@ -459,13 +2605,25 @@ func main() {
 
 	// Реєстрація методів-обробників
 	mux.HandleFunc("/health", prometheusMiddleware("health_check", healthCheckHandler))
+	mux.HandleFunc("/version", prometheusMiddleware("version", versionHandler))
+	mux.HandleFunc("/formats", prometheusMiddleware("formats", formatsHandler))
+	mux.HandleFunc("/actions", prometheusMiddleware("actions", actionsHandler))
 	mux.HandleFunc("/job/submit", prometheusMiddleware("job_submit", apiInstance.submitJobHandler))
+	mux.HandleFunc("/job/combine", prometheusMiddleware("job_combine", apiInstance.combineJobHandler))
+	mux.HandleFunc("/job/submit-json", prometheusMiddleware("job_submit_json", apiInstance.submitJSONJobHandler))
+	// Той самий обробник за шляхом /job/submit/json
+	mux.HandleFunc("/job/submit/json", prometheusMiddleware("job_submit_json", apiInstance.submitJSONJobHandler))
 	mux.HandleFunc("/job/status", prometheusMiddleware("job_status", apiInstance.getJobStatusHandler))
 	mux.HandleFunc("/job/download", prometheusMiddleware("job_download", apiInstance.downloadProcessedImageHandler))
-	mux.HandleFunc("/sync/process", prometheusMiddleware("sync_process", synchronousImageHandler))
+	mux.HandleFunc("/job/result", prometheusMiddleware("job_result", apiInstance.getJobResultHandler))
+	mux.HandleFunc("/job/manifest", prometheusMiddleware("job_manifest", apiInstance.getJobManifestHandler))
+	mux.HandleFunc("/sync/process", prometheusMiddleware("sync_process", apiInstance.synchronousImageHandler))
+	mux.HandleFunc("/sync/preview", prometheusMiddleware("sync_preview", apiInstance.previewHandler))
+	mux.HandleFunc("/jobs", apiInstance.jobsHandler())
+	mux.HandleFunc("/admin/requeue", prometheusMiddleware("admin_requeue", apiInstance.requeueJobsHandler))
 
 	// Додавання хендлера /metrics
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(metrics.Path, promhttp.Handler())
 
 	log.Println("API Gateway listening on port 8080...")
 	if err := http.ListenAndServe(":8080", mux); err != nil {
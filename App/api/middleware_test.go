@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		code int
+		want string
+	}{
+		{200, "2xx"}, {206, "2xx"}, {304, "3xx"}, {404, "4xx"}, {499, "4xx"}, {500, "5xx"}, {503, "5xx"},
+		{0, "unknown"}, {99, "unknown"}, {600, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := statusClass(tt.code); got != tt.want {
+			t.Errorf("statusClass(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestPrometheusMiddlewareCountsStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		wantCode  string
+		wantClass string
+	}{
+		{"http.Error 400", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "bad", http.StatusBadRequest) }, "400", "4xx"},
+		{"http.Error 503", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}, "503", "5xx"},
+		{"implicit 200", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, "200", "2xx"},
+		{"no body", func(w http.ResponseWriter, r *http.Request) {}, "200", "2xx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Окрема назва обробника - окремі серії лічильників для кожного випадку
+			handler := "test_" + tt.name
+			rec := httptest.NewRecorder()
+			prometheusMiddleware(handler, tt.handler)(rec, httptest.NewRequest("GET", "/", nil))
+
+			if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues(handler, "GET", tt.wantCode)); got != 1 {
+				t.Errorf("http_requests_total{code=%q} = %v, want 1", tt.wantCode, got)
+			}
+			if got := testutil.ToFloat64(httpRequestsByClass.WithLabelValues(handler, tt.wantClass)); got != 1 {
+				t.Errorf("http_requests_by_class_total{class=%q} = %v, want 1", tt.wantClass, got)
+			}
+		})
+	}
+}
+
+func TestLoggingResponseWriterStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.png")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	serveFile := func(w http.ResponseWriter, r *http.Request) { http.ServeFile(w, r, path) }
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		header      map[string]string
+		wantStatus  int
+		wantWritten int64
+	}{
+		{"implicit 200 from Write", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) }, nil, http.StatusOK, 5},
+		{"explicit status", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) }, nil, http.StatusAccepted, 0},
+		{"first WriteHeader wins", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(http.StatusOK)
+		}, nil, http.StatusNotFound, 0},
+		{"WriteHeader after Write", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("x"))
+			w.WriteHeader(http.StatusInternalServerError)
+		}, nil, http.StatusOK, 1},
+		{"http.Error", func(w http.ResponseWriter, r *http.Request) { http.Error(w, "gone", http.StatusGone) }, nil, http.StatusGone, 5},
+		{"ServeFile full", serveFile, nil, http.StatusOK, 10},
+		{"ServeFile range", serveFile, map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, 4},
+		{"ServeFile unsatisfiable range", serveFile, map[string]string{"Range": "bytes=50-60"}, http.StatusRequestedRangeNotSatisfiable, -1},
+		{"ServeFile not modified", serveFile, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/job/download", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			lw := &loggingResponseWriter{ResponseWriter: rec, status: http.StatusOK}
+			tt.handler(lw, req)
+
+			if lw.status != tt.wantStatus || rec.Code != tt.wantStatus {
+				t.Fatalf("recorded status %d, sent %d; want %d", lw.status, rec.Code, tt.wantStatus)
+			}
+			if tt.wantWritten >= 0 && lw.written != tt.wantWritten {
+				t.Fatalf("written = %d bytes, want %d", lw.written, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestLoggingResponseWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	lw := &loggingResponseWriter{ResponseWriter: rec, status: http.StatusOK}
+	var w http.ResponseWriter = lw
+
+	// Потокова відповідь (SSE): кожна подія доходить до клієнта одразу
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("loggingResponseWriter does not implement http.Flusher")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Write([]byte("data: 1\n\n"))
+	flusher.Flush()
+	if !rec.Flushed || rec.Body.String() != "data: 1\n\n" {
+		t.Fatalf("flushed = %v, body %q; want the event flushed", rec.Flushed, rec.Body)
+	}
+
+	// Через http.ResponseController (Unwrap) - так само
+	rec = httptest.NewRecorder()
+	lw = &loggingResponseWriter{ResponseWriter: rec, status: http.StatusOK}
+	if err := http.NewResponseController(lw).Flush(); err != nil || !rec.Flushed {
+		t.Fatalf("ResponseController.Flush = %v, flushed %v", err, rec.Flushed)
+	}
+	if lw.status != http.StatusOK {
+		t.Fatalf("status after Flush = %d, want 200", lw.status)
+	}
+}
+
+// hijackRecorder - ResponseRecorder з підтримкою Hijack, як у з'єднання HTTP/1.1
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+func TestLoggingResponseWriterHijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	lw := &loggingResponseWriter{ResponseWriter: &hijackRecorder{httptest.NewRecorder(), server}, status: http.StatusOK}
+	conn, _, err := http.NewResponseController(lw).Hijack()
+	if err != nil || conn != server {
+		t.Fatalf("Hijack = %v, %v; want the underlying connection", conn, err)
+	}
+	if lw.status != http.StatusSwitchingProtocols {
+		t.Fatalf("status after Hijack = %d, want 101", lw.status)
+	}
+
+	// Writer без Hijack: помилка ErrNotSupported, а не паніка
+	lw = &loggingResponseWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	if _, _, err := lw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("Hijack without support = %v, want http.ErrNotSupported", err)
+	}
+	if lw.status != http.StatusOK {
+		t.Fatalf("status after failed Hijack = %d, want 200", lw.status)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"image_common/processing"
+)
+
+// syncDiskless - режим /sync/process без запису на диск (SYNC_DISKLESS=true), наприклад для
+// контейнерів з файловою системою лише для читання: форма завжди читається в пам'ять (у межах
+// SYNC_MAX_UPLOAD_BYTES), а timeout_ms недоступний, бо перехід в асинхронний режим зберігає
+// вхідний файл у сховищі
+var syncDiskless bool
+
+// syncInputError - помилка вхідного зображення синхронного запиту з HTTP-статусом відповіді
+type syncInputError struct {
+	status int
+	err    error
+}
+
+func (e *syncInputError) Error() string { return e.err.Error() }
+
+// writeSyncInputError відповідає помилкою декодування входу з її статусом
+func writeSyncInputError(w http.ResponseWriter, err error) {
+	var inputErr *syncInputError
+	if errors.As(err, &inputErr) {
+		http.Error(w, inputErr.Error(), inputErr.status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// checkSyncInput читає заголовок зображення: перевіряє формат для дії та ліміт пікселів
+// (SYNC_MAX_PIXELS) до виділення пам'яті під пікселі й повертає reader на початку файлу.
+func checkSyncInput(file io.ReadSeeker, action string) error {
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		log.Printf("Error decoding image config: %v", err)
+		return &syncInputError{http.StatusBadRequest, errors.New("Failed to decode image.")}
+	}
+	if int64(config.Width)*int64(config.Height) > maxSyncPixels {
+		return &syncInputError{http.StatusRequestEntityTooLarge, fmt.Errorf("Image dimensions %dx%d exceed the synchronous processing limit of %d pixels.", config.Width, config.Height, maxSyncPixels)}
+	}
+	if err := processing.CheckInput(action, format); err != nil {
+		return &syncInputError{http.StatusBadRequest, err}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return &syncInputError{http.StatusInternalServerError, errors.New("Failed to read image.")}
+	}
+	return nil
+}
+
+// decodeSyncInput декодує одне вхідне зображення синхронного запиту після checkSyncInput
+func decodeSyncInput(file io.ReadSeeker, action string) (image.Image, error) {
+	if err := checkSyncInput(file, action); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		log.Printf("Error decoding image: %v", err)
+		return nil, &syncInputError{http.StatusBadRequest, errors.New("Failed to decode image.")}
+	}
+	return processing.NormalizeColorSpace(img, file), nil
+}
+
+// processSyncSpecial виконує синхронно дії, що не зводяться до "одне зображення -> одне зображення":
+// з кількома входами (поле images), з кадрами анімації та з кількома результатами
+// (відповідь multipart/mixed, по частині на результат). Усе відбувається в пам'яті.
+func processSyncSpecial(w http.ResponseWriter, r *http.Request, form *uploadForm, action, params string) {
+	actionParams, outOpts, _ := processing.SplitOutputOptions(params)
+
+	if processing.IsCombine(action) {
+		files := form.Files("images")
+		if len(files) == 0 {
+			http.Error(w, "At least one file in the 'images' field is required.", http.StatusBadRequest)
+			return
+		}
+		if cells, err := processing.MontageCells(actionParams); err == nil && len(files) > cells {
+			http.Error(w, fmt.Sprintf("Too many images: the grid has room for %d, got %d.", cells, len(files)), http.StatusBadRequest)
+			return
+		}
+		imgs := make([]image.Image, 0, len(files))
+		for _, fh := range files {
+			img, err := decodeSyncFileHeader(fh, action)
+			if err != nil {
+				writeSyncInputError(w, fmt.Errorf("%s: %w", fh.Filename, err))
+				return
+			}
+			imgs = append(imgs, img)
+		}
+		if clientGone(r, "decode") {
+			return
+		}
+		combined, err := processing.ProcessCombined(imgs, action, actionParams)
+		if err != nil {
+			http.Error(w, "Failed to process image: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeSyncImage(w, r, action, combined, outOpts)
+		return
+	}
+
+	file, _, err := form.File("image")
+	if err != nil {
+		http.Error(w, "Error retrieving image file from form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if processing.IsFrames(action) {
+		if err := checkSyncInput(file, action); err != nil {
+			writeSyncInputError(w, err)
+			return
+		}
+		frames, err := processing.DecodeGIFFrames(file, processing.FrameLimit(action, actionParams))
+		if err != nil {
+			http.Error(w, "Failed to decode animation frames: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if clientGone(r, "decode") {
+			return
+		}
+		result, err := processing.ProcessFrames(frames, action, actionParams)
+		if err != nil {
+			http.Error(w, "Failed to process image: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeSyncImage(w, r, action, result, outOpts)
+		return
+	}
+
+	img, err := decodeSyncInput(file, action)
+	if err != nil {
+		writeSyncInputError(w, err)
+		return
+	}
+	if clientGone(r, "decode") {
+		return
+	}
+	regions, err := processing.ProcessMulti(img, action, actionParams)
+	if err != nil {
+		http.Error(w, "Failed to process image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if clientGone(r, "processing") {
+		return
+	}
+	writeSyncMultipart(w, action, regions, outOpts)
+}
+
+// decodeSyncFileHeader відкриває і декодує один файл форми
+func decodeSyncFileHeader(fh *uploadFile, action string) (image.Image, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, &syncInputError{http.StatusBadRequest, err}
+	}
+	defer file.Close()
+	return decodeSyncInput(file, action)
+}
+
+// writeSyncImage кодує результат синхронної обробки прямо у відповідь
+func writeSyncImage(w http.ResponseWriter, r *http.Request, action string, img image.Image, opts processing.OutputOptions) {
+	if clientGone(r, "processing") {
+		return
+	}
+	opts = opts.ForImage(img)
+	setSyncResultHeaders(w, action, opts)
+	if err := processing.Encode(w, img, opts); err != nil {
+		log.Printf("Error encoding processed image to response: %v", err)
+		http.Error(w, "Failed to encode image response.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Synchronous action %s completed and image returned.", action)
+}
+
+// writeSyncMultipart віддає кілька результатів однією відповіддю multipart/mixed. Кожен результат
+// кодується в пам'ять до запису заголовків, щоб помилку кодування ще можна було повернути як 500.
+func writeSyncMultipart(w http.ResponseWriter, action string, regions []processing.NamedImage, opts processing.OutputOptions) {
+	type encodedPart struct {
+		name string
+		opts processing.OutputOptions
+		data []byte
+	}
+	parts := make([]encodedPart, 0, len(regions))
+	for _, region := range regions {
+		regionOpts := opts.ForImage(region.Image)
+		var buf bytes.Buffer
+		if err := processing.Encode(&buf, region.Image, regionOpts); err != nil {
+			log.Printf("Error encoding region '%s': %v", region.Name, err)
+			http.Error(w, "Failed to encode image response.", http.StatusInternalServerError)
+			return
+		}
+		parts = append(parts, encodedPart{name: region.Name, opts: regionOpts, data: buf.Bytes()})
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.opts.ContentType())
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"name":     part.name,
+			"filename": fmt.Sprintf("processed_%s_%s%s", action, part.name, part.opts.Extension()),
+		}))
+		pw, err := mw.CreatePart(header)
+		if err == nil {
+			_, err = pw.Write(part.data)
+		}
+		if err != nil {
+			log.Printf("Error writing multipart response: %v", err)
+			return
+		}
+	}
+	if err := mw.Close(); err != nil {
+		log.Printf("Error writing multipart response: %v", err)
+		return
+	}
+	log.Printf("Synchronous action %s completed and %d images returned.", action, len(parts))
+}
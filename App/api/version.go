@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"image_common/metrics"
+)
+
+// Дані збірки API; задаються при збірці:
+// go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.buildTime=2024-01-01T00:00:00Z"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// buildInfo - дані збірки для /version, /health і метрики build_info
+var buildInfo = metrics.NewBuildInfo(version, commit, buildTime)
+
+// registerBuildInfo реєструє метрику build_info з даними збірки у мітках
+func registerBuildInfo() {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "build_info",
+		Help:      "Build information of the running API; the value is always 1.",
+	}, metrics.BuildInfoLabels)
+	gauge.WithLabelValues(buildInfo.LabelValues()...).Set(1)
+	prometheus.MustRegister(gauge)
+}
+
+// versionHandler: GET /version - версія, коміт і час збірки запущеного API
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildInfo); err != nil {
+		log.Printf("Error encoding version response: %v", err)
+	}
+}
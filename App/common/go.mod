@@ -0,0 +1,18 @@
+module image_common
+
+go 1.25.1
+
+require (
+	github.com/gen2brain/webp v0.6.4
+	github.com/jackc/pgx/v5 v5.7.6
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	golang.org/x/image v0.33.0
+)
+
+require (
+	github.com/ebitengine/purego v0.10.1 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/text v0.31.0 // indirect
+)
@@ -0,0 +1,116 @@
+// Package manifest описує маніфест завершеного завдання: запис для аудиту про те, що саме
+// і з якими params було застосовано до якого входу. Маніфест зберігається поруч з результатом
+// (Path) і віддається API через GET /job/manifest. Його пише Worker, а для завдань, які API
+// обробило само (QUEUE_FALLBACK_INLINE_MAX_BYTES), - API.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"image_common/processing"
+	"image_common/storage"
+)
+
+// Manifest - запис про виконане завдання
+type Manifest struct {
+	JobID        string `json:"job_id"`
+	Action       string `json:"action"`
+	Params       string `json:"params"`
+	Inputs       []File `json:"inputs"`
+	Outputs      []File `json:"outputs"`
+	ProcessingMs int64  `json:"processing_ms"`
+	TotalMs      int64  `json:"total_ms"`
+	// WorkerVersion - версія Worker; для завдань, оброблених в API, - "api-<версія API>"
+	WorkerVersion string    `json:"worker_version"`
+	CompletedAt   time.Time `json:"completed_at"`
+}
+
+// File - опис одного вхідного або вихідного файлу
+type File struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Format string `json:"format,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// ICCProfile - назва вбудованого ICC-профілю: кольори не-sRGB профілю можуть зміститися,
+	// якщо його не збережено (icc=keep)
+	ICCProfile string `json:"icc_profile,omitempty"`
+}
+
+// Path - шлях маніфесту завдання у сховищі результатів
+func Path(jobID string) string {
+	return filepath.Join(storage.OutputPath, jobID+"_manifest.json")
+}
+
+// DescribeFiles повертає хеші та розміри файлу або всіх файлів каталогу (входи /job/combine).
+// Файли, які не вдалося прочитати, пропускаються: маніфест не повинен зривати завдання.
+func DescribeFiles(path string) []File {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil
+		}
+		paths = paths[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	files := make([]File, 0, len(paths))
+	for _, p := range paths {
+		if f, err := describeFile(p); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func describeFile(path string) (File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return File{}, err
+	}
+	described := File{Name: filepath.Base(path), SHA256: hex.EncodeToString(hash.Sum(nil))}
+
+	// Розміри - лише із заголовка, без декодування пікселів
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		if config, format, err := image.DecodeConfig(file); err == nil {
+			described.Format, described.Width, described.Height = format, config.Width, config.Height
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		if profile, err := processing.ExtractICCProfile(file); err == nil && profile != nil {
+			described.ICCProfile = processing.ICCProfileDescription(profile)
+		}
+	}
+	return described, nil
+}
+
+// Write зберігає маніфест завдання за шляхом Path(m.JobID)
+func Write(m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(Path(m.JobID), data, 0644)
+}
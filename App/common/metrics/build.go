@@ -0,0 +1,26 @@
+package metrics
+
+import "runtime"
+
+// BuildInfoLabels - мітки метрики build_info (значення 1), за якими зміну поведінки можна
+// зіставити з розгортанням конкретної збірки
+var BuildInfoLabels = []string{"version", "commit", "build_time", "go_version"}
+
+// BuildInfo - дані збірки сервісу. Version, Commit і BuildTime задаються при збірці через
+// ldflags у пакеті main кожного сервісу (див. Dockerfile.api, Dockerfile.worker).
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo доповнює дані збірки версією Go, якою зібрано бінарний файл
+func NewBuildInfo(version, commit, buildTime string) BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+}
+
+// LabelValues повертає значення міток у порядку BuildInfoLabels
+func (b BuildInfo) LabelValues() []string {
+	return []string{b.Version, b.Commit, b.BuildTime, b.GoVersion}
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"os"
+	"strings"
+)
+
+// Namespace - префікс імен усіх метрик API та Worker (METRICS_NAMESPACE, наприклад "imgedit"
+// дає imgedit_http_requests_total). За замовчуванням порожній - імена без префікса, як раніше.
+var Namespace = strings.TrimSuffix(os.Getenv("METRICS_NAMESPACE"), "_")
+
+// Path - шлях, за яким сервіси віддають метрики (METRICS_PATH), за замовчуванням /metrics.
+var Path = metricsPath(os.Getenv("METRICS_PATH"))
+
+func metricsPath(value string) string {
+	if value == "" {
+		return "/metrics"
+	}
+	if !strings.HasPrefix(value, "/") {
+		return "/" + value
+	}
+	return value
+}
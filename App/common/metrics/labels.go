@@ -0,0 +1,30 @@
+// Package metrics містить спільні для API та Worker значення міток Prometheus і налаштування
+// метрик (префікс імен, шлях), щоб метрики обох сервісів можна було поєднувати в одних дашбордах.
+package metrics
+
+import (
+	"strings"
+
+	"image_common/processing"
+)
+
+// Значення мітки outcome - результат завдання на будь-якому етапі
+const (
+	OutcomeQueued    = "queued"    // API прийняв завдання і поставив його в чергу
+	OutcomeRejected  = "rejected"  // API відхилив завдання (невірні params, переповнена черга тощо)
+	OutcomeCompleted = "completed" // Worker успішно обробив завдання
+	OutcomeFailed    = "failed"    // Worker завершив завдання з помилкою
+)
+
+// ActionUnknown - значення мітки action для назв, яких немає в реєстрі дій
+const ActionUnknown = "unknown"
+
+// ActionLabel повертає значення мітки action: назву дії з реєстру в нижньому регістрі
+// або ActionUnknown, щоб довільні рядки від клієнтів не роздували кількість часових рядів.
+func ActionLabel(action string) string {
+	name := strings.ToLower(action)
+	if _, ok := processing.Lookup(name); !ok {
+		return ActionUnknown
+	}
+	return name
+}
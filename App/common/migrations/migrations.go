@@ -0,0 +1,125 @@
+// Package migrations застосовує впорядковані SQL-міграції схеми бази даних, спільні для API та Worker.
+// Кожна міграція - файл sql/NNN_назва.sql; номер NNN задає порядок і записується в таблицю
+// schema_version після успішного застосування. Нова зміна схеми додається новим файлом,
+// вже застосовані файли не змінюються.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// advisoryLockKey - ключ pg_advisory_lock, щоб API і Worker не застосовували міграції одночасно
+const advisoryLockKey = 7340442
+
+// Migration - одна міграція схеми.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load повертає всі вбудовані міграції, впорядковані за версією.
+func Load() ([]Migration, error) {
+	entries, err := files.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	seen := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name '%s': expected NNN_name.sql", entry.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, name)
+		}
+		seen[version] = name
+
+		body, err := files.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Run застосовує всі міграції, новіші за записану в schema_version версію. Кожна міграція
+// виконується у власній транзакції разом із записом її версії, тому збій посередині
+// не залишає схему в проміжному стані. Виклик безпечний з кількох сервісів одночасно.
+func Run(ctx context.Context, conn *pgx.Conn) error {
+	migrations, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	createVersionTable := `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);`
+	if _, err := conn.Exec(ctx, createVersionTable); err != nil {
+		return fmt.Errorf("failed to create 'schema_version' table: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := apply(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+		log.Printf("Applied schema migration %s.", m.Name)
+		current = m.Version
+	}
+
+	log.Printf("Database schema is at version %d.", current)
+	return nil
+}
+
+// apply виконує одну міграцію та записує її версію в одній транзакції.
+func apply(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Без аргументів pgx використовує простий протокол, тож файл може містити кілька інструкцій
+	if _, err := tx.Exec(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_version (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
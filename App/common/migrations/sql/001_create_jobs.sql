@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    status VARCHAR(20) NOT NULL,
+    input_path VARCHAR(255) NOT NULL,
+    output_path VARCHAR(255) NULL,
+    action VARCHAR(50) NOT NULL,
+    params VARCHAR(255) NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
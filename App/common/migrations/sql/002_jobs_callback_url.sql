@@ -0,0 +1,2 @@
+-- Адреса зворотного виклику після завершення завдання
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS callback_url VARCHAR(2048) NULL;
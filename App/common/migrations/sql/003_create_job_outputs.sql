@@ -0,0 +1,7 @@
+-- Іменовані результати дій з кількома вихідними файлами
+CREATE TABLE IF NOT EXISTS job_outputs (
+    job_id UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    output_path VARCHAR(255) NOT NULL,
+    PRIMARY KEY (job_id, name)
+);
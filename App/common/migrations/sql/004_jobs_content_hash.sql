@@ -0,0 +1,3 @@
+-- SHA-256 вмісту завантаження для повторного використання однакових файлів
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS content_hash CHAR(64) NULL;
+CREATE INDEX IF NOT EXISTS jobs_content_hash_idx ON jobs (content_hash);
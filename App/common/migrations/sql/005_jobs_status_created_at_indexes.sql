@@ -0,0 +1,4 @@
+-- Вибірки за статусом з сортуванням за часом створення та сканування за часом.
+-- Складений (status, created_at) покриває і фільтр лише за status.
+CREATE INDEX IF NOT EXISTS jobs_status_created_at_idx ON jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS jobs_created_at_idx ON jobs (created_at);
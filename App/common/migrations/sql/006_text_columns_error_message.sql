@@ -0,0 +1,11 @@
+-- Шляхи та params можуть перевищувати 255 символів (шардовані шляхи, сховища об'єктів)
+ALTER TABLE jobs ALTER COLUMN input_path TYPE TEXT;
+ALTER TABLE jobs ALTER COLUMN output_path TYPE TEXT;
+ALTER TABLE jobs ALTER COLUMN action TYPE TEXT;
+ALTER TABLE jobs ALTER COLUMN params TYPE TEXT;
+ALTER TABLE job_outputs ALTER COLUMN output_path TYPE TEXT;
+
+-- Повідомлення про помилку FAILED-завдання окремо від output_path
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS error_message TEXT NULL;
+UPDATE jobs SET error_message = output_path, output_path = NULL
+    WHERE status = 'FAILED' AND error_message IS NULL;
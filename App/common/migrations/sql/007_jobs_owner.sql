@@ -0,0 +1,3 @@
+-- Власник завдання (ідентифікатор від автентифікуючого проксі) для видалення всіх даних користувача
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS owner TEXT NULL;
+CREATE INDEX IF NOT EXISTS jobs_owner_idx ON jobs (owner);
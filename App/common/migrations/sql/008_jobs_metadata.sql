@@ -0,0 +1,3 @@
+-- Довільні мітки завдання від клієнта (система-джерело, кампанія тощо) для фільтрації в GET /jobs
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS metadata JSONB NULL;
+CREATE INDEX IF NOT EXISTS jobs_metadata_idx ON jobs USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,2 @@
+-- Формат основного результату (jpeg, png, ...); для format=smart - обраний Worker за вмістом
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS output_format TEXT NULL;
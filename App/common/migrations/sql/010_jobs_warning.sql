@@ -0,0 +1,2 @@
+-- Попередження обробки завершеного завдання (наприклад, оброблено лише перший кадр анімації)
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS warning TEXT NULL;
@@ -0,0 +1,5 @@
+-- Outbox: FALSE - завдання записане, але повідомлення ще не додане в чергу Redis. Такі завдання
+-- періодично ставить у чергу Worker (якщо API зупинився між INSERT і XADD).
+-- Наявні завдання вважаються вже поставленими.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS enqueued BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX IF NOT EXISTS jobs_not_enqueued_idx ON jobs (created_at) WHERE NOT enqueued;
@@ -0,0 +1,3 @@
+-- Фактичні розміри основного результату в пікселях (наприклад, після округлення resize)
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS output_width INTEGER NULL;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS output_height INTEGER NULL;
@@ -0,0 +1,4 @@
+-- Вхідний файл завдання FAILED зберігається для повторення через /admin/requeue до input_expires_at,
+-- після чого його видаляє Worker. NULL - термін не задано (завдання не FAILED або файл уже видалено).
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS input_expires_at TIMESTAMP WITH TIME ZONE NULL;
+CREATE INDEX IF NOT EXISTS jobs_input_expires_at_idx ON jobs (input_expires_at) WHERE input_expires_at IS NOT NULL;
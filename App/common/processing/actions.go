@@ -0,0 +1,472 @@
+package processing
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// grayscaleModes - способи обчислення сірого з RGB для params "mode=..." дії grayscale
+// (значення каналів 16-бітні, як їх повертає color.Color.RGBA)
+var grayscaleModes = map[string]func(r, g, b uint32) uint16{
+	"average": func(r, g, b uint32) uint16 { return uint16((r + g + b) / 3) },
+	"red":     func(r, _, _ uint32) uint16 { return uint16(r) },
+	"green":   func(_, g, _ uint32) uint16 { return uint16(g) },
+	"blue":    func(_, _, b uint32) uint16 { return uint16(b) },
+}
+
+// parseGrayscaleParams повертає режим з params "mode=luma|average|red|green|blue" (за замовчуванням luma).
+func parseGrayscaleParams(params string) (string, error) {
+	values, err := parseKeyValueParams(params, "mode")
+	if err != nil {
+		return "", err
+	}
+	mode, ok := values["mode"]
+	if !ok || mode == "luma" {
+		return "luma", nil
+	}
+	if _, known := grayscaleModes[mode]; !known {
+		return "", fmt.Errorf("invalid grayscale mode '%s': expected luma, average, red, green or blue", mode)
+	}
+	return mode, nil
+}
+
+// applyGrayscale застосовує перетворення у відтінки сірого (16-бітні джерела дають Gray16).
+// Режим luma (за замовчуванням) - ваги Rec.601 з color.GrayModel; average - середнє каналів;
+// red, green, blue - один канал як сірий.
+func applyGrayscale(img image.Image, params string) (image.Image, error) {
+	mode, err := parseGrayscaleParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	var grayImg draw.Image = image.NewGray(bounds)
+	model := color.GrayModel
+	if is16Bit(img) {
+		grayImg, model = image.NewGray16(bounds), color.Gray16Model
+	}
+	convert := func(c color.Color) color.Color { return model.Convert(c) }
+	if gray, ok := grayscaleModes[mode]; ok {
+		convert = func(c color.Color) color.Color {
+			r, g, b, _ := c.RGBA()
+			return color.Gray16{Y: gray(r, g, b)}
+		}
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			grayImg.Set(x, y, convert(img.At(x, y)))
+		}
+	}
+	return grayImg, nil
+}
+
+// applyConvert залишає пікселі без змін: дія лише перекодовує зображення у формат
+// з параметрів кодування (наприклад, "format=png" чи "quality=80").
+func applyConvert(img image.Image, _ string) (image.Image, error) {
+	return img, nil
+}
+
+// resizeParams - розібрані параметри дії resize
+type resizeParams struct {
+	Width, Height uint
+	// Bound - "max" (лише зменшити, щоб вписатися у WxH) або "min" (лише збільшити, щоб покрити WxH)
+	// зі збереженням пропорцій; порожньо - точний розмір WxH
+	Bound string
+	// Pad - вписати зображення зі збереженням пропорцій і доповнити полями кольору Background
+	Pad        bool
+	Background color.NRGBA
+	// OnlyShrink - не збільшувати зображення, менші за цільовий розмір
+	OnlyShrink bool
+	// Linear - масштабувати в лінійному світлі замість гамма-кодованого sRGB (linear=true)
+	Linear bool
+	// Round - округлення обчисленої сторони при збереженні пропорцій (round=nearest|up|down):
+	// up і down дають передбачуваний розмір, наприклад для тайлів, що складаються без швів
+	Round string
+}
+
+// Режими округлення обчисленої сторони resize
+const (
+	roundNearest = "nearest"
+	roundUp      = "up"
+	roundDown    = "down"
+)
+
+// scaledSide масштабує сторону side з округленням за режимом round
+func scaledSide(side int, scale float64, round string) uint {
+	v := float64(side) * scale
+	// Похибка множення не повинна зсувати точний результат на піксель при up чи down
+	if r := math.Round(v); math.Abs(v-r) < 1e-9 {
+		v = r
+	}
+	switch round {
+	case roundUp:
+		v = math.Ceil(v)
+	case roundDown:
+		v = math.Floor(v)
+	default:
+		v = math.Round(v)
+	}
+	return max(1, uint(v))
+}
+
+// fastResizeMaxPixels - найбільша площа результату resize (у пікселях), для якої замість Lanczos3
+// використовується швидша білінійна інтерполяція; 0 вимикає швидкий шлях
+var fastResizeMaxPixels uint = 128 * 128
+
+// SetFastResizeThreshold задає поріг площі мініатюри для швидкого шляху resize
+// (змінна FAST_RESIZE_MAX_PIXELS); 0 - завжди Lanczos3.
+func SetFastResizeThreshold(maxPixels uint) {
+	fastResizeMaxPixels = maxPixels
+}
+
+// resizeInterpolation вибирає інтерполяцію за розміром результату: на крихітних мініатюрах
+// різниця між Lanczos3 і білінійною непомітна, а білінійна в кілька разів дешевша.
+func resizeInterpolation(width, height uint) resize.InterpolationFunction {
+	if width*height <= fastResizeMaxPixels {
+		debugf("resize: fast path (bilinear) for %dx%d target", width, height)
+		return resize.Bilinear
+	}
+	return resize.Lanczos3
+}
+
+// Thumbnail зменшує зображення так, щоб довша сторона не перевищувала maxSide (зі збереженням
+// пропорцій); менші зображення повертаються без змін. Використовується для швидких превʼю,
+// тому завжди з білінійною інтерполяцією.
+func Thumbnail(img image.Image, maxSide uint) image.Image {
+	b := img.Bounds()
+	if uint(b.Dx()) <= maxSide && uint(b.Dy()) <= maxSide {
+		return img
+	}
+	return resize.Thumbnail(maxSide, maxSide, img, resize.Bilinear)
+}
+
+// parseResizeParams розбирає params у форматі "[max:|min:]widthxheight [pad [#RRGGBB]] [only-shrink]"
+// або "N max".
+func parseResizeParams(params string) (resizeParams, error) {
+	fields := strings.Fields(params)
+	if len(fields) == 0 {
+		return resizeParams{}, fmt.Errorf("invalid resize parameters: expected 'widthxheight' or 'widthxheight pad #RRGGBB'")
+	}
+
+	p := resizeParams{Round: roundNearest}
+	// linear=true|false і round=nearest|up|down можуть стояти будь-де після розміру
+	kept := fields[:1]
+	for _, field := range fields[1:] {
+		if value, ok := strings.CutPrefix(field, "round="); ok {
+			if value != roundNearest && value != roundUp && value != roundDown {
+				return resizeParams{}, fmt.Errorf("invalid round '%s': expected nearest, up or down", value)
+			}
+			p.Round = value
+			continue
+		}
+		value, ok := strings.CutPrefix(field, "linear=")
+		if !ok {
+			kept = append(kept, field)
+			continue
+		}
+		linear, err := strconv.ParseBool(value)
+		if err != nil {
+			return resizeParams{}, fmt.Errorf("invalid linear '%s': expected true or false", value)
+		}
+		p.Linear = linear
+	}
+	fields = kept
+
+	size := fields[0]
+	// "N max" - довша сторона не більше N, без збільшення (те саме, що "max:NxN")
+	if len(fields) == 2 && fields[1] == "max" {
+		if _, err := strconv.ParseUint(size, 10, 32); err == nil {
+			fields, size = fields[:1], "max:"+size+"x"+size
+		}
+	}
+	if bound, rest, found := strings.Cut(size, ":"); found {
+		if bound != "max" && bound != "min" {
+			return resizeParams{}, fmt.Errorf("invalid resize bound '%s': expected 'max:' or 'min:'", bound)
+		}
+		p.Bound, size = bound, rest
+	}
+
+	parts := strings.Split(size, "x")
+	if len(parts) != 2 {
+		return resizeParams{}, fmt.Errorf("invalid resize parameters: expected 'widthxheight'")
+	}
+	width, errW := strconv.ParseUint(parts[0], 10, 32)
+	height, errH := strconv.ParseUint(parts[1], 10, 32)
+	if errW != nil || errH != nil || width == 0 || height == 0 {
+		return resizeParams{}, fmt.Errorf("invalid width or height value in resize parameters or value is zero")
+	}
+	p.Width, p.Height, p.Background = uint(width), uint(height), color.NRGBA{A: 0xff}
+
+	rest := fields[1:]
+	if len(rest) > 0 && rest[len(rest)-1] == "only-shrink" {
+		p.OnlyShrink = true
+		rest = rest[:len(rest)-1]
+	}
+	if len(rest) > 0 {
+		if rest[0] != "pad" || len(rest) > 2 {
+			return resizeParams{}, fmt.Errorf("invalid resize mode '%s': expected 'pad' or 'only-shrink'", strings.Join(rest, " "))
+		}
+		if p.Bound != "" {
+			return resizeParams{}, fmt.Errorf("invalid resize parameters: 'pad' cannot be combined with '%s:'", p.Bound)
+		}
+		p.Pad = true
+		if len(rest) == 2 {
+			var err error
+			if p.Background, err = parseHexColor(rest[1]); err != nil {
+				return resizeParams{}, err
+			}
+		}
+	}
+	if p.OnlyShrink && p.Bound == "min" {
+		return resizeParams{}, fmt.Errorf("invalid resize parameters: 'min:' only enlarges images and cannot be combined with 'only-shrink'")
+	}
+	return p, nil
+}
+
+// applyResize змінює розмір зображення. Params очікується у форматі "widthxheight";
+// з " pad #RRGGBB" зображення вписується в розмір без спотворення, а вільне місце
+// (зверху і знизу або ліворуч і праворуч) заповнюється кольором, за замовчуванням чорним.
+// "max:WxH" лише зменшує зображення, щоб воно вписалося у WxH ("N max" - те саме для NxN),
+// "min:WxH" лише збільшує, щоб воно покрило WxH (обидва зберігають пропорції);
+// " only-shrink" не збільшує малі зображення, " linear=true" масштабує в лінійному світлі,
+// " round=up|down" задає округлення сторони, обчисленої за пропорціями (за замовчуванням nearest).
+// Зображення, які не треба змінювати, повертаються без змін.
+func applyResize(img image.Image, params string) (image.Image, error) {
+	p, err := parseResizeParams(params)
+	if err != nil {
+		return nil, err
+	}
+	resizeFn := resize.Resize
+	if p.Linear {
+		resizeFn = resizeLinear
+	}
+
+	src := img.Bounds()
+	if p.Bound != "" {
+		scale := math.Min(float64(p.Width)/float64(src.Dx()), float64(p.Height)/float64(src.Dy()))
+		if p.Bound == "min" {
+			scale = math.Max(float64(p.Width)/float64(src.Dx()), float64(p.Height)/float64(src.Dy()))
+		}
+		if (p.Bound == "max" && scale >= 1) || (p.Bound == "min" && scale <= 1) {
+			return img, nil
+		}
+		w, h := scaledSide(src.Dx(), scale, p.Round), scaledSide(src.Dy(), scale, p.Round)
+		// Округлення не повинно виводити результат за межу: max: - не більше WxH, min: - не менше
+		if p.Bound == "max" {
+			w, h = min(w, p.Width), min(h, p.Height)
+		} else {
+			w, h = max(w, p.Width), max(h, p.Height)
+		}
+		debugf("resize: %dx%d -> %dx%d (%s:%dx%d, round=%s)", src.Dx(), src.Dy(), w, h, p.Bound, p.Width, p.Height, p.Round)
+		return resizeFn(w, h, img, resizeInterpolation(w, h)), nil
+	}
+
+	if !p.Pad {
+		if p.OnlyShrink && uint(src.Dx()) <= p.Width && uint(src.Dy()) <= p.Height {
+			return img, nil
+		}
+		return resizeFn(p.Width, p.Height, img, resizeInterpolation(p.Width, p.Height)), nil
+	}
+
+	// Масштаб за стороною, що впирається в межі; на відміну від resize.Thumbnail
+	// менші зображення теж збільшуються до розміру (крім only-shrink - тоді лише поля)
+	scale := math.Min(float64(p.Width)/float64(src.Dx()), float64(p.Height)/float64(src.Dy()))
+	if p.OnlyShrink {
+		scale = math.Min(scale, 1)
+	}
+	fitW, fitH := scaledSide(src.Dx(), scale, p.Round), scaledSide(src.Dy(), scale, p.Round)
+	fitW, fitH = min(fitW, p.Width), min(fitH, p.Height)
+	debugf("resize: %dx%d fitted to %dx%d inside %dx%d (round=%s)", src.Dx(), src.Dy(), fitW, fitH, p.Width, p.Height, p.Round)
+	fitted := resizeFn(fitW, fitH, img, resizeInterpolation(fitW, fitH))
+	fb := fitted.Bounds()
+
+	rect := image.Rect(0, 0, int(p.Width), int(p.Height))
+	canvas := newCanvas(img, rect)
+	draw.Draw(canvas, rect, &image.Uniform{C: p.Background}, image.Point{}, draw.Src)
+
+	offset := image.Pt((rect.Dx()-fb.Dx())/2, (rect.Dy()-fb.Dy())/2)
+	draw.Draw(canvas, fb.Sub(fb.Min).Add(offset), fitted, fb.Min, draw.Over)
+	return canvas, nil
+}
+
+// parseCropParams розбирає params у форматі "startX,startY,endX,endY" (без перевірки меж зображення).
+func parseCropParams(params string) (image.Rectangle, error) {
+	parts := strings.Split(params, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop parameters: expected 'startX,startY,endX,endY'")
+	}
+
+	coords := make([]int, 4)
+	for i, part := range parts {
+		val, err := strconv.Atoi(part)
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid coordinate value in crop parameters: %s", part)
+		}
+		coords[i] = val
+	}
+	start_x, start_y, end_x, end_y := coords[0], coords[1], coords[2], coords[3]
+
+	if start_x >= end_x || start_y >= end_y || start_x < 0 || start_y < 0 {
+		return image.Rectangle{}, fmt.Errorf("crop coordinates are invalid: expected startX < endX, startY < endY and non-negative values")
+	}
+	return image.Rect(start_x, start_y, end_x, end_y), nil
+}
+
+// applyCrop обрізає зображення. Params очікується у форматі "startX,startY,endX,endY".
+func applyCrop(img image.Image, params string) (image.Image, error) {
+	area, err := parseCropParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if area.Max.X > bounds.Max.X || area.Max.Y > bounds.Max.Y {
+		return nil, fmt.Errorf("crop coordinates are out of bounds or invalid: bounds are %s", bounds)
+	}
+
+	return cropRect(img, area), nil
+}
+
+// parseCropResizeParams розбирає params у форматі "startX,startY,endX,endY;<params resize>".
+func parseCropResizeParams(params string) (image.Rectangle, string, error) {
+	cropPart, resizePart, found := strings.Cut(params, ";")
+	if !found {
+		return image.Rectangle{}, "", fmt.Errorf("invalid cropresize parameters: expected 'startX,startY,endX,endY;widthxheight'")
+	}
+	area, err := parseCropParams(cropPart)
+	if err != nil {
+		return image.Rectangle{}, "", err
+	}
+	if _, err := parseResizeParams(resizePart); err != nil {
+		return image.Rectangle{}, "", err
+	}
+	return area, resizePart, nil
+}
+
+// applyCropResize обрізає зображення і змінює розмір обрізаної області за один прохід:
+// область не копіюється, а масштабується прямо з джерела. Друга частина params підтримує
+// всі режими resize (pad, max:, only-shrink тощо).
+func applyCropResize(img image.Image, params string) (image.Image, error) {
+	area, resizePart, err := parseCropResizeParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if area.Max.X > bounds.Max.X || area.Max.Y > bounds.Max.Y {
+		return nil, fmt.Errorf("crop coordinates are out of bounds or invalid: bounds are %s", bounds)
+	}
+
+	var region image.Image
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		region = sub.SubImage(area)
+	} else {
+		region = cropRect(img, area)
+	}
+	return applyResize(region, resizePart)
+}
+
+// cropRect копіює прямокутну область зображення у нове полотно з початком у (0,0)
+// (16-бітне для 16-бітних джерел, див. newCanvas).
+func cropRect(img image.Image, area image.Rectangle) image.Image {
+	rect := image.Rect(0, 0, area.Dx(), area.Dy())
+	croppedImg := newCanvas(img, rect)
+	draw.Draw(croppedImg, rect, img, area.Min, draw.Src)
+	return croppedImg
+}
+
+// is16Bit повідомляє, чи має зображення 16 бітів на канал (наприклад, наукові PNG/TIFF).
+func is16Bit(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// newCanvas створює полотно для результату дії: RGBA64 для 16-бітних джерел, щоб не втрачати
+// точність, і RGBA для решти. До 8 бітів результат зводиться лише при кодуванні у JPEG/WebP.
+func newCanvas(src image.Image, rect image.Rectangle) draw.Image {
+	if is16Bit(src) {
+		return image.NewRGBA64(rect)
+	}
+	return image.NewRGBA(rect)
+}
+
+// cropRegion описує одну іменовану область для multicrop.
+type cropRegion struct {
+	Name string `json:"name"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	W    int    `json:"w"`
+	H    int    `json:"h"`
+}
+
+// regionNamePattern обмежує імена областей символами, безпечними для імені файлу.
+var regionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// parseMultiCropParams розбирає JSON-масив областей і перевіряє імена та розміри (без меж зображення).
+func parseMultiCropParams(params string) ([]cropRegion, error) {
+	var regions []cropRegion
+	if err := json.Unmarshal([]byte(params), &regions); err != nil {
+		return nil, fmt.Errorf("invalid multicrop parameters: expected JSON array of {name,x,y,w,h}: %v", err)
+	}
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("invalid multicrop parameters: at least one region is required")
+	}
+	// Ліміт перевіряється вже при створенні завдання, до виділення пам'яті під області
+	if err := checkOutputCount(len(regions)); err != nil {
+		return nil, fmt.Errorf("invalid multicrop parameters: %v", err)
+	}
+
+	seen := make(map[string]bool, len(regions))
+	for i, region := range regions {
+		if !regionNamePattern.MatchString(region.Name) {
+			return nil, fmt.Errorf("region %d: name must be 1-64 characters of letters, digits, '_' or '-'", i)
+		}
+		if seen[region.Name] {
+			return nil, fmt.Errorf("region %d: duplicate region name '%s'", i, region.Name)
+		}
+		seen[region.Name] = true
+
+		if region.W <= 0 || region.H <= 0 || region.X < 0 || region.Y < 0 {
+			return nil, fmt.Errorf("region '%s': width and height must be positive and x, y non-negative", region.Name)
+		}
+	}
+	return regions, nil
+}
+
+// applyMultiCrop вирізає кілька іменованих областей. Params очікується як JSON-масив
+// [{"name":"head","x":0,"y":0,"w":64,"h":64}, ...].
+func applyMultiCrop(img image.Image, params string) ([]NamedImage, error) {
+	regions, err := parseMultiCropParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	results := make([]NamedImage, 0, len(regions))
+
+	for _, region := range regions {
+		area := image.Rect(region.X, region.Y, region.X+region.W, region.Y+region.H).Add(bounds.Min)
+		if !area.In(bounds) {
+			return nil, fmt.Errorf("region '%s' is out of bounds: bounds are %s", region.Name, bounds)
+		}
+
+		results = append(results, NamedImage{Name: region.Name, Image: cropRect(img, area)})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,56 @@
+package processing
+
+import (
+	"fmt"
+	"io"
+)
+
+// Політики обробки анімованого входу дією, яка працює з одним кадром (ANIMATED_INPUT_POLICY)
+const (
+	// AnimationFirstFrame - обробляється перший кадр, у завданні записується попередження
+	AnimationFirstFrame = "first_frame"
+	// AnimationReject - завдання завершується помилкою з підказкою
+	AnimationReject = "reject"
+)
+
+// ParseAnimationPolicy перевіряє значення ANIMATED_INPUT_POLICY (порожнє - first_frame)
+func ParseAnimationPolicy(v string) (string, error) {
+	switch v {
+	case "", AnimationFirstFrame:
+		return AnimationFirstFrame, nil
+	case AnimationReject:
+		return AnimationReject, nil
+	}
+	return "", fmt.Errorf("unknown policy '%s' (expected %s or %s)", v, AnimationFirstFrame, AnimationReject)
+}
+
+// GIFFrameCount повертає кількість кадрів GIF; більше одного - анімація.
+// Кадри лише перелічуються за структурою файлу, пікселі не декодуються.
+func GIFFrameCount(r io.Reader) (int, error) {
+	s, err := newGIFStream(r)
+	if err != nil {
+		return 0, WrapDecodeError(err)
+	}
+	frames := 0
+	for {
+		frame, err := s.next(false)
+		if err != nil {
+			return 0, WrapDecodeError(err)
+		}
+		if frame == nil {
+			return frames, nil
+		}
+		frames++
+	}
+}
+
+// AnimatedInputError - помилка для анімованого входу дії, що не підтримує анімацію
+func AnimatedInputError(action string, frames int) error {
+	return fmt.Errorf("input is an animated GIF with %d frames, but action '%s' processes a single frame; "+
+		"use an action that supports animation or submit a static image", frames, action)
+}
+
+// FirstFrameWarning - попередження завдання, для якого оброблено лише перший кадр анімації
+func FirstFrameWarning(frames int) string {
+	return fmt.Sprintf("input is an animated GIF with %d frames: only the first frame was processed", frames)
+}
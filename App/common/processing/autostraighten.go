@@ -0,0 +1,189 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// straightenDefaultMaxAngle - діапазон пошуку нахилу (±градусів), якщо params порожні
+	straightenDefaultMaxAngle = 15.0
+	// straightenAngleStep - крок перебору кутів у перетворенні Хафа (градусів)
+	straightenAngleStep = 0.25
+	// straightenProxySize - максимальна сторона зменшеної копії, на якій шукається кут
+	straightenProxySize = 400
+	// straightenEdgeThreshold - мінімальна величина градієнта Собеля для пікселя-краю
+	straightenEdgeThreshold = 120
+	// straightenMinAngle - кути, менші за цей, не варто виправляти
+	straightenMinAngle = 0.05
+)
+
+// applyAutoStraighten вирівнює зображення за домінантною майже горизонтальною лінією
+// (край документа, горизонт). Params - необов'язковий максимальний кут пошуку у градусах.
+// Якщо домінантної лінії не знайдено, зображення повертається без змін.
+func applyAutoStraighten(img image.Image, params string) (image.Image, error) {
+	maxAngle, err := parseStraightenParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	angle, found := detectDominantAngle(img, maxAngle)
+	if !found {
+		log.Printf("autostraighten: no dominant line found within ±%.1f degrees, image left unchanged", maxAngle)
+		return img, nil
+	}
+	if math.Abs(angle) < straightenMinAngle {
+		log.Printf("autostraighten: image is already level (%.2f degrees)", angle)
+		return img, nil
+	}
+
+	log.Printf("autostraighten: dominant line at %.2f degrees, rotating to level", angle)
+	return rotateImage(img, -angle), nil
+}
+
+// parseStraightenParams повертає максимальний кут пошуку з params (за замовчуванням straightenDefaultMaxAngle).
+func parseStraightenParams(params string) (float64, error) {
+	if params == "" {
+		return straightenDefaultMaxAngle, nil
+	}
+	v, err := strconv.ParseFloat(params, 64)
+	if err != nil || v <= 0 || v > 45 {
+		return 0, fmt.Errorf("invalid autostraighten parameters: expected max angle in degrees (0-45)")
+	}
+	return v, nil
+}
+
+// detectDominantAngle шукає кут нахилу (у градусах, за годинниковою стрілкою) найсильнішої
+// майже горизонтальної лінії: краї Собеля голосують у перетворенні Хафа в межах ±maxAngle.
+func detectDominantAngle(img image.Image, maxAngle float64) (float64, bool) {
+	// Пошук кута на зменшеній копії - результат не залежить від масштабу, а працює значно швидше
+	proxy := img
+	if b := img.Bounds(); b.Dx() > straightenProxySize || b.Dy() > straightenProxySize {
+		proxy = resize.Thumbnail(straightenProxySize, straightenProxySize, img, resize.Bilinear)
+	}
+
+	bounds := proxy.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), proxy, bounds.Min, draw.Src)
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return 0, false
+	}
+
+	// 1. Краї Собеля з переважно вертикальним градієнтом (тобто майже горизонтальні лінії)
+	type point struct{ x, y float64 }
+	var edges []point
+	px := func(x, y int) int { return int(gray.Pix[y*gray.Stride+x]) }
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := px(x+1, y-1) + 2*px(x+1, y) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x-1, y) - px(x-1, y+1)
+			gy := px(x-1, y+1) + 2*px(x, y+1) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x, y-1) - px(x+1, y-1)
+			if abs(gy) <= abs(gx) {
+				continue
+			}
+			if math.Hypot(float64(gx), float64(gy)) >= straightenEdgeThreshold {
+				edges = append(edges, point{float64(x), float64(y)})
+			}
+		}
+	}
+	if len(edges) == 0 {
+		return 0, false
+	}
+
+	// 2. Перетворення Хафа: лінія з нахилом a має нормаль (-sin a, cos a), rho = -x*sin a + y*cos a
+	nAngles := int(2*maxAngle/straightenAngleStep) + 1
+	diag := int(math.Ceil(math.Hypot(float64(w), float64(h))))
+	nRho := 2*diag + 1
+	acc := make([]int32, nAngles*nRho)
+
+	for i := 0; i < nAngles; i++ {
+		a := (-maxAngle + float64(i)*straightenAngleStep) * math.Pi / 180
+		sin, cos := math.Sincos(a)
+		row := acc[i*nRho : (i+1)*nRho]
+		for _, p := range edges {
+			rho := int(math.Round(-p.x*sin+p.y*cos)) + diag
+			row[rho]++
+		}
+	}
+
+	bestIdx, bestVotes := 0, int32(0)
+	for i, votes := range acc {
+		if votes > bestVotes {
+			bestIdx, bestVotes = i, votes
+		}
+	}
+
+	// Лінія вважається домінантною, якщо покриває хоча б чверть ширини зображення
+	if int(bestVotes) < w/4 {
+		return 0, false
+	}
+
+	return -maxAngle + float64(bestIdx/nRho)*straightenAngleStep, true
+}
+
+// rotateImage повертає зображення на кут degrees за годинниковою стрілкою навколо центру,
+// зберігаючи розмір полотна. Білінійна інтерполяція; області за межами джерела заповнюються
+// найближчими крайовими пікселями.
+func rotateImage(img image.Image, degrees float64) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(src.Bounds())
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			// Зворотне перетворення: для кожного пікселя результату шукаємо точку у джерелі
+			sx := cos*dx + sin*dy + cx
+			sy := -sin*dx + cos*dy + cy
+			dst.SetRGBA(x, y, sampleBilinear(src, sx, sy))
+		}
+	}
+	return dst
+}
+
+// sampleBilinear повертає інтерпольований колір у точці (x, y) з обмеженням координат межами зображення.
+func sampleBilinear(src *image.RGBA, x, y float64) color.RGBA {
+	maxX, maxY := float64(src.Rect.Dx()-1), float64(src.Rect.Dy()-1)
+	x = math.Max(0, math.Min(x, maxX))
+	y = math.Max(0, math.Min(y, maxY))
+
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, int(maxX)), min(y0+1, int(maxY))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	c00 := src.RGBAAt(x0, y0)
+	c10 := src.RGBAAt(x1, y0)
+	c01 := src.RGBAAt(x0, y1)
+	c11 := src.RGBAAt(x1, y1)
+
+	lerp := func(a, b, c, d uint8) uint8 {
+		top := float64(a)*(1-fx) + float64(b)*fx
+		bottom := float64(c)*(1-fx) + float64(d)*fx
+		return uint8(math.Round(top*(1-fy) + bottom*fy))
+	}
+	return color.RGBA{
+		R: lerp(c00.R, c10.R, c01.R, c11.R),
+		G: lerp(c00.G, c10.G, c01.G, c11.G),
+		B: lerp(c00.B, c10.B, c01.B, c11.B),
+		A: lerp(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+)
+
+// maxBorderWidth обмежує ширину рамки, щоб один запит не створював величезне полотно
+const maxBorderWidth = 2000
+
+// borderParams - розібрані параметри дії border
+type borderParams struct {
+	Width int
+	Color color.NRGBA
+	Inset bool
+}
+
+// parseBorderParams розбирає params у форматі "width=10,color=000000[,mode=expand|inset]".
+func parseBorderParams(params string) (borderParams, error) {
+	values, err := parseKeyValueParams(params, "width", "color", "mode")
+	if err != nil {
+		return borderParams{}, fmt.Errorf("invalid border parameters: %v", err)
+	}
+
+	width, err := strconv.Atoi(values["width"])
+	if err != nil || width <= 0 || width > maxBorderWidth {
+		return borderParams{}, fmt.Errorf("invalid border width '%s': expected integer 1-%d", values["width"], maxBorderWidth)
+	}
+
+	result := borderParams{Width: width, Color: color.NRGBA{A: 0xff}}
+	if v, ok := values["color"]; ok {
+		if result.Color, err = parseHexColor(v); err != nil {
+			return borderParams{}, err
+		}
+	}
+
+	switch values["mode"] {
+	case "", "expand":
+	case "inset":
+		result.Inset = true
+	default:
+		return borderParams{}, fmt.Errorf("invalid border mode '%s': expected expand or inset", values["mode"])
+	}
+	return result, nil
+}
+
+// applyBorder додає суцільну рамку. У режимі expand полотно збільшується на width з кожного боку,
+// у режимі inset рамка малюється всередині, поверх країв зображення.
+func applyBorder(img image.Image, params string) (image.Image, error) {
+	p, err := parseBorderParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	fill := &image.Uniform{C: p.Color}
+
+	if !p.Inset {
+		rect := image.Rect(0, 0, bounds.Dx()+2*p.Width, bounds.Dy()+2*p.Width)
+		framed := newCanvas(img, rect)
+		draw.Draw(framed, rect, fill, image.Point{}, draw.Src)
+		draw.Draw(framed, image.Rect(p.Width, p.Width, p.Width+bounds.Dx(), p.Width+bounds.Dy()), img, bounds.Min, draw.Src)
+		return framed, nil
+	}
+
+	rect := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	framed := newCanvas(img, rect)
+	draw.Draw(framed, rect, img, bounds.Min, draw.Src)
+
+	// Чотири смуги рамки; Intersect обрізає їх, якщо рамка ширша за половину зображення
+	strips := []image.Rectangle{
+		image.Rect(0, 0, rect.Dx(), p.Width),
+		image.Rect(0, rect.Dy()-p.Width, rect.Dx(), rect.Dy()),
+		image.Rect(0, 0, p.Width, rect.Dy()),
+		image.Rect(rect.Dx()-p.Width, 0, rect.Dx(), rect.Dy()),
+	}
+	for _, strip := range strips {
+		draw.Draw(framed, strip.Intersect(rect), fill, image.Point{}, draw.Src)
+	}
+	return framed, nil
+}
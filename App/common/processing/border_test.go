@@ -0,0 +1,105 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestApplyBorder(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	img := gradientImage(8, 6)
+	// Підзображення з ненульовим Min: рамка має рахуватися від його меж
+	sub := img.SubImage(image.Rect(2, 1, 8, 6))
+
+	type pixel struct {
+		x, y int
+		want color.Color // nil - піксель входу зі зсувом offset
+	}
+	tests := []struct {
+		name     string
+		input    image.Image
+		params   string
+		wantSize image.Point
+		offset   image.Point // зсув пікселів входу в результаті
+		pixels   []pixel
+	}{
+		{
+			name: "expand", input: img, params: "width=2,color=ff0000", wantSize: image.Pt(12, 10), offset: image.Pt(2, 2),
+			pixels: []pixel{{0, 0, red}, {1, 5, red}, {11, 9, red}, {10, 3, red}, {5, 1, red}, {2, 2, nil}, {9, 7, nil}, {5, 4, nil}},
+		},
+		{
+			name: "expand sub-image", input: sub, params: "width=1,color=ff0000", wantSize: image.Pt(8, 7), offset: image.Pt(1, 1),
+			pixels: []pixel{{0, 0, red}, {7, 6, red}, {1, 1, nil}, {6, 5, nil}},
+		},
+		{
+			name: "default color is black", input: img, params: "width=1", wantSize: image.Pt(10, 8), offset: image.Pt(1, 1),
+			pixels: []pixel{{0, 0, color.RGBA{0, 0, 0, 255}}, {1, 1, nil}},
+		},
+		{
+			name: "inset", input: img, params: "width=2,color=ff0000,mode=inset", wantSize: image.Pt(8, 6),
+			pixels: []pixel{{0, 0, red}, {1, 3, red}, {7, 5, red}, {6, 2, red}, {4, 4, red}, {2, 2, nil}, {5, 3, nil}},
+		},
+		{
+			name: "inset wider than half the image", input: img, params: "width=5,color=ff0000,mode=inset", wantSize: image.Pt(8, 6),
+			pixels: []pixel{{0, 0, red}, {3, 2, red}, {4, 3, red}, {7, 5, red}},
+		},
+		{
+			name: "inset sub-image", input: sub, params: "width=1,color=ff0000,mode=inset", wantSize: image.Pt(6, 5),
+			pixels: []pixel{{0, 0, red}, {5, 4, red}, {1, 1, nil}, {4, 3, nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := applyBorder(tt.input, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bounds := out.Bounds()
+			if bounds.Size() != tt.wantSize {
+				t.Fatalf("output size = %v, want %v", bounds.Size(), tt.wantSize)
+			}
+			inMin := tt.input.Bounds().Min
+			for _, p := range tt.pixels {
+				want := p.want
+				if want == nil {
+					want = tt.input.At(inMin.X+p.x-tt.offset.X, inMin.Y+p.y-tt.offset.Y)
+				}
+				if got := out.At(bounds.Min.X+p.x, bounds.Min.Y+p.y); !sameColor(got, want) {
+					t.Errorf("pixel (%d,%d) = %v, want %v", p.x, p.y, got, want)
+				}
+			}
+		})
+	}
+}
+
+// sameColor порівнює кольори незалежно від моделі (RGBA, NRGBA тощо)
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestParseBorderParams(t *testing.T) {
+	tests := []struct {
+		params  string
+		wantErr string
+	}{
+		{"width=0", "invalid border width"},
+		{"width=-3", "invalid border width"},
+		{"width=2001", "invalid border width"},
+		{"width=abc", "invalid border width"},
+		{"width=2,color=zzzzzz", "color"},
+		{"width=2,color=fff", "color"},
+		{"width=2,mode=outset", "invalid border mode"},
+		{"width=2,opacity=50", "invalid border parameters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			if _, err := parseBorderParams(tt.params); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseBorderParams(%q) = %v, want error containing %q", tt.params, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,533 @@
+package processing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// NormalizeColorSpace явно переводить CMYK-зображення (наприклад, JPEG з друкарських
+// процесів) у RGB до обробки, щоб подальші перетворення працювали з RGB-пікселями.
+//
+// Adobe (Photoshop) зберігає CMYK JPEG інвертованими (255 - без фарби); image/jpeg враховує
+// це за сегментом APP14, тож *image.CMYK вже містить кількість фарби. Якщо src містить
+// вбудований CMYK ICC-профіль з таблицею A2B0/A2B1, кольори перетворюються за ним (CMYK -> PCS
+// -> sRGB), інакше - простою формулою color.CMYKToRGB. Для інших зображень src не читається.
+func NormalizeColorSpace(img image.Image, src io.ReadSeeker) image.Image {
+	cmykImg, ok := img.(*image.CMYK)
+	if !ok {
+		return img
+	}
+
+	convert := func(c color.CMYK) color.RGBA {
+		r, g, b := color.CMYKToRGB(c.C, c.M, c.Y, c.K)
+		return color.RGBA{R: r, G: g, B: b, A: 0xff}
+	}
+	if transform := readCMYKTransform(src); transform != nil {
+		convert = transform.convert
+	}
+
+	bounds := cmykImg.Bounds()
+	rgbaImg := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgbaImg.SetRGBA(x, y, convert(cmykImg.CMYKAt(x, y)))
+		}
+	}
+	return rgbaImg
+}
+
+// readCMYKTransform читає вбудований профіль src; nil, якщо його немає або він не підтримується
+func readCMYKTransform(src io.ReadSeeker) *iccTransform {
+	if src == nil {
+		return nil
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	profile, err := ExtractICCProfile(src)
+	if err != nil || profile == nil {
+		return nil
+	}
+	transform, err := parseCMYKProfile(profile)
+	if err != nil {
+		debugf("CMYK ICC profile '%s' is not applied: %v", ICCProfileDescription(profile), err)
+		return nil
+	}
+	return transform
+}
+
+// iccColorSpace повертає колірний простір даних профілю ("RGB ", "CMYK", "GRAY") або ""
+func iccColorSpace(profile []byte) string {
+	if len(profile) < 128 {
+		return ""
+	}
+	return string(profile[16:20])
+}
+
+// iccCurve - одновимірна крива ICC (curv або para) на відрізку 0..1
+type iccCurve struct {
+	table  []float64 // curv: значення в рівномірних точках; порожня і без params - тотожна
+	gamma  float64   // curv з одним значенням
+	kind   int       // para: тип функції 0-4
+	params []float64 // para: g, a, b, c, d, e, f
+}
+
+func (c iccCurve) eval(x float64) float64 {
+	x = clamp01(x)
+	switch {
+	case c.params != nil:
+		p := c.params
+		var y float64
+		switch c.kind {
+		case 0:
+			y = math.Pow(x, p[0])
+		case 1:
+			if x >= -p[2]/p[1] {
+				y = math.Pow(p[1]*x+p[2], p[0])
+			}
+		case 2:
+			y = p[3]
+			if x >= -p[2]/p[1] {
+				y += math.Pow(p[1]*x+p[2], p[0])
+			}
+		case 3:
+			y = p[3] * x
+			if x >= p[4] {
+				y = math.Pow(p[1]*x+p[2], p[0])
+			}
+		case 4:
+			y = p[3]*x + p[6]
+			if x >= p[4] {
+				y = math.Pow(p[1]*x+p[2], p[0]) + p[5]
+			}
+		}
+		return clamp01(y)
+	case c.gamma != 0:
+		return math.Pow(x, c.gamma)
+	case len(c.table) > 1:
+		pos := x * float64(len(c.table)-1)
+		i := min(int(pos), len(c.table)-2)
+		frac := pos - float64(i)
+		return c.table[i]*(1-frac) + c.table[i+1]*frac
+	}
+	return x
+}
+
+// iccCLUT - багатовимірна таблиця кольорів з багатолінійною інтерполяцією
+type iccCLUT struct {
+	grid []int     // кількість точок по кожному входу
+	out  int       // кількість виходів
+	data []float64 // значення 0..1; перший вхід змінюється найповільніше
+}
+
+func (t iccCLUT) eval(in, out []float64) {
+	n := len(t.grid)
+	base := make([]int, n)
+	frac := make([]float64, n)
+	strides := make([]int, n)
+	stride := t.out
+	for i := n - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= t.grid[i]
+		pos := clamp01(in[i]) * float64(t.grid[i]-1)
+		base[i] = min(int(pos), max(t.grid[i]-2, 0))
+		frac[i] = pos - float64(base[i])
+	}
+	for o := range out {
+		out[o] = 0
+	}
+	// Сума вершин гіперкуба з вагами - добутками відстаней по кожному входу
+	for corner := 0; corner < 1<<n; corner++ {
+		weight, offset := 1.0, 0
+		for i := 0; i < n; i++ {
+			idx := base[i]
+			if corner&(1<<i) != 0 {
+				if t.grid[i] == 1 {
+					weight = 0
+					break
+				}
+				idx++
+				weight *= frac[i]
+			} else if t.grid[i] > 1 {
+				weight *= 1 - frac[i]
+			}
+			offset += idx * strides[i]
+		}
+		if weight == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += weight * t.data[offset+o]
+		}
+	}
+}
+
+// iccTransform - перетворення CMYK у PCS за тегом AToB профілю і далі в sRGB:
+// криві входу -> CLUT -> криві M і матриця (лише mAB) -> криві виходу
+type iccTransform struct {
+	in     []iccCurve
+	clut   iccCLUT
+	m      []iccCurve
+	matrix []float64 // 3x3 і зсув (mAB); nil - без матриці
+	out    []iccCurve
+	pcsLab bool
+	// labScale і labOffset декодують вихід 0..1 у L*a*b*: кодування mft2 (ICC v2) відрізняється від v4
+	labScale, abScale, abOffset float64
+	cache                       map[color.CMYK]color.RGBA
+}
+
+// maxCMYKCacheEntries обмежує кеш перетворених кольорів (фото мають багато різних кольорів,
+// але плашки і фон повторюються)
+const maxCMYKCacheEntries = 1 << 16
+
+func (t *iccTransform) convert(c color.CMYK) color.RGBA {
+	if rgba, ok := t.cache[c]; ok {
+		return rgba
+	}
+	in := []float64{float64(c.C) / 255, float64(c.M) / 255, float64(c.Y) / 255, float64(c.K) / 255}
+	for i, curve := range t.in {
+		in[i] = curve.eval(in[i])
+	}
+	pcs := make([]float64, 3)
+	t.clut.eval(in, pcs)
+	for i, curve := range t.m {
+		pcs[i] = curve.eval(pcs[i])
+	}
+	if t.matrix != nil {
+		m := t.matrix
+		pcs[0], pcs[1], pcs[2] = m[0]*pcs[0]+m[1]*pcs[1]+m[2]*pcs[2]+m[9],
+			m[3]*pcs[0]+m[4]*pcs[1]+m[5]*pcs[2]+m[10],
+			m[6]*pcs[0]+m[7]*pcs[1]+m[8]*pcs[2]+m[11]
+	}
+	for i, curve := range t.out {
+		pcs[i] = curve.eval(pcs[i])
+	}
+
+	var x, y, z float64
+	if t.pcsLab {
+		x, y, z = labToXYZ(pcs[0]*t.labScale, pcs[1]*t.abScale-t.abOffset, pcs[2]*t.abScale-t.abOffset)
+	} else {
+		// u1Fixed15: 1.0 кодується як 0x8000
+		x, y, z = pcs[0]*65535/32768, pcs[1]*65535/32768, pcs[2]*65535/32768
+	}
+	rgba := xyzD50ToSRGB(x, y, z)
+	if len(t.cache) < maxCMYKCacheEntries {
+		t.cache[c] = rgba
+	}
+	return rgba
+}
+
+// labToXYZ переводить CIELAB у XYZ з білою точкою D50 (PCS ICC)
+func labToXYZ(l, a, b float64) (float64, float64, float64) {
+	const (
+		whiteX, whiteY, whiteZ = 0.9642, 1.0, 0.8249
+		epsilon                = 216.0 / 24389
+		kappa                  = 24389.0 / 27
+	)
+	fy := (l + 16) / 116
+	fx, fz := fy+a/500, fy-b/200
+	inverse := func(f float64) float64 {
+		if f3 := f * f * f; f3 > epsilon {
+			return f3
+		}
+		return (116*f - 16) / kappa
+	}
+	return inverse(fx) * whiteX, inverse(fy) * whiteY, inverse(fz) * whiteZ
+}
+
+// xyzD50ToSRGB переводить XYZ (D50) у 8-бітний sRGB (адаптація Бредфорда до D65)
+func xyzD50ToSRGB(x, y, z float64) color.RGBA {
+	r := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	g := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	b := 0.0719453*x - 0.2289914*y + 1.4052427*z
+	encode := func(v float64) uint8 {
+		v = clamp01(v)
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return color.RGBA{R: encode(r), G: encode(g), B: encode(b), A: 0xff}
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// parseCMYKProfile будує перетворення з CMYK ICC-профілю (тег A2B0, інакше A2B1)
+func parseCMYKProfile(profile []byte) (*iccTransform, error) {
+	if iccColorSpace(profile) != "CMYK" {
+		return nil, fmt.Errorf("profile color space is '%s', not CMYK", iccColorSpace(profile))
+	}
+	pcs := string(profile[20:24])
+	if pcs != "Lab " && pcs != "XYZ " {
+		return nil, fmt.Errorf("unsupported profile connection space '%s'", pcs)
+	}
+
+	tag := iccTag(profile, "A2B0")
+	if tag == nil {
+		tag = iccTag(profile, "A2B1")
+	}
+	if tag == nil {
+		return nil, errors.New("profile has no AToB table")
+	}
+
+	var (
+		t   *iccTransform
+		err error
+	)
+	switch string(tag[:4]) {
+	case "mft1":
+		t, err = parseLegacyLUT(tag, 1)
+		t.labScale, t.abScale, t.abOffset = 100, 255, 128
+	case "mft2":
+		t, err = parseLegacyLUT(tag, 2)
+		// Кодування Lab ICC v2: L* 100 = 0xFF00, a* 0 = 0x8000
+		t.labScale, t.abScale, t.abOffset = 100*65535.0/65280, 65535.0/256, 128
+	case "mAB ":
+		t, err = parseLUTAToB(tag)
+		t.labScale, t.abScale, t.abOffset = 100, 255, 128
+	default:
+		return nil, fmt.Errorf("unsupported AToB tag type '%s'", tag[:4])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(t.clut.grid) != 4 || t.clut.out != 3 {
+		return nil, fmt.Errorf("AToB table maps %d channels to %d, expected 4 to 3", len(t.clut.grid), t.clut.out)
+	}
+	t.pcsLab = pcs == "Lab "
+	t.cache = make(map[color.CMYK]color.RGBA)
+	return t, nil
+}
+
+// iccTag повертає дані тегу sig або nil
+func iccTag(profile []byte, sig string) []byte {
+	const headerSize = 128
+	if len(profile) < headerSize+4 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint32(profile[headerSize:]))
+	for i := 0; i < count; i++ {
+		entry := headerSize + 4 + i*12
+		if entry+12 > len(profile) {
+			return nil
+		}
+		if string(profile[entry:entry+4]) != sig {
+			continue
+		}
+		offset := int64(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int64(binary.BigEndian.Uint32(profile[entry+8:]))
+		if size < 12 || offset+size > int64(len(profile)) {
+			return nil
+		}
+		return profile[offset : offset+size]
+	}
+	return nil
+}
+
+// errICCTruncated - таблиця профілю коротша, ніж заявлено в її заголовку
+var errICCTruncated = errors.New("ICC table is truncated")
+
+// readICCValues читає n беззнакових значень розміром width байт (1 або 2), нормалізованих до 0..1
+func readICCValues(data []byte, offset, n, width int) ([]float64, error) {
+	if offset < 0 || n < 0 || offset+n*width > len(data) {
+		return nil, errICCTruncated
+	}
+	values := make([]float64, n)
+	for i := range values {
+		if width == 1 {
+			values[i] = float64(data[offset+i]) / 255
+		} else {
+			values[i] = float64(binary.BigEndian.Uint16(data[offset+2*i:])) / 65535
+		}
+	}
+	return values, nil
+}
+
+// clutSize - кількість значень CLUT з перевіркою переповнення (grid до 255 точок на вхід)
+func clutSize(grid []int, out int, limit int) (int, error) {
+	size := out
+	for _, g := range grid {
+		if g < 1 {
+			return 0, errors.New("ICC table has a zero-sized grid")
+		}
+		size *= g
+		if size > limit {
+			return 0, errICCTruncated
+		}
+	}
+	return size, nil
+}
+
+// parseLegacyLUT розбирає lut8Type (mft1, width 1) і lut16Type (mft2, width 2)
+func parseLegacyLUT(tag []byte, width int) (*iccTransform, error) {
+	t := &iccTransform{}
+	if len(tag) < 52 {
+		return t, errICCTruncated
+	}
+	inCh, outCh, gridPoints := int(tag[8]), int(tag[9]), int(tag[10])
+	inEntries, outEntries, offset := 256, 256, 48
+	if width == 2 {
+		inEntries, outEntries, offset = int(binary.BigEndian.Uint16(tag[48:])), int(binary.BigEndian.Uint16(tag[50:])), 52
+	}
+	if inEntries < 2 || outEntries < 2 {
+		return t, errors.New("ICC table has fewer than two curve entries")
+	}
+
+	for range inCh {
+		table, err := readICCValues(tag, offset, inEntries, width)
+		if err != nil {
+			return t, err
+		}
+		t.in = append(t.in, iccCurve{table: table})
+		offset += inEntries * width
+	}
+
+	t.clut.grid = make([]int, inCh)
+	for i := range t.clut.grid {
+		t.clut.grid[i] = gridPoints
+	}
+	t.clut.out = outCh
+	size, err := clutSize(t.clut.grid, outCh, len(tag))
+	if err != nil {
+		return t, err
+	}
+	if t.clut.data, err = readICCValues(tag, offset, size, width); err != nil {
+		return t, err
+	}
+	offset += size * width
+
+	for range outCh {
+		table, err := readICCValues(tag, offset, outEntries, width)
+		if err != nil {
+			return t, err
+		}
+		t.out = append(t.out, iccCurve{table: table})
+		offset += outEntries * width
+	}
+	return t, nil
+}
+
+// parseLUTAToB розбирає lutAtoBType (mAB, ICC v4)
+func parseLUTAToB(tag []byte) (*iccTransform, error) {
+	t := &iccTransform{}
+	if len(tag) < 32 {
+		return t, errICCTruncated
+	}
+	inCh, outCh := int(tag[8]), int(tag[9])
+	offsetAt := func(pos int) int { return int(binary.BigEndian.Uint32(tag[pos:])) }
+	offB, offMatrix, offM, offCLUT, offA := offsetAt(12), offsetAt(16), offsetAt(20), offsetAt(24), offsetAt(28)
+
+	var err error
+	if offB == 0 {
+		return t, errors.New("AToB table has no B curves")
+	}
+	if t.out, err = parseICCCurves(tag, offB, outCh); err != nil {
+		return t, err
+	}
+	if offM != 0 {
+		if t.m, err = parseICCCurves(tag, offM, outCh); err != nil {
+			return t, err
+		}
+	}
+	if offMatrix != 0 {
+		if offMatrix < 0 || offMatrix+48 > len(tag) {
+			return t, errICCTruncated
+		}
+		t.matrix = make([]float64, 12)
+		for i := range t.matrix {
+			t.matrix[i] = float64(int32(binary.BigEndian.Uint32(tag[offMatrix+4*i:]))) / 65536
+		}
+	}
+	if offA != 0 {
+		if t.in, err = parseICCCurves(tag, offA, inCh); err != nil {
+			return t, err
+		}
+	}
+
+	if offCLUT == 0 {
+		return t, errors.New("AToB table has no CLUT")
+	}
+	if offCLUT < 0 || offCLUT+20 > len(tag) || inCh > 16 {
+		return t, errICCTruncated
+	}
+	t.clut.grid = make([]int, inCh)
+	for i := range t.clut.grid {
+		t.clut.grid[i] = int(tag[offCLUT+i])
+	}
+	t.clut.out = outCh
+	precision := int(tag[offCLUT+16])
+	if precision != 1 && precision != 2 {
+		return t, fmt.Errorf("unsupported CLUT precision %d", precision)
+	}
+	size, err := clutSize(t.clut.grid, outCh, len(tag))
+	if err != nil {
+		return t, err
+	}
+	t.clut.data, err = readICCValues(tag, offCLUT+20, size, precision)
+	return t, err
+}
+
+// parseICCCurves читає n послідовних кривих curv/para, кожна вирівняна на 4 байти
+func parseICCCurves(tag []byte, offset, n int) ([]iccCurve, error) {
+	curves := make([]iccCurve, 0, n)
+	for range n {
+		if offset < 0 || offset+12 > len(tag) {
+			return nil, errICCTruncated
+		}
+		var (
+			curve iccCurve
+			size  int
+		)
+		switch string(tag[offset : offset+4]) {
+		case "curv":
+			count := int(binary.BigEndian.Uint32(tag[offset+8:]))
+			size = 12 + 2*count
+			if count < 0 || offset+size > len(tag) {
+				return nil, errICCTruncated
+			}
+			switch count {
+			case 0:
+			case 1:
+				curve.gamma = float64(binary.BigEndian.Uint16(tag[offset+12:])) / 256
+			default:
+				table, err := readICCValues(tag, offset+12, count, 2)
+				if err != nil {
+					return nil, err
+				}
+				curve.table = table
+			}
+		case "para":
+			curve.kind = int(binary.BigEndian.Uint16(tag[offset+8:]))
+			counts := []int{1, 3, 4, 5, 7}
+			if curve.kind >= len(counts) {
+				return nil, fmt.Errorf("unsupported parametric curve type %d", curve.kind)
+			}
+			size = 12 + 4*counts[curve.kind]
+			if offset+size > len(tag) {
+				return nil, errICCTruncated
+			}
+			curve.params = make([]float64, 7)
+			for i := range counts[curve.kind] {
+				curve.params[i] = float64(int32(binary.BigEndian.Uint32(tag[offset+12+4*i:]))) / 65536
+			}
+			// Типи 1 і 2 діляться на a
+			if (curve.kind == 1 || curve.kind == 2) && curve.params[1] == 0 {
+				return nil, errors.New("parametric curve has a zero slope")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported curve type '%s'", tag[offset:offset+4])
+		}
+		curves = append(curves, curve)
+		offset += (size + 3) &^ 3
+	}
+	return curves, nil
+}
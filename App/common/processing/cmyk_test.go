@@ -0,0 +1,252 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// bitWriter пише коди Хаффмана в ентропійні дані JPEG зі вставкою 0x00 після 0xFF
+type bitWriter struct {
+	buf   bytes.Buffer
+	acc   uint32
+	nbits uint
+}
+
+func (w *bitWriter) write(bits uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | bits>>uint(i)&1
+		w.nbits++
+		if w.nbits == 8 {
+			w.buf.WriteByte(byte(w.acc))
+			if byte(w.acc) == 0xff {
+				w.buf.WriteByte(0)
+			}
+			w.acc, w.nbits = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	for w.nbits != 0 {
+		w.write(1, 1)
+	}
+	return w.buf.Bytes()
+}
+
+// jpegSegment - маркер, довжина і дані сегмента
+func jpegSegment(marker byte, body []byte) []byte {
+	return append([]byte{0xff, marker, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+}
+
+// adobeCMYKJPEG будує baseline JPEG з однотонними плашками 8x8 у кольорах inks (кількість фарби),
+// записаними так, як їх пише Photoshop: з APP14 Adobe (transform 0) та інвертованими значеннями.
+// Якщо profile не nil, він вбудовується в APP2.
+func adobeCMYKJPEG(inks []color.CMYK, profile []byte) []byte {
+	var out bytes.Buffer
+	out.Write([]byte{0xff, 0xd8})
+	out.Write(jpegSegment(0xee, []byte{'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 0}))
+	if profile != nil {
+		out.Write(jpegSegment(0xe2, append([]byte(iccJPEGSignature+"\x01\x01"), profile...)))
+	}
+
+	// Таблиця квантування з одиниць: коефіцієнт DC плашки дорівнює 8*(значення-128)
+	out.Write(jpegSegment(0xdb, append([]byte{0}, bytes.Repeat([]byte{1}, 64)...)))
+	w := 8 * len(inks)
+	sof := []byte{8, 0, 8, byte(w >> 8), byte(w), 4}
+	for c := byte(1); c <= 4; c++ {
+		sof = append(sof, c, 0x11, 0)
+	}
+	out.Write(jpegSegment(0xc0, sof))
+	// DC: категорії 0-11 кодами довжиною 4 (0000-1011); AC: лише EOB кодом 0
+	dht := []byte{0x00, 0, 0, 0, 12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	dht = append(dht, 0x10, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	out.Write(jpegSegment(0xc4, dht))
+	out.Write(jpegSegment(0xda, []byte{4, 1, 0, 2, 0, 3, 0, 4, 0, 0, 63, 0}))
+
+	var bw bitWriter
+	var prev [4]int
+	for _, ink := range inks {
+		for c, v := range []uint8{ink.C, ink.M, ink.Y, ink.K} {
+			dc := 8 * (int(255-v) - 128)
+			diff := dc - prev[c]
+			prev[c] = dc
+			size, bits := 0, diff
+			for a := max(diff, -diff); a > 0; a >>= 1 {
+				size++
+			}
+			if diff < 0 {
+				bits = diff + 1<<size - 1
+			}
+			bw.write(uint32(size), 4)
+			bw.write(uint32(bits), uint(size))
+			bw.write(0, 1) // EOB
+		}
+	}
+	out.Write(bw.flush())
+	out.Write([]byte{0xff, 0xd9})
+	return out.Bytes()
+}
+
+// flatLabProfile - CMYK ICC-профіль v2 (mft2), що переводить будь-який колір у Lab (50, 0, 0),
+// тобто в нейтральний сірий, який не збігається з результатом простої формули
+func flatLabProfile() []byte {
+	var tag bytes.Buffer
+	tag.WriteString("mft2\x00\x00\x00\x00")
+	tag.Write([]byte{4, 3, 2, 0})
+	// Одинична матриця s15Fixed16
+	for i := range 9 {
+		v := uint32(0)
+		if i%4 == 0 {
+			v = 0x10000
+		}
+		binary.Write(&tag, binary.BigEndian, v)
+	}
+	binary.Write(&tag, binary.BigEndian, [2]uint16{2, 2})
+	for range 4 {
+		binary.Write(&tag, binary.BigEndian, [2]uint16{0, 0xffff})
+	}
+	// L* 50 у кодуванні v2 - 0x7F80, a* і b* 0 - 0x8000
+	for range 16 {
+		binary.Write(&tag, binary.BigEndian, [3]uint16{0x7f80, 0x8000, 0x8000})
+	}
+	for range 3 {
+		binary.Write(&tag, binary.BigEndian, [2]uint16{0, 0xffff})
+	}
+
+	profile := make([]byte, 128, 144+tag.Len())
+	copy(profile[16:], "CMYKLab ")
+	copy(profile[36:], "acsp")
+	profile = binary.BigEndian.AppendUint32(profile, 1)
+	profile = append(profile, "A2B0"...)
+	profile = binary.BigEndian.AppendUint32(profile, 144)
+	profile = binary.BigEndian.AppendUint32(profile, uint32(tag.Len()))
+	profile = append(profile, tag.Bytes()...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func TestNormalizeColorSpaceAdobeCMYK(t *testing.T) {
+	inks := []color.CMYK{
+		{0, 0, 0, 0},       // без фарби - білий папір
+		{0, 0, 0, 255},     // чорна
+		{255, 0, 0, 0},     // блакитна
+		{0, 255, 0, 0},     // пурпурова
+		{0, 0, 255, 0},     // жовта
+		{0, 255, 255, 0},   // червона
+		{0, 0, 0, 128},     // сіра
+		{255, 255, 255, 0}, // CMY без чорної - темна
+	}
+	data := adobeCMYKJPEG(inks, nil)
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// image/jpeg сам знімає інверсію Adobe: у *image.CMYK - кількість фарби
+	cmyk, ok := decoded.(*image.CMYK)
+	if !ok {
+		t.Fatalf("decoded %T, want *image.CMYK", decoded)
+	}
+	if got := cmyk.CMYKAt(20, 4); got != inks[2] {
+		t.Fatalf("decoded ink = %v, want %v", got, inks[2])
+	}
+
+	img := NormalizeColorSpace(decoded, bytes.NewReader(data))
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		t.Fatalf("NormalizeColorSpace returned %T, want *image.RGBA", img)
+	}
+	tests := []struct {
+		name    string
+		check   func(r, g, b int) bool
+		comment string
+	}{
+		{"paper", func(r, g, b int) bool { return r > 240 && g > 240 && b > 240 }, "white"},
+		{"black", func(r, g, b int) bool { return r < 15 && g < 15 && b < 15 }, "black"},
+		{"cyan", func(r, g, b int) bool { return r < 30 && g > 200 && b > 200 }, "red low, green and blue high"},
+		{"magenta", func(r, g, b int) bool { return g < 30 && r > 200 && b > 200 }, "green low, red and blue high"},
+		{"yellow", func(r, g, b int) bool { return b < 30 && r > 200 && g > 200 }, "blue low, red and green high"},
+		{"red", func(r, g, b int) bool { return r > 200 && g < 30 && b < 30 }, "red"},
+		{"grey", func(r, g, b int) bool { return r == g && g == b && r > 100 && r < 155 }, "neutral mid grey"},
+		{"rich black", func(r, g, b int) bool { return r < 15 && g < 15 && b < 15 }, "black"},
+	}
+	for i, tt := range tests {
+		c := rgba.RGBAAt(8*i+4, 4)
+		if !tt.check(int(c.R), int(c.G), int(c.B)) {
+			t.Errorf("%s ink %v converted to %v, want %s", tt.name, inks[i], c, tt.comment)
+		}
+	}
+}
+
+func TestNormalizeColorSpaceICCProfile(t *testing.T) {
+	inks := []color.CMYK{{0, 0, 0, 0}, {255, 0, 0, 0}, {0, 0, 0, 255}}
+	data := adobeCMYKJPEG(inks, flatLabProfile())
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Усі кольори переводяться профілем у Lab (50, 0, 0) - sRGB (119, 119, 119)
+	img := NormalizeColorSpace(decoded, bytes.NewReader(data)).(*image.RGBA)
+	for i := range inks {
+		c := img.RGBAAt(8*i+4, 4)
+		if c.R < 117 || c.R > 121 || c.G != c.R || c.B != c.R {
+			t.Errorf("ink %v converted to %v, want grey 119 from the embedded profile", inks[i], c)
+		}
+	}
+
+	// Без джерела профіль недоступний - проста формула
+	plain := NormalizeColorSpace(decoded, nil).(*image.RGBA)
+	if c := plain.RGBAAt(4, 4); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("paper without profile converted to %v, want white", c)
+	}
+}
+
+func TestParseCMYKProfileRejectsBadProfiles(t *testing.T) {
+	good := flatLabProfile()
+	rgb := append([]byte(nil), good...)
+	copy(rgb[16:], "RGB ")
+	truncated := good[:len(good)-10]
+	tests := []struct {
+		name    string
+		profile []byte
+	}{
+		{"empty", nil},
+		{"rgb profile", rgb},
+		{"truncated table", truncated},
+		{"no AToB tag", good[:144]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCMYKProfile(tt.profile); err == nil {
+				t.Fatal("parseCMYKProfile accepted an unusable profile")
+			}
+		})
+	}
+}
+
+func TestEncodeSkipsCMYKProfile(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, OutputOptions{Format: "jpeg", ICCProfile: flatLabProfile()}); err != nil {
+		t.Fatal(err)
+	}
+	if profile, _ := ExtractICCProfile(bytes.NewReader(buf.Bytes())); profile != nil {
+		t.Fatal("RGB output carries the CMYK profile of the input")
+	}
+
+	metadata, err := ReadJPEGMetadata(bytes.NewReader(adobeCMYKJPEG([]color.CMYK{{}}, flatLabProfile())))
+	if err != nil || len(metadata) == 0 {
+		t.Fatalf("ReadJPEGMetadata = %d bytes, %v", len(metadata), err)
+	}
+	buf.Reset()
+	if err := Encode(&buf, img, OutputOptions{Format: "jpeg", Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+	if profile, _ := ExtractICCProfile(bytes.NewReader(buf.Bytes())); profile != nil {
+		t.Fatal("preserved metadata carries the CMYK profile of the input")
+	}
+}
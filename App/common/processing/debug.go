@@ -0,0 +1,18 @@
+package processing
+
+import "log"
+
+// debugLogging вмикає докладні повідомлення про вибір алгоритмів (LOG_LEVEL=debug)
+var debugLogging bool
+
+// SetDebug вмикає або вимикає налагоджувальні повідомлення пакета.
+func SetDebug(enabled bool) {
+	debugLogging = enabled
+}
+
+// debugf пише повідомлення в лог лише в налагоджувальному режимі
+func debugf(format string, args ...any) {
+	if debugLogging {
+		log.Printf("DEBUG: "+format, args...)
+	}
+}
@@ -0,0 +1,139 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// maxDPI - найбільша роздільність, яку можна записати в JFIF (16-бітні поля густини)
+const maxDPI = 65535
+
+// Теги TIFF для роздільності (RATIONAL) та її одиниць (SHORT, 2 - дюйми)
+const (
+	tiffTagXResolution    = 282
+	tiffTagYResolution    = 283
+	tiffTagResolutionUnit = 296
+	tiffTypeShort         = 3
+	tiffTypeRational      = 5
+	tiffUnitInch          = 2
+)
+
+// setDensity записує роздільність dpi у метадані вже закодованого файлу: сегмент JFIF APP0 для JPEG,
+// чанк pHYs для PNG і теги XResolution/YResolution для TIFF. Стандартні кодувальники цього не вміють
+// (image/jpeg не пише JFIF, x/image/tiff завжди пише 72 dpi), тому метадані додаються після кодування.
+func setDensity(data []byte, format string, dpi int) ([]byte, error) {
+	switch format {
+	case "jpeg":
+		return setJPEGDensity(data, dpi)
+	case "png":
+		return setPNGDensity(data, dpi)
+	case "tiff":
+		return setTIFFDensity(data, dpi)
+	}
+	return nil, fmt.Errorf("dpi is not supported for %s output", format)
+}
+
+// setJPEGDensity вставляє сегмент JFIF APP0 з густиною в точках на дюйм одразу після SOI
+// (або оновлює наявний JFIF).
+func setJPEGDensity(data []byte, dpi int) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+
+	// Наявний JFIF: FF E0, довжина, "JFIF\0", версія (2 байти), одиниці, X, Y
+	if len(data) >= 18 && data[2] == 0xff && data[3] == 0xe0 && bytes.Equal(data[6:11], []byte("JFIF\x00")) {
+		data[13] = 1
+		binary.BigEndian.PutUint16(data[14:], uint16(dpi))
+		binary.BigEndian.PutUint16(data[16:], uint16(dpi))
+		return data, nil
+	}
+
+	app0 := []byte{0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x01, 0, 0, 0, 0, 0x00, 0x00}
+	binary.BigEndian.PutUint16(app0[12:], uint16(dpi))
+	binary.BigEndian.PutUint16(app0[14:], uint16(dpi))
+
+	out := make([]byte, 0, len(data)+len(app0))
+	out = append(out, data[:2]...)
+	out = append(out, app0...)
+	return append(out, data[2:]...), nil
+}
+
+// setPNGDensity вставляє чанк pHYs (пікселі на метр) одразу після IHDR, до даних зображення.
+func setPNGDensity(data []byte, dpi int) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen+8 || string(data[signatureLen+4:signatureLen+8]) != "IHDR" {
+		return nil, errors.New("png: missing IHDR chunk")
+	}
+	// Чанк: довжина (4), тип (4), дані, CRC (4)
+	ihdrEnd := signatureLen + 12 + int(binary.BigEndian.Uint32(data[signatureLen:]))
+	if ihdrEnd > len(data) {
+		return nil, errors.New("png: IHDR chunk is truncated")
+	}
+
+	ppm := uint32(math.Round(float64(dpi) / 0.0254))
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // одиниця - метр
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+// setTIFFDensity замінює значення XResolution і YResolution першого IFD на dpi/1
+// і встановлює ResolutionUnit у дюйми.
+func setTIFFDensity(data []byte, dpi int) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, errors.New("tiff: header is too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid byte order")
+	}
+
+	offset := int(order.Uint32(data[4:8]))
+	if offset+2 > len(data) {
+		return nil, errors.New("tiff: directory offset is out of bounds")
+	}
+	entries := int(order.Uint16(data[offset:]))
+	if offset+2+entries*12 > len(data) {
+		return nil, errors.New("tiff: directory is truncated")
+	}
+
+	found := 0
+	for i := 0; i < entries; i++ {
+		entry := data[offset+2+i*12:]
+		tag, typ := order.Uint16(entry[0:]), order.Uint16(entry[2:])
+		switch {
+		case (tag == tiffTagXResolution || tag == tiffTagYResolution) && typ == tiffTypeRational:
+			// RATIONAL (8 байтів) не вміщується в запис, тож поле значення - зсув
+			valueOffset := int(order.Uint32(entry[8:]))
+			if valueOffset+8 > len(data) {
+				return nil, errors.New("tiff: resolution value is out of bounds")
+			}
+			order.PutUint32(data[valueOffset:], uint32(dpi))
+			order.PutUint32(data[valueOffset+4:], 1)
+			found++
+		case tag == tiffTagResolutionUnit && typ == tiffTypeShort:
+			order.PutUint16(entry[8:], tiffUnitInch)
+		}
+	}
+	if found != 2 {
+		return nil, errors.New("tiff: resolution tags not found")
+	}
+	return data, nil
+}
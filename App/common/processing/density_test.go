@@ -0,0 +1,145 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"testing"
+)
+
+// readJPEGDensity повертає густину з JFIF APP0 (одиниці 1 - точки на дюйм); 0 - сегмента немає
+func readJPEGDensity(data []byte) (int, error) {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xff; {
+		marker, length := data[pos+1], int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xda {
+			break
+		}
+		body := data[pos+4 : min(pos+2+length, len(data))]
+		if marker == 0xe0 && len(body) >= 12 && string(body[:5]) == "JFIF\x00" {
+			x, y := binary.BigEndian.Uint16(body[8:]), binary.BigEndian.Uint16(body[10:])
+			if body[7] != 1 || x != y {
+				return 0, fmt.Errorf("JFIF density %dx%d in units %d, want equal dots per inch", x, y, body[7])
+			}
+			return int(x), nil
+		}
+		pos += 2 + length
+	}
+	return 0, nil
+}
+
+// readPNGDensity переводить pHYs (пікселі на метр) у dpi; 0 - чанка немає
+func readPNGDensity(data []byte) (int, error) {
+	for pos := 8; pos+8 <= len(data); {
+		length, kind := int(binary.BigEndian.Uint32(data[pos:])), string(data[pos+4:pos+8])
+		if kind == "IDAT" {
+			break
+		}
+		if kind == "pHYs" && length == 9 && pos+17 <= len(data) {
+			x, y := binary.BigEndian.Uint32(data[pos+8:]), binary.BigEndian.Uint32(data[pos+12:])
+			if data[pos+16] != 1 || x != y {
+				return 0, fmt.Errorf("pHYs density %dx%d in units %d, want equal pixels per metre", x, y, data[pos+16])
+			}
+			return int(math.Round(float64(x) * 0.0254)), nil
+		}
+		pos += 12 + length
+	}
+	return 0, nil
+}
+
+// readTIFFDensity повертає XResolution першого IFD, якщо одиниці - дюйми
+func readTIFFDensity(data []byte) (int, error) {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if string(data[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	offset := int(order.Uint32(data[4:]))
+	entries := int(order.Uint16(data[offset:]))
+	var x, y, unit int
+	for i := range entries {
+		entry := data[offset+2+i*12:]
+		switch order.Uint16(entry) {
+		case tiffTagXResolution, tiffTagYResolution:
+			value := int(order.Uint32(entry[8:]))
+			r := int(order.Uint32(data[value:])) / max(int(order.Uint32(data[value+4:])), 1)
+			if order.Uint16(entry) == tiffTagXResolution {
+				x = r
+			} else {
+				y = r
+			}
+		case tiffTagResolutionUnit:
+			unit = int(order.Uint16(entry[8:]))
+		}
+	}
+	if unit != tiffUnitInch || x != y {
+		return 0, fmt.Errorf("TIFF resolution %dx%d in units %d, want equal dots per inch", x, y, unit)
+	}
+	return x, nil
+}
+
+func readDensity(data []byte, format string) (int, error) {
+	switch format {
+	case "jpeg":
+		return readJPEGDensity(data)
+	case "png":
+		return readPNGDensity(data)
+	case "tiff":
+		return readTIFFDensity(data)
+	}
+	return 0, errors.New("unexpected format " + format)
+}
+
+func TestEncodeDensity(t *testing.T) {
+	img := gradientImage(80, 60)
+	tests := []struct {
+		params  string
+		format  string
+		wantDPI int
+	}{
+		{"40x30;format=jpeg,dpi=300", "jpeg", 300},
+		{"40x30;format=png,dpi=300", "png", 300},
+		{"40x30;format=tiff,dpi=300", "tiff", 300},
+		{"40x30;format=jpeg,dpi=72", "jpeg", 72},
+		{"40x30;format=png,dpi=1200", "png", 1200},
+		{"40x30;format=tiff,dpi=65535", "tiff", 65535},
+		// Без dpi роздільність не записується (x/image/tiff завжди пише 72)
+		{"40x30;format=jpeg", "jpeg", 0},
+		{"40x30;format=png", "png", 0},
+		{"40x30;format=tiff", "tiff", 72},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			actionParams, opts, err := SplitOutputOptions(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resized, err := Process(img, "resize", actionParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := Encode(&buf, resized, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := readDensity(buf.Bytes(), tt.format); err != nil || got != tt.wantDPI {
+				t.Fatalf("density = %d, %v; want %d", got, err, tt.wantDPI)
+			}
+			// Метадані не зіпсували файл
+			decoded, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil || format != tt.format || decoded.Bounds().Size() != image.Pt(40, 30) {
+				t.Fatalf("output decodes as %s %v, %v; want %s 40x30", format, decoded.Bounds().Size(), err, tt.format)
+			}
+		})
+	}
+}
+
+func TestOutputOptionsDPIValidation(t *testing.T) {
+	for _, params := range []string{"dpi=0", "dpi=65536", "dpi=high", "format=webp,dpi=300"} {
+		if _, _, err := SplitOutputOptions(params); err == nil {
+			t.Errorf("SplitOutputOptions(%q) accepted an invalid dpi", params)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+)
+
+const (
+	// enhanceClipFraction - частка найтемніших і найсвітліших пікселів, що ігнорується при автоконтрасті
+	enhanceClipFraction = 0.005
+	// enhanceSaturationBoost - підсилення насиченості при strength=1
+	enhanceSaturationBoost = 0.2
+	// enhanceSharpenAmount - сила нерізкого маскування при strength=1
+	enhanceSharpenAmount = 0.5
+)
+
+// parseEnhanceParams розбирає params як силу ефекту 0-1 (за замовчуванням 1).
+func parseEnhanceParams(params string) (float64, error) {
+	if params == "" {
+		return 1, nil
+	}
+	v, err := strconv.ParseFloat(params, 64)
+	if err != nil || v < 0 || v > 1 {
+		return 0, fmt.Errorf("invalid enhance parameters: expected strength 0-1")
+	}
+	return v, nil
+}
+
+// applyEnhance - "покращення в один клік": автоконтраст, помірне підсилення насиченості
+// та підвищення різкості. Params - необов'язкова сила ефекту 0-1.
+func applyEnhance(img image.Image, params string) (image.Image, error) {
+	strength, err := parseEnhanceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	if strength == 0 {
+		return rgba, nil
+	}
+
+	autoContrastAndSaturate(rgba, strength)
+	return sharpen(rgba, enhanceSharpenAmount*strength), nil
+}
+
+// autoContrastAndSaturate за один прохід розтягує діапазон яскравості між перцентилями
+// гістограми до 0-255 і підсилює насиченість відносно яскравості пікселя.
+func autoContrastAndSaturate(img *image.RGBA, strength float64) {
+	var histogram [256]int
+	pixels := len(img.Pix) / 4
+	for i := 0; i < len(img.Pix); i += 4 {
+		histogram[luma(img.Pix[i], img.Pix[i+1], img.Pix[i+2])]++
+	}
+
+	clip := int(float64(pixels) * enhanceClipFraction)
+	low, high := 0, 255
+	for count := 0; low < 255 && count+histogram[low] <= clip; low++ {
+		count += histogram[low]
+	}
+	for count := 0; high > 0 && count+histogram[high] <= clip; high-- {
+		count += histogram[high]
+	}
+
+	scale := 1.0
+	if high > low {
+		scale = 255 / float64(high-low)
+	} else {
+		low = 0
+	}
+	saturation := 1 + enhanceSaturationBoost*strength
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		var c [3]float64
+		for ch := 0; ch < 3; ch++ {
+			v := float64(img.Pix[i+ch])
+			stretched := (v - float64(low)) * scale
+			c[ch] = v + (stretched-v)*strength
+		}
+
+		y := 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+		for ch := 0; ch < 3; ch++ {
+			img.Pix[i+ch] = clampUint8(y + (c[ch]-y)*saturation)
+		}
+	}
+}
+
+// sharpen підвищує різкість нерізким маскуванням: до пікселя додається його різниця
+// з середнім 3x3 околу, помножена на amount. Краї зображення повторюються.
+func sharpen(img *image.RGBA, amount float64) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewRGBA(img.Rect)
+	copy(out.Pix, img.Pix)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [3]int
+			for dy := -1; dy <= 1; dy++ {
+				sy := clampInt(y+dy, 0, h-1)
+				for dx := -1; dx <= 1; dx++ {
+					sx := clampInt(x+dx, 0, w-1)
+					off := sy*img.Stride + sx*4
+					sum[0] += int(img.Pix[off])
+					sum[1] += int(img.Pix[off+1])
+					sum[2] += int(img.Pix[off+2])
+				}
+			}
+
+			off := y*img.Stride + x*4
+			for ch := 0; ch < 3; ch++ {
+				v := float64(img.Pix[off+ch])
+				out.Pix[off+ch] = clampUint8(v + (v-float64(sum[ch])/9)*amount)
+			}
+		}
+	}
+	return out
+}
+
+// luma повертає яскравість пікселя (ITU-R BT.601) у діапазоні 0-255
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b)) / 1000)
+}
+
+func clampUint8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
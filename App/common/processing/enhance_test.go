@@ -0,0 +1,132 @@
+package processing
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// -update перезаписує еталони в testdata поточним результатом (після свідомої зміни алгоритму)
+var updateGolden = flag.Bool("update", false, "rewrite golden images in testdata")
+
+// enhanceFixture - тьмяне, малоконтрастне зображення: діапазон яскравості 70-180,
+// приглушені кольори і дрібні деталі, на яких видно підвищення різкості
+func enhanceFixture() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 48, 32))
+	for y := range 32 {
+		for x := range 48 {
+			base := 70 + 110*float64(x)/47
+			detail := 0.0
+			if (x/3+y/3)%2 == 0 {
+				detail = 12
+			}
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(base + detail),
+				uint8(base*0.9 + 15*math.Sin(float64(y)/5)),
+				uint8(base*0.8 + detail/2),
+				255,
+			})
+		}
+	}
+	return img
+}
+
+func readPNG(t *testing.T, path string) *image.RGBA {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnhanceGolden(t *testing.T) {
+	input := filepath.Join("testdata", "enhance_input.png")
+	if _, err := os.Stat(input); *updateGolden && os.IsNotExist(err) {
+		writePNG(t, input, enhanceFixture())
+	}
+	src := readPNG(t, input)
+
+	for _, tt := range []struct{ params, golden string }{
+		{"", "enhance_full.png"},
+		{"0.5", "enhance_half.png"},
+		{"0", "enhance_none.png"},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			out, err := Process(src, "enhance", tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				writePNG(t, path, out)
+				return
+			}
+
+			want := readPNG(t, path)
+			got := image.NewRGBA(out.Bounds())
+			draw.Draw(got, got.Bounds(), out, out.Bounds().Min, draw.Src)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("output bounds = %v, golden %v", got.Bounds(), want.Bounds())
+			}
+			// Допуск 1 - на різне округлення float на різних архітектурах (FMA)
+			for i := range got.Pix {
+				if d := int(got.Pix[i]) - int(want.Pix[i]); d > 1 || d < -1 {
+					x, y := (i/4)%got.Rect.Dx(), (i/4)/got.Rect.Dx()
+					t.Fatalf("pixel (%d,%d) channel %d = %d, golden %d; rerun with -update if the change is intended",
+						x, y, i%4, got.Pix[i], want.Pix[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEnhanceIncreasesContrast(t *testing.T) {
+	src := enhanceFixture()
+	out, err := Process(src, "enhance", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lumaRange := func(img image.Image) (lo, hi uint8) {
+		lo = 255
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				l := luma(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+				lo, hi = min(lo, l), max(hi, l)
+			}
+		}
+		return lo, hi
+	}
+	srcLo, srcHi := lumaRange(src)
+	outLo, outHi := lumaRange(out)
+	if outHi-outLo <= srcHi-srcLo {
+		t.Fatalf("luma range %d-%d after enhance, %d-%d before; want a wider range", outLo, outHi, srcLo, srcHi)
+	}
+}
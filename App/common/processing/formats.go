@@ -0,0 +1,57 @@
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"sync"
+)
+
+// OutputFormats - формати, в які можна закодувати результат (ключ format у параметрах кодування)
+var OutputFormats = []string{"jpeg", "png", "webp", "tiff"}
+
+// knownInputFormats - формати, декодери яких можуть бути підключені до збірки, і сигнатури
+// їхніх файлів у тому вигляді, в якому їх розпізнає image.RegisterFormat
+var knownInputFormats = []struct {
+	name  string
+	magic string
+}{
+	{"jpeg", "\xff\xd8"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF89a"},
+	{"bmp", "BM\x00\x00\x00\x00\x00\x00\x00\x00"},
+	{"tiff", "II*\x00"},
+	{"webp", "RIFF\x00\x00\x00\x00WEBPVP8 "},
+	{"heic", "\x00\x00\x00\x18ftypheic"},
+}
+
+var (
+	inputFormatsOnce sync.Once
+	inputFormats     []string
+)
+
+// InputFormats повертає формати вхідних зображень, декодери яких зареєстровані в пакеті image
+// цієї збірки. Пакет image не надає списку декодерів, тому кожен відомий формат перевіряється
+// його сигнатурою: image.ErrFormat означає, що декодер не підключено.
+func InputFormats() []string {
+	inputFormatsOnce.Do(func() {
+		for _, f := range knownInputFormats {
+			if decoderRegistered(f.magic) {
+				inputFormats = append(inputFormats, f.name)
+			}
+		}
+	})
+	return inputFormats
+}
+
+// decoderRegistered повідомляє, чи знайшовся декодер для даних, що складаються лише з сигнатури.
+// Сам декодер на таких даних завершується помилкою або панікою, що тут не має значення.
+func decoderRegistered(magic string) (registered bool) {
+	defer func() {
+		if recover() != nil {
+			registered = true
+		}
+	}()
+	_, _, err := image.DecodeConfig(bytes.NewReader([]byte(magic)))
+	return !errors.Is(err, image.ErrFormat)
+}
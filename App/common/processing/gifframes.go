@@ -0,0 +1,243 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+const (
+	// maxAnimationPixels обмежує сумарну площу всіх кадрів GIF (кадри x полотно): кожен кадр
+	// накладається на полотно, тож від неї залежить час декодування
+	maxAnimationPixels = 1_000_000_000
+	// maxKeptFramePixels обмежує сумарну площу кадрів, які DecodeGIFFrames повертає як повні
+	// зображення RGBA (4 байти на піксель)
+	maxKeptFramePixels = 100_000_000
+)
+
+// Блоки файлу GIF
+const (
+	gifExtension      = 0x21
+	gifImageSeparator = 0x2C
+	gifTrailer        = 0x3B
+	gifGraphicControl = 0xF9
+)
+
+// gifStream читає GIF блок за блоком, не декодуючи пікселів: у пам'яті одночасно лише один кадр,
+// тоді як gif.DecodeAll тримає всі.
+type gifStream struct {
+	r      *bufio.Reader
+	header []byte // підпис, логічний екран і глобальна палітра
+	width  int
+	height int
+}
+
+// gifFrame - один кадр GIF
+type gifFrame struct {
+	// data - кадр як окремий GIF з одного зображення (для gif.Decode); nil, якщо не запитано
+	data     []byte
+	disposal byte
+}
+
+func newGIFStream(r io.Reader) (*gifStream, error) {
+	s := &gifStream{r: bufio.NewReader(r)}
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(s.r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:3], []byte("GIF")) {
+		return nil, errors.New("gif: not a GIF file")
+	}
+	// Кадр може мати блок керування графікою, тож окремі кадри завжди мають версію 89a
+	copy(header[3:6], "89a")
+	s.width = int(header[6]) | int(header[7])<<8
+	s.height = int(header[8]) | int(header[9])<<8
+	if header[10]&0x80 != 0 {
+		palette := make([]byte, 3<<(header[10]&0x07+1))
+		if _, err := io.ReadFull(s.r, palette); err != nil {
+			return nil, err
+		}
+		header = append(header, palette...)
+	}
+	s.header = header
+	return s, nil
+}
+
+// next повертає наступний кадр (nil після останнього). Якщо keep - false, дані кадру
+// пропускаються, а не збираються.
+func (s *gifStream) next(keep bool) (*gifFrame, error) {
+	var control []byte // блок керування графікою, що стосується наступного кадру
+	for {
+		block, err := s.r.ReadByte()
+		if err == io.EOF {
+			// Файли без завершального блоку трапляються; gif.DecodeAll теж їх приймає
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch block {
+		case gifTrailer:
+			return nil, nil
+
+		case gifExtension:
+			label, err := s.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			var ext []byte
+			if label == gifGraphicControl {
+				ext = []byte{gifExtension, label}
+			}
+			if ext, err = s.readSubBlocks(ext, label == gifGraphicControl); err != nil {
+				return nil, err
+			}
+			if label == gifGraphicControl {
+				if len(ext) < 4 || ext[2] != 4 {
+					return nil, errors.New("gif: invalid graphic control extension")
+				}
+				control = ext
+			}
+
+		case gifImageSeparator:
+			descriptor := make([]byte, 10)
+			descriptor[0] = block
+			if _, err := io.ReadFull(s.r, descriptor[1:]); err != nil {
+				return nil, err
+			}
+			frame := &gifFrame{}
+			if control != nil {
+				frame.disposal = (control[3] >> 2) & 0x07
+			}
+
+			var data []byte
+			if keep {
+				data = make([]byte, 0, len(s.header)+len(control)+len(descriptor))
+				data = append(append(append(data, s.header...), control...), descriptor...)
+			}
+			// Локальна палітра і мінімальний розмір коду LZW
+			tail := 1
+			if descriptor[9]&0x80 != 0 {
+				tail += 3 << (descriptor[9]&0x07 + 1)
+			}
+			prefix := make([]byte, tail)
+			if _, err := io.ReadFull(s.r, prefix); err != nil {
+				return nil, err
+			}
+			if data, err = s.readSubBlocks(append(data, prefix...), keep); err != nil {
+				return nil, err
+			}
+			if keep {
+				frame.data = append(data, gifTrailer)
+			}
+			return frame, nil
+
+		default:
+			return nil, fmt.Errorf("gif: unknown block type 0x%02x", block)
+		}
+	}
+}
+
+// readSubBlocks читає послідовність підблоків до нульового і, якщо keep, додає її до buf
+func (s *gifStream) readSubBlocks(buf []byte, keep bool) ([]byte, error) {
+	for {
+		size, err := s.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			buf = append(buf, size)
+		}
+		if size == 0 {
+			return buf, nil
+		}
+		if keep {
+			n := len(buf)
+			buf = append(buf, make([]byte, size)...)
+			if _, err := io.ReadFull(s.r, buf[n:]); err != nil {
+				return nil, err
+			}
+		} else if _, err := s.r.Discard(int(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DecodeGIFFrames декодує кадри GIF як повні зображення: кадри GIF часто оновлюють лише
+// частину полотна, тому кожен накладається на попередній стан з урахуванням способу його видалення.
+// Якщо maxFrames > 0, повертається не більше maxFrames кадрів, рівномірно розподілених по анімації
+// (кадр i*total/count); решта декодується лише для накладання. Кадри обробляються за один прохід
+// по одному, тож пам'ять обмежена полотном і поверненими кадрами.
+func DecodeGIFFrames(r io.ReadSeeker, maxFrames int) ([]image.Image, error) {
+	total, err := GIFFrameCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("gif: no frames")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	s, err := newGIFStream(r)
+	if err != nil {
+		return nil, WrapDecodeError(err)
+	}
+
+	count := total
+	if maxFrames > 0 && maxFrames < total {
+		count = maxFrames
+	}
+	canvasPixels := int64(s.width) * int64(s.height)
+	if int64(total)*canvasPixels > maxAnimationPixels {
+		return nil, fmt.Errorf("animation of %d frames of %dx%d exceeds the limit of %d pixels", total, s.width, s.height, maxAnimationPixels)
+	}
+	if int64(count)*canvasPixels > maxKeptFramePixels {
+		return nil, fmt.Errorf("%d frames of %dx%d exceed the limit of %d decoded pixels", count, s.width, s.height, maxKeptFramePixels)
+	}
+
+	canvasRect := image.Rect(0, 0, s.width, s.height)
+	canvas := image.NewRGBA(canvasRect)
+	frames := make([]image.Image, 0, count)
+
+	for i := 0; len(frames) < count; i++ {
+		frame, err := s.next(true)
+		if err != nil {
+			return nil, WrapDecodeError(err)
+		}
+		if frame == nil {
+			break
+		}
+		img, err := gif.Decode(bytes.NewReader(frame.data))
+		if err != nil {
+			return nil, WrapDecodeError(err)
+		}
+
+		var previous *image.RGBA
+		if frame.disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasRect)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		if i == len(frames)*total/count {
+			snapshot := image.NewRGBA(canvasRect)
+			copy(snapshot.Pix, canvas.Pix)
+			frames = append(frames, snapshot)
+		}
+
+		switch frame.disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,160 @@
+package processing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+// testAnimation - GIF 8x8 з кадрами, що оновлюють частину полотна, з різними способами видалення
+func testAnimation(t *testing.T, frames int) []byte {
+	t.Helper()
+	palette := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	disposals := []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious}
+	g := &gif.GIF{Config: image.Config{Width: 8, Height: 8, ColorModel: palette}}
+	for i := range frames {
+		frame := image.NewPaletted(image.Rect(i%6, i%6, i%6+3, i%6+3), palette)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(1 + i%2)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+		g.Disposal = append(g.Disposal, disposals[i%len(disposals)])
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// composeAll - еталонне накладання всіх кадрів через gif.DecodeAll
+func composeAll(t *testing.T, data []byte) []*image.RGBA {
+	t.Helper()
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(rect)
+	var frames []*image.RGBA
+	for i, frame := range g.Image {
+		previous := image.NewRGBA(rect)
+		copy(previous.Pix, canvas.Pix)
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		snapshot := image.NewRGBA(rect)
+		copy(snapshot.Pix, canvas.Pix)
+		frames = append(frames, snapshot)
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	n, err := GIFFrameCount(bytes.NewReader(testAnimation(t, 7)))
+	if err != nil || n != 7 {
+		t.Fatalf("GIFFrameCount = %d, %v; want 7, nil", n, err)
+	}
+	if _, err := GIFFrameCount(strings.NewReader("PNG not a gif")); err == nil {
+		t.Fatal("GIFFrameCount accepted a non-GIF input")
+	}
+}
+
+func TestDecodeGIFFrames(t *testing.T) {
+	data := testAnimation(t, 7)
+	want := composeAll(t, data)
+
+	tests := []struct {
+		name      string
+		maxFrames int
+		indices   []int
+	}{
+		{"all frames", 0, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"limit above frame count", 10, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"sampled", 3, []int{0, 2, 4}},
+		{"two frames", 2, []int{0, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := DecodeGIFFrames(bytes.NewReader(data), tt.maxFrames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != len(tt.indices) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(tt.indices))
+			}
+			for i, idx := range tt.indices {
+				if got := frames[i].(*image.RGBA); !bytes.Equal(got.Pix, want[idx].Pix) {
+					t.Errorf("frame %d differs from composed frame %d", i, idx)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeGIFFramesLimits(t *testing.T) {
+	// Полотно 65535x65535 з одним кадром 1x1: файл маленький, але повні кадри не помістилися б у пам'ять
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{
+		Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 1, 1), palette), image.NewPaletted(image.Rect(0, 0, 1, 1), palette)},
+		Delay:  []int{0, 0},
+		Config: image.Config{Width: 65535, Height: 65535, ColorModel: palette},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	_, err := DecodeGIFFrames(bytes.NewReader(buf.Bytes()), 0)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Fatalf("DecodeGIFFrames = %v, want a pixel limit error", err)
+	}
+}
+
+func TestSpriteSheetSampling(t *testing.T) {
+	data := testAnimation(t, 7)
+	const params = "frames=3,cols=3"
+	frames, err := DecodeGIFFrames(bytes.NewReader(data), FrameLimit("spritesheet", params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampled, err := ProcessFrames(frames, "spritesheet", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Той самий результат, що й вибірка з усіх кадрів
+	all := make([]image.Image, 0, 7)
+	for _, f := range composeAll(t, data) {
+		all = append(all, f)
+	}
+	full, err := ProcessFrames(all, "spritesheet", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sampled.(*image.RGBA).Pix, full.(*image.RGBA).Pix) {
+		t.Fatal("spritesheet from sampled frames differs from the one built from all frames")
+	}
+
+	// Один кадр зі статичного GIF - помилка, навіть якщо потрібен лише один кадр
+	if _, err := ProcessFrames(frames[:1], "spritesheet", "frames=1,cols=1"); err == nil {
+		t.Fatal("spritesheet accepted a single frame")
+	}
+}
+
+func TestSpriteSheetSize(t *testing.T) {
+	if err := Validate("spritesheet", "frames=100,cols=10,cell=2000x2000"); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Fatalf("Validate = %v, want a sheet size error", err)
+	}
+	if err := Validate("spritesheet", "frames=8,cols=4,cell=100x100"); err != nil {
+		t.Fatalf("Validate = %v, want nil", err)
+	}
+}
@@ -0,0 +1,218 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// iccJPEGSignature - початок сегмента APP2 з частиною ICC-профілю
+const iccJPEGSignature = "ICC_PROFILE\x00"
+
+// iccJPEGChunkSize - найбільша частина профілю в одному сегменті APP2
+// (65535 - 2 байти довжини - підпис - номер і кількість частин)
+const iccJPEGChunkSize = 65535 - 2 - len(iccJPEGSignature) - 2
+
+// maxICCProfileBytes обмежує розмір профілю, який читається з PNG (iCCP стиснутий)
+const maxICCProfileBytes = 4 * 1024 * 1024
+
+// ExtractICCProfile повертає вбудований ICC-профіль JPEG (сегменти APP2) або PNG (чанк iCCP).
+// Для інших форматів і файлів без профілю повертає nil без помилки.
+func ExtractICCProfile(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(8)
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8}):
+		return extractJPEGICC(br)
+	case bytes.Equal(head, []byte("\x89PNG\r\n\x1a\n")):
+		return extractPNGICC(br)
+	}
+	return nil, nil
+}
+
+// extractJPEGICC збирає профіль з частин APP2 у порядку їх номерів.
+func extractJPEGICC(r io.Reader) ([]byte, error) {
+	segments, err := ReadJPEGMetadata(r)
+	if err != nil {
+		return nil, err
+	}
+
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	var chunks []chunk
+	for len(segments) >= 4 {
+		length := int(binary.BigEndian.Uint16(segments[2:]))
+		if 2+length > len(segments) {
+			return nil, errors.New("jpeg: metadata segment is truncated")
+		}
+		body := segments[4 : 2+length]
+		if segments[1] == jpegMarkerAPP2 && len(body) > len(iccJPEGSignature)+2 && string(body[:len(iccJPEGSignature)]) == iccJPEGSignature {
+			chunks = append(chunks, chunk{seq: body[len(iccJPEGSignature)], data: body[len(iccJPEGSignature)+2:]})
+		}
+		segments = segments[2+length:]
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var profile []byte
+	for _, c := range chunks {
+		profile = append(profile, c.data...)
+	}
+	return profile, nil
+}
+
+// extractPNGICC читає профіль із чанка iCCP (назва, 0, метод стиснення, zlib-дані).
+// Чанк за стандартом іде до IDAT, тож дані зображення не читаються.
+func extractPNGICC(r io.Reader) ([]byte, error) {
+	if _, err := io.CopyN(io.Discard, r, 8); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		length, typ := binary.BigEndian.Uint32(header[:4]), string(header[4:])
+		if typ == "IDAT" || typ == "IEND" {
+			return nil, nil
+		}
+		if typ != "iCCP" {
+			if _, err := io.CopyN(io.Discard, r, int64(length)+4); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if length > maxICCProfileBytes {
+			return nil, errors.New("png: iCCP chunk is too large")
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		nameEnd := bytes.IndexByte(data, 0)
+		if nameEnd < 0 || nameEnd+2 > len(data) {
+			return nil, errors.New("png: invalid iCCP chunk")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data[nameEnd+2:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, maxICCProfileBytes))
+	}
+}
+
+// ICCProfileDescription повертає назву профілю з тегу desc ("Adobe RGB (1998)", "sRGB IEC61966-2.1")
+// або "unnamed", якщо її не вдалося прочитати.
+func ICCProfileDescription(profile []byte) string {
+	const headerSize = 128
+	if len(profile) < headerSize+4 {
+		return "unnamed"
+	}
+	count := int(binary.BigEndian.Uint32(profile[headerSize:]))
+	for i := 0; i < count; i++ {
+		entry := headerSize + 4 + i*12
+		if entry+12 > len(profile) {
+			break
+		}
+		if string(profile[entry:entry+4]) != "desc" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 12 || offset+size > len(profile) {
+			break
+		}
+		if desc := parseICCText(profile[offset : offset+size]); desc != "" {
+			return desc
+		}
+		break
+	}
+	return "unnamed"
+}
+
+// parseICCText розбирає текстовий тип ICC: "desc" (ICC v2, ASCII) або "mluc" (ICC v4, UTF-16BE).
+func parseICCText(tag []byte) string {
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if n <= 0 || 12+n > len(tag) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		if len(tag) < 28 {
+			return ""
+		}
+		// Перший запис: мова (2), країна (2), довжина (4), зсув (4)
+		n := int(binary.BigEndian.Uint32(tag[20:]))
+		offset := int(binary.BigEndian.Uint32(tag[24:]))
+		if offset+n > len(tag) || n%2 != 0 {
+			return ""
+		}
+		units := make([]uint16, n/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
+
+// jpegICCSegments ділить профіль на сегменти APP2 "ICC_PROFILE" для вставки в JPEG.
+func jpegICCSegments(profile []byte) []byte {
+	count := (len(profile) + iccJPEGChunkSize - 1) / iccJPEGChunkSize
+	var segments []byte
+	for i := 0; i < count; i++ {
+		part := profile[i*iccJPEGChunkSize : min((i+1)*iccJPEGChunkSize, len(profile))]
+		length := 2 + len(iccJPEGSignature) + 2 + len(part)
+		segments = append(segments, 0xff, jpegMarkerAPP2, byte(length>>8), byte(length))
+		segments = append(segments, iccJPEGSignature...)
+		segments = append(segments, byte(i+1), byte(count))
+		segments = append(segments, part...)
+	}
+	return segments
+}
+
+// insertPNGICC вставляє чанк iCCP зі стиснутим профілем одразу після IHDR.
+func insertPNGICC(data, profile []byte) ([]byte, error) {
+	const signatureLen = 8
+	if len(data) < signatureLen+8 || string(data[signatureLen+4:signatureLen+8]) != "IHDR" {
+		return nil, errors.New("png: missing IHDR chunk")
+	}
+	ihdrEnd := signatureLen + 12 + int(binary.BigEndian.Uint32(data[signatureLen:]))
+	if ihdrEnd > len(data) {
+		return nil, errors.New("png: IHDR chunk is truncated")
+	}
+
+	var body bytes.Buffer
+	body.WriteString("ICC Profile\x00\x00") // назва профілю, 0, метод стиснення 0 (zlib)
+	zw := zlib.NewWriter(&body)
+	zw.Write(profile)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	chunk := make([]byte, 8, 12+body.Len())
+	binary.BigEndian.PutUint32(chunk, uint32(body.Len()))
+	copy(chunk[4:], "iCCP")
+	chunk = append(chunk, body.Bytes()...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...), nil
+}
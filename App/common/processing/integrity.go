@@ -0,0 +1,62 @@
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorruptImage повертається, якщо вхідний файл обрізаний або пошкоджений.
+var ErrCorruptImage = errors.New("corrupt/truncated image")
+
+// trailerSize - скільки байтів з кінця файлу читається для перевірки завершального маркера.
+const trailerSize = 64
+
+var (
+	jpegEOI    = []byte{0xFF, 0xD9}
+	pngIENDTag = []byte{'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82}
+)
+
+// WrapDecodeError позначає помилки декодування через несподіваний кінець даних як ErrCorruptImage.
+// Декодери стандартної бібліотеки повертають io.ErrUnexpectedEOF для більшості обрізаних файлів.
+func WrapDecodeError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %v", ErrCorruptImage, err)
+	}
+	return err
+}
+
+// CheckTrailer - сувора перевірка цілісності: JPEG має закінчуватися маркером EOI, PNG - чанком IEND.
+// Обрізаний прогресивний JPEG інколи декодується без помилки, але з сірими нижніми рядками,
+// тому завершальний маркер - єдина надійна ознака повного файлу. Інші формати не перевіряються.
+func CheckTrailer(r io.ReadSeeker, format string) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	n := int64(trailerSize)
+	if size < n {
+		n = size
+	}
+	if _, err := r.Seek(size-n, io.SeekStart); err != nil {
+		return err
+	}
+	tail := make([]byte, n)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpeg":
+		// Деякі кодувальники доповнюють файл нулями після EOI
+		if !bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), jpegEOI) {
+			return fmt.Errorf("%w: missing JPEG end-of-image marker", ErrCorruptImage)
+		}
+	case "png":
+		if !bytes.HasSuffix(tail, pngIENDTag) {
+			return fmt.Errorf("%w: missing PNG IEND chunk", ErrCorruptImage)
+		}
+	}
+	return nil
+}
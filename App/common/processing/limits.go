@@ -0,0 +1,68 @@
+package processing
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// ActionLimit - обмеження ресурсів для однієї дії з ACTION_LIMITS
+type ActionLimit struct {
+	MaxMegapixels float64 `json:"max_megapixels"` // 0 - без обмеження
+	Timeout       string  `json:"timeout"`        // тривалість у форматі Go ("30s"), порожньо - без обмеження
+
+	timeout time.Duration
+}
+
+// ActionLimits - обмеження за назвою дії, наприклад
+// ACTION_LIMITS='{"autostraighten":{"max_megapixels":20,"timeout":"30s"}}'.
+// Розмір входу перевіряють і Worker, і API (для завдань, які воно обробляє само).
+type ActionLimits map[string]ActionLimit
+
+// ParseActionLimits розбирає JSON з ACTION_LIMITS і перевіряє назви дій та значення
+func ParseActionLimits(value string) (ActionLimits, error) {
+	var raw map[string]ActionLimit
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("expected JSON object of {\"action\": {\"max_megapixels\": N, \"timeout\": \"30s\"}}: %v", err)
+	}
+
+	limits := make(ActionLimits, len(raw))
+	for name, limit := range raw {
+		name = strings.ToLower(name)
+		if err := Enabled(name); err != nil {
+			return nil, err
+		}
+		if limit.MaxMegapixels < 0 {
+			return nil, fmt.Errorf("action '%s': max_megapixels must be non-negative", name)
+		}
+		if limit.Timeout != "" {
+			d, err := time.ParseDuration(limit.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("action '%s': invalid timeout '%s'", name, limit.Timeout)
+			}
+			limit.timeout = d
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// CheckPixels відхиляє зображення, більші за max_megapixels дії, ще до декодування
+func (l ActionLimits) CheckPixels(action string, config image.Config) error {
+	limit := l[strings.ToLower(action)]
+	if limit.MaxMegapixels <= 0 {
+		return nil
+	}
+	megapixels := float64(config.Width) * float64(config.Height) / 1e6
+	if megapixels > limit.MaxMegapixels {
+		return fmt.Errorf("image %dx%d (%.1f MP) exceeds the %.1f MP limit for action '%s'", config.Width, config.Height, megapixels, limit.MaxMegapixels, action)
+	}
+	return nil
+}
+
+// TimeoutFor повертає обмеження часу дії (0 - без обмеження)
+func (l ActionLimits) TimeoutFor(action string) time.Duration {
+	return l[strings.ToLower(action)].timeout
+}
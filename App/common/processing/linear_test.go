@@ -0,0 +1,100 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// checkerboard - чергування чорних і білих пікселів: середня яскравість у лінійному світлі 0.5,
+// що в sRGB відповідає ~188, а не 128
+func checkerboard(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if (x+y)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	return img
+}
+
+// meanLinearLight - середня яскравість каналу R у лінійному світлі (0-1)
+func meanLinearLight(img image.Image) float64 {
+	var sum float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			v := float64(r) / 0xffff
+			if v > 0.04045 {
+				v = math.Pow((v+0.055)/1.055, 2.4)
+			} else {
+				v /= 12.92
+			}
+			sum += v
+		}
+	}
+	return sum / float64(b.Dx()*b.Dy())
+}
+
+func TestResizeLinearPreservesBrightness(t *testing.T) {
+	defer SetFastResizeThreshold(fastResizeMaxPixels)
+	src := checkerboard(64, 64)
+	want := meanLinearLight(src)
+
+	for _, tt := range []struct {
+		name      string
+		threshold uint
+	}{
+		{"lanczos3", 0},
+		{"bilinear", 1 << 30},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			SetFastResizeThreshold(tt.threshold)
+			gamma, err := Process(src, "resize", "16x16")
+			if err != nil {
+				t.Fatal(err)
+			}
+			linear, err := Process(src, "resize", "16x16 linear=true")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gammaErr := math.Abs(meanLinearLight(gamma) - want)
+			linearErr := math.Abs(meanLinearLight(linear) - want)
+			if linearErr > 0.02 {
+				t.Errorf("linear resize mean light %.3f, want %.3f", meanLinearLight(linear), want)
+			}
+			if linearErr >= gammaErr {
+				t.Errorf("linear resize error %.3f is not below gamma-space error %.3f", linearErr, gammaErr)
+			}
+			// Пікселі результату - рівномірний сірий ~188 (sRGB для 50% світла), а не ~128
+			if c := color.RGBAModel.Convert(linear.At(8, 8)).(color.RGBA); c.R < 183 || c.R > 193 {
+				t.Errorf("linear resize pixel = %d, want ~188", c.R)
+			}
+		})
+	}
+}
+
+func TestResizeLinearDefaultOff(t *testing.T) {
+	src := checkerboard(32, 32)
+	plain, err := Process(src, "resize", "8x8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := Process(src, "resize", "8x8 linear=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if psnr(plain, explicit) != math.Inf(1) {
+		t.Fatal("linear=false output differs from the default resize")
+	}
+	if _, err := Process(src, "resize", "8x8 linear=maybe"); err == nil {
+		t.Fatal("resize accepted linear=maybe")
+	}
+}
@@ -0,0 +1,116 @@
+package processing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Маркери JPEG, сегменти яких переносяться з preserve_metadata: APP1 (EXIF, XMP),
+// APP2 (ICC-профіль) і APP13 (IPTC). APP0 (JFIF) кодувальник пише сам (див. setDensity).
+const (
+	jpegMarkerAPP1  = 0xe1
+	jpegMarkerAPP2  = 0xe2
+	jpegMarkerAPP13 = 0xed
+	jpegMarkerSOS   = 0xda
+	jpegMarkerEOI   = 0xd9
+)
+
+// ReadJPEGMetadata повертає сегменти метаданих (EXIF, XMP, ICC, IPTC) із заголовка JPEG
+// у вигляді готових до вставки байтів. Для інших форматів повертає nil без помилки.
+// Читання зупиняється на початку даних зображення (SOS), тож пікселі не читаються.
+func ReadJPEGMetadata(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(br, soi); err != nil || soi[0] != 0xff || soi[1] != 0xd8 {
+		return nil, nil
+	}
+
+	var segments []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != 0xff {
+			return nil, errors.New("jpeg: expected marker in header")
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xff {
+			// Байти-заповнювачі 0xFF перед маркером
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			return segments, nil
+		}
+
+		header := []byte{0xff, marker, 0, 0}
+		if _, err := io.ReadFull(br, header[2:]); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return nil, errors.New("jpeg: invalid segment length")
+		}
+		body := make([]byte, length-2)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return nil, err
+		}
+
+		switch marker {
+		case jpegMarkerAPP1, jpegMarkerAPP2, jpegMarkerAPP13:
+			segments = append(segments, header...)
+			segments = append(segments, body...)
+		}
+	}
+}
+
+// insertJPEGSegments вставляє сегменти метаданих у закодований JPEG одразу після SOI
+// (або після JFIF APP0, який за стандартом має йти першим).
+func insertJPEGSegments(data, segments []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+	pos := 2
+	if data[2] == 0xff && data[3] == 0xe0 && len(data) >= 6 {
+		pos += 2 + int(binary.BigEndian.Uint16(data[4:]))
+	}
+	if pos > len(data) {
+		return nil, errors.New("jpeg: APP0 segment is truncated")
+	}
+
+	out := make([]byte, 0, len(data)+len(segments))
+	out = append(out, data[:pos]...)
+	out = append(out, segments...)
+	return append(out, data[pos:]...), nil
+}
+
+// withoutCMYKProfile прибирає із сегментів ReadJPEGMetadata частини CMYK ICC-профілю:
+// NormalizeColorSpace вже перевів пікселі в sRGB, тож профіль не описує результат.
+// Частини йдуть по порядку, заголовок профілю - у першій.
+func withoutCMYKProfile(segments []byte) []byte {
+	var out []byte
+	cmyk := false
+	for len(segments) >= 4 {
+		length := int(binary.BigEndian.Uint16(segments[2:]))
+		if 2+length > len(segments) {
+			break
+		}
+		segment, body := segments[:2+length], segments[4:2+length]
+		segments = segments[2+length:]
+		if segment[1] == jpegMarkerAPP2 && len(body) > len(iccJPEGSignature)+2 && string(body[:len(iccJPEGSignature)]) == iccJPEGSignature {
+			if body[len(iccJPEGSignature)] == 1 {
+				cmyk = iccColorSpace(body[len(iccJPEGSignature)+2:]) == "CMYK"
+			}
+			if cmyk {
+				continue
+			}
+		}
+		out = append(out, segment...)
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// maxMontageCells обмежує кількість клітинок контактного аркуша
+	maxMontageCells = 100
+	// maxMontageCellSize обмежує розмір однієї клітинки
+	maxMontageCellSize = 2000
+	// maxSheetPixels обмежує площу всього аркуша (montage, spritesheet): полотно RGBA виділяється
+	// одразу, тож 50 мегапікселів - до 200 МБ пам'яті на одне завдання
+	maxSheetPixels = 50_000_000
+)
+
+// checkSheetSize перевіряє площу аркуша cols x rows клітинок розміром cellW x cellH.
+// Кожен множник уже обмежений (maxMontageCells, maxMontageCellSize), тож добуток не переповнюється.
+func checkSheetSize(cols, rows, cellW, cellH int) error {
+	if w, h := int64(cols)*int64(cellW), int64(rows)*int64(cellH); w*h > maxSheetPixels {
+		return fmt.Errorf("sheet of %dx%d pixels exceeds the limit of %d pixels", w, h, maxSheetPixels)
+	}
+	return nil
+}
+
+// montageParams - розібрані параметри дії montage
+type montageParams struct {
+	Cols, Rows   int
+	CellW, CellH int
+	Background   color.NRGBA
+}
+
+// parseMontageParams розбирає params у форматі "cols=3,rows=2,cell=200x200[,background=ffffff]".
+func parseMontageParams(params string) (montageParams, error) {
+	values, err := parseKeyValueParams(params, "cols", "rows", "cell", "background")
+	if err != nil {
+		return montageParams{}, fmt.Errorf("invalid montage parameters: %v", err)
+	}
+
+	p := montageParams{Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}}
+	// Кожен вимір обмежується окремо, до множення: інакше добуток переповнюється
+	p.Cols, err = strconv.Atoi(values["cols"])
+	if err != nil || p.Cols <= 0 || p.Cols > maxMontageCells {
+		return montageParams{}, fmt.Errorf("invalid montage cols '%s': expected integer 1-%d", values["cols"], maxMontageCells)
+	}
+	p.Rows, err = strconv.Atoi(values["rows"])
+	if err != nil || p.Rows <= 0 || p.Rows > maxMontageCells {
+		return montageParams{}, fmt.Errorf("invalid montage rows '%s': expected integer 1-%d", values["rows"], maxMontageCells)
+	}
+	if p.Cols*p.Rows > maxMontageCells {
+		return montageParams{}, fmt.Errorf("montage grid %dx%d exceeds the limit of %d cells", p.Cols, p.Rows, maxMontageCells)
+	}
+
+	cellW, cellH, found := strings.Cut(values["cell"], "x")
+	p.CellW, err = strconv.Atoi(cellW)
+	if !found || err != nil || p.CellW <= 0 || p.CellW > maxMontageCellSize {
+		return montageParams{}, fmt.Errorf("invalid montage cell '%s': expected WxH up to %d", values["cell"], maxMontageCellSize)
+	}
+	p.CellH, err = strconv.Atoi(cellH)
+	if err != nil || p.CellH <= 0 || p.CellH > maxMontageCellSize {
+		return montageParams{}, fmt.Errorf("invalid montage cell '%s': expected WxH up to %d", values["cell"], maxMontageCellSize)
+	}
+	if err := checkSheetSize(p.Cols, p.Rows, p.CellW, p.CellH); err != nil {
+		return montageParams{}, fmt.Errorf("invalid montage parameters: %v", err)
+	}
+
+	if v, ok := values["background"]; ok {
+		if p.Background, err = parseHexColor(v); err != nil {
+			return montageParams{}, err
+		}
+	}
+	return p, nil
+}
+
+// MontageCells повертає кількість клітинок сітки для params дії montage,
+// щоб API міг перевірити кількість завантажених файлів до постановки завдання.
+func MontageCells(params string) (int, error) {
+	p, err := parseMontageParams(params)
+	if err != nil {
+		return 0, err
+	}
+	return p.Cols * p.Rows, nil
+}
+
+// applyMontage складає зображення у сітку cols x rows (по рядках), вписуючи кожне в клітинку
+// зі збереженням пропорцій. Клітинки без зображень залишаються кольору фону.
+func applyMontage(imgs []image.Image, params string) (image.Image, error) {
+	p, err := parseMontageParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("montage requires at least one image")
+	}
+	if len(imgs) > p.Cols*p.Rows {
+		return nil, fmt.Errorf("montage grid %dx%d has room for %d images, got %d", p.Cols, p.Rows, p.Cols*p.Rows, len(imgs))
+	}
+
+	return composeGrid(imgs, p), nil
+}
+
+// composeGrid розкладає зображення по клітинках сітки (по рядках) на полотні кольору фону.
+func composeGrid(imgs []image.Image, p montageParams) image.Image {
+	sheet := image.NewRGBA(image.Rect(0, 0, p.Cols*p.CellW, p.Rows*p.CellH))
+	draw.Draw(sheet, sheet.Bounds(), &image.Uniform{C: p.Background}, image.Point{}, draw.Src)
+
+	for i, img := range imgs {
+		cell := resize.Thumbnail(uint(p.CellW), uint(p.CellH), img, resize.Lanczos3)
+		cb := cell.Bounds()
+
+		// Центруємо зменшене зображення у клітинці
+		col, row := i%p.Cols, i/p.Cols
+		offset := image.Pt(col*p.CellW+(p.CellW-cb.Dx())/2, row*p.CellH+(p.CellH-cb.Dy())/2)
+		draw.Draw(sheet, cb.Sub(cb.Min).Add(offset), cell, cb.Min, draw.Over)
+	}
+	return sheet
+}
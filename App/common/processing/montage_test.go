@@ -0,0 +1,57 @@
+package processing
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestParseMontageParamsLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr string
+	}{
+		{"valid", "cols=3,rows=2,cell=200x200", ""},
+		{"cols overflow", "cols=6148914691236517206,rows=3,cell=10x10", "invalid montage cols"},
+		{"rows overflow", "cols=3,rows=6148914691236517206,cell=10x10", "invalid montage rows"},
+		{"too many cells", "cols=20,rows=20,cell=10x10", "exceeds the limit of 100 cells"},
+		{"sheet too large", "cols=100,rows=1,cell=2000x2000", "exceeds the limit of 50000000 pixels"},
+		{"largest allowed sheet", "cols=5,rows=2,cell=2000x2000", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate("montage", tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate(%q) = %v, want nil", tt.params, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate(%q) = %v, want error containing %q", tt.params, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMontageCells(t *testing.T) {
+	if n, err := MontageCells("cols=6148914691236517206,rows=3,cell=10x10"); err == nil {
+		t.Fatalf("MontageCells accepted an overflowing grid: %d cells", n)
+	}
+	n, err := MontageCells("cols=4,rows=3,cell=10x10")
+	if err != nil || n != 12 {
+		t.Fatalf("MontageCells = %d, %v; want 12, nil", n, err)
+	}
+}
+
+func TestApplyMontageSize(t *testing.T) {
+	imgs := []image.Image{image.NewRGBA(image.Rect(0, 0, 40, 20)), image.NewRGBA(image.Rect(0, 0, 20, 40))}
+	sheet, err := applyMontage(imgs, "cols=2,rows=2,cell=30x30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sheet.Bounds().Size(); got != image.Pt(60, 60) {
+		t.Fatalf("sheet size = %v, want (60,60)", got)
+	}
+}
@@ -0,0 +1,314 @@
+package processing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/tiff"
+)
+
+// OutputOptions - параметри кодування результату. Передаються останнім сегментом params
+// після ';', наприклад "800x600;quality=75", "format=png" або "quality=90,flatten=ffffff".
+// Сюди ж належить page - вибір сторінки багатосторінкового TIFF при читанні входу.
+type OutputOptions struct {
+	Format      string // формат результату: jpeg, png, webp, tiff або smart (див. ForImage)
+	Quality     int    // якість JPEG або WebP, 1-100; 0 - за замовчуванням для формату (EffectiveQuality)
+	Subsampling string // субдискретизація кольору JPEG
+	Progressive bool   // прогресивний JPEG замість базового
+	DPI         int    // роздільність для друку в метаданих JPEG/PNG/TIFF; 0 - не записувати
+	// PreserveMetadata - перенести EXIF/XMP/ICC/IPTC вхідного JPEG у результат (за замовчуванням вони відкидаються)
+	PreserveMetadata bool
+	// Metadata - сегменти метаданих входу (ReadJPEGMetadata), які заповнює сервіс при PreserveMetadata
+	Metadata []byte
+	// KeepICC - зберегти ICC-профіль входу в результаті JPEG/PNG (icc=keep); за замовчуванням
+	// профіль відкидається (icc=strip), і кольори не-sRGB входів можуть зміститися
+	KeepICC bool
+	// ICCProfile - профіль входу (ExtractICCProfile), який заповнює сервіс при KeepICC
+	ICCProfile []byte
+	// Background - колір, на який накладаються прозорі області перед кодуванням у JPEG
+	Background color.NRGBA
+	// Page - сторінка багатосторінкового TIFF (з 1), яку треба обробити
+	Page int
+	// PNGCompression - рівень стиснення PNG (лише з DEFAULT_PNG_COMPRESSION, без параметра запиту)
+	PNGCompression png.CompressionLevel
+}
+
+// DefaultOutputOptions відповідають поведінці до появи параметрів кодування.
+var DefaultOutputOptions = OutputOptions{Format: "jpeg", Subsampling: "420", Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, Page: 1, PNGCompression: png.DefaultCompression}
+
+// defaultJPEGQuality - якість JPEG, коли quality не задано в запиті (DEFAULT_JPEG_QUALITY)
+var defaultJPEGQuality = 90
+
+// defaultWebPQuality - якість WebP, коли quality не задано в запиті
+const defaultWebPQuality = 90
+
+// pngCompressionLevels - назви рівнів стиснення PNG для DEFAULT_PNG_COMPRESSION
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// outputOptionKeys - ключі, за якими сегмент params розпізнається як параметри кодування.
+var outputOptionKeys = map[string]bool{"format": true, "quality": true, "subsampling": true, "flatten": true, "page": true, "progressive": true, "dpi": true, "preserve_metadata": true, "icc": true}
+
+// SplitOutputOptions відокремлює параметри кодування від параметрів дії.
+// Сегмент вважається параметрами кодування лише якщо всі його пари key=value мають відомі ключі.
+func SplitOutputOptions(params string) (string, OutputOptions, error) {
+	opts := DefaultOutputOptions
+
+	actionParams, candidate := "", params
+	if idx := strings.LastIndex(params, ";"); idx >= 0 {
+		actionParams, candidate = params[:idx], params[idx+1:]
+	}
+
+	pairs := strings.Split(candidate, ",")
+	for _, pair := range pairs {
+		key, _, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !outputOptionKeys[key] {
+			// Це не параметри кодування - весь рядок належить дії
+			return params, opts, nil
+		}
+	}
+
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		switch key {
+		case "format":
+			switch value {
+			case "jpeg", "jpg":
+				opts.Format = "jpeg"
+			case "png", "webp", "tiff":
+				opts.Format = value
+			case "tif":
+				opts.Format = "tiff"
+			case FormatSmart:
+				opts.Format = value
+			default:
+				return "", opts, fmt.Errorf("unsupported format '%s': expected jpeg, png, webp, tiff or smart", value)
+			}
+		case "quality":
+			quality, err := strconv.Atoi(value)
+			if err != nil || quality < 1 || quality > 100 {
+				return "", opts, fmt.Errorf("invalid quality '%s': expected integer 1-100", value)
+			}
+			opts.Quality = quality
+		case "subsampling":
+			// 4:2:2 кодувальник не підтримує, тож він відхиляється явно, а не ігнорується мовчки
+			if value != "420" && value != "444" {
+				return "", opts, fmt.Errorf("unsupported subsampling '%s': expected 420 or 444", value)
+			}
+			opts.Subsampling = value
+		case "page":
+			page, err := strconv.Atoi(value)
+			if err != nil || page < 1 {
+				return "", opts, fmt.Errorf("invalid page '%s': expected positive integer", value)
+			}
+			opts.Page = page
+		case "progressive":
+			progressive, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", opts, fmt.Errorf("invalid progressive '%s': expected true or false", value)
+			}
+			opts.Progressive = progressive
+		case "preserve_metadata":
+			preserve, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", opts, fmt.Errorf("invalid preserve_metadata '%s': expected true or false", value)
+			}
+			opts.PreserveMetadata = preserve
+		case "icc":
+			switch value {
+			case "keep":
+				opts.KeepICC = true
+			case "strip":
+				opts.KeepICC = false
+			default:
+				return "", opts, fmt.Errorf("invalid icc '%s': expected keep or strip", value)
+			}
+		case "dpi":
+			dpi, err := strconv.Atoi(value)
+			if err != nil || dpi < 1 || dpi > maxDPI {
+				return "", opts, fmt.Errorf("invalid dpi '%s': expected integer 1-%d", value, maxDPI)
+			}
+			opts.DPI = dpi
+		case "flatten":
+			background, err := parseHexColor(value)
+			if err != nil {
+				return "", opts, err
+			}
+			// JPEG не має альфа-каналу, тому фон завжди непрозорий
+			background.A = 0xff
+			opts.Background = background
+		}
+	}
+
+	if opts.Progressive && opts.Format != "jpeg" {
+		return "", opts, fmt.Errorf("progressive is only supported for JPEG output")
+	}
+	if opts.PreserveMetadata && opts.Format != "jpeg" {
+		return "", opts, fmt.Errorf("preserve_metadata is only supported for JPEG output")
+	}
+	if opts.KeepICC && opts.Format != "jpeg" && opts.Format != "png" && opts.Format != FormatSmart {
+		return "", opts, fmt.Errorf("icc=keep is only supported for JPEG and PNG output")
+	}
+	if opts.DPI > 0 && opts.Format == "webp" {
+		return "", opts, fmt.Errorf("dpi is only supported for JPEG, PNG and TIFF output")
+	}
+	return actionParams, opts, nil
+}
+
+// EffectiveQuality повертає якість кодування: задану в запиті або типову для формату
+func (o OutputOptions) EffectiveQuality() int {
+	if o.Quality > 0 {
+		return o.Quality
+	}
+	if o.Format == "webp" {
+		return defaultWebPQuality
+	}
+	return defaultJPEGQuality
+}
+
+// SetDefaultJPEGQuality змінює якість JPEG за замовчуванням (змінна DEFAULT_JPEG_QUALITY),
+// що діє, коли в params не задано quality.
+func SetDefaultJPEGQuality(value string) error {
+	quality, err := strconv.Atoi(value)
+	if err != nil || quality < 1 || quality > 100 {
+		return fmt.Errorf("expected integer 1-100")
+	}
+	defaultJPEGQuality = quality
+	return nil
+}
+
+// SetDefaultPNGCompression змінює рівень стиснення PNG (змінна DEFAULT_PNG_COMPRESSION):
+// default, none, speed або best. Впливає лише на розмір файлу і час кодування, не на пікселі.
+func SetDefaultPNGCompression(value string) error {
+	level, ok := pngCompressionLevels[value]
+	if !ok {
+		return fmt.Errorf("expected default, none, speed or best")
+	}
+	DefaultOutputOptions.PNGCompression = level
+	return nil
+}
+
+// SetDefaultBackground змінює колір фону для JPEG за замовчуванням (змінна JPEG_BACKGROUND),
+// що діє, коли в params не задано flatten.
+func SetDefaultBackground(value string) error {
+	background, err := parseHexColor(value)
+	if err != nil {
+		return err
+	}
+	background.A = 0xff
+	DefaultOutputOptions.Background = background
+	return nil
+}
+
+// Extension повертає розширення файлу результату (з крапкою).
+func (o OutputOptions) Extension() string {
+	switch o.Format {
+	case "png":
+		return ".png"
+	case "webp":
+		return ".webp"
+	case "tiff":
+		return ".tiff"
+	}
+	return ".jpg"
+}
+
+// ContentType повертає MIME-тип результату.
+func (o OutputOptions) ContentType() string {
+	switch o.Format {
+	case "png":
+		return "image/png"
+	case "webp":
+		return "image/webp"
+	case "tiff":
+		return "image/tiff"
+	}
+	return "image/jpeg"
+}
+
+// Encode кодує зображення у формат з параметрів кодування.
+// PNG і TIFF стискаються без втрат і зберігають 16 бітів на канал, тому quality і subsampling
+// для них не використовуються; WebP використовує лише quality. З opts.DPI результат кодується
+// в пам'ять, щоб дописати роздільність у метадані (див. setDensity); так само з opts.Metadata
+// у JPEG вставляються сегменти метаданих входу, а з opts.ICCProfile - ICC-профіль.
+func Encode(w io.Writer, img image.Image, opts OutputOptions) error {
+	opts = opts.ForImage(img)
+	withMetadata := len(opts.Metadata) > 0 && opts.Format == "jpeg"
+	// Метадані JPEG-входу вже містять його профіль (APP2)
+	// CMYK-профіль не описує RGB-результат (див. NormalizeColorSpace)
+	withICC := len(opts.ICCProfile) > 0 && !withMetadata && (opts.Format == "jpeg" || opts.Format == "png") &&
+		iccColorSpace(opts.ICCProfile) != "CMYK"
+	if opts.DPI == 0 && !withMetadata && !withICC {
+		return encode(w, img, opts)
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, img, opts); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	var err error
+	if opts.DPI > 0 {
+		if data, err = setDensity(data, opts.Format, opts.DPI); err != nil {
+			return err
+		}
+	}
+	if withMetadata {
+		if data, err = insertJPEGSegments(data, withoutCMYKProfile(opts.Metadata)); err != nil {
+			return err
+		}
+	}
+	if withICC && opts.Format == "jpeg" {
+		if data, err = insertJPEGSegments(data, jpegICCSegments(opts.ICCProfile)); err != nil {
+			return err
+		}
+	} else if withICC {
+		if data, err = insertPNGICC(data, opts.ICCProfile); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encode(w io.Writer, img image.Image, opts OutputOptions) error {
+	switch opts.Format {
+	case "png":
+		encoder := png.Encoder{CompressionLevel: opts.PNGCompression}
+		return encoder.Encode(w, img)
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+	case "webp":
+		return webp.Encode(w, img, webp.Options{Quality: opts.EffectiveQuality(), Method: webp.DefaultMethod})
+	}
+	return EncodeJPEG(w, img, opts)
+}
+
+// EncodeJPEG кодує зображення у JPEG відповідно до параметрів кодування.
+// JPEG не має прозорості, тому зображення спершу накладається на колір opts.Background
+// (інакше прозорі області стали б чорними). Прогресивний JPEG і колір 4:4:4 пише власний
+// кодувальник, бо image/jpeg вміє лише базовий JPEG з 4:2:0.
+func EncodeJPEG(w io.Writer, img image.Image, opts OutputOptions) error {
+	bounds := img.Bounds()
+	rgbaImg := image.NewRGBA(bounds)
+	draw.Draw(rgbaImg, bounds, &image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+	draw.Draw(rgbaImg, bounds, img, bounds.Min, draw.Over)
+
+	if opts.Progressive || opts.Subsampling == "444" {
+		return encodeCustomJPEG(w, rgbaImg, opts.EffectiveQuality(), opts.Progressive, opts.Subsampling != "444")
+	}
+	return jpeg.Encode(w, rgbaImg, &jpeg.Options{Quality: opts.EffectiveQuality()})
+}
@@ -0,0 +1,78 @@
+package processing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// semiTransparentPNG - PNG 48x16 з трьох плашок 16x16 червоного кольору з альфою 0, 128 і 255
+func semiTransparentPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 48, 16))
+	for x := range 48 {
+		alpha := []uint8{0, 128, 255}[x/16]
+		for y := range 16 {
+			img.SetNRGBA(x, y, color.NRGBA{255, 0, 0, alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeJPEGFlattensTransparency(t *testing.T) {
+	src, err := png.Decode(bytes.NewReader(semiTransparentPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Очікуваний колір - червоний, накладений на фон з альфою плашки: (fg*a + bg*(255-a)) / 255
+	blend := func(fg, bg uint8, alpha int) uint8 { return uint8((int(fg)*alpha + int(bg)*(255-alpha) + 127) / 255) }
+	tests := []struct {
+		name       string
+		params     string
+		background color.RGBA
+	}{
+		{"default white", "quality=100", color.RGBA{255, 255, 255, 255}},
+		{"custom color", "quality=100,flatten=00ff00", color.RGBA{0, 255, 0, 255}},
+		{"dark background", "quality=100,flatten=202040", color.RGBA{0x20, 0x20, 0x40, 255}},
+		{"progressive", "quality=100,progressive=true,flatten=0000ff", color.RGBA{0, 0, 255, 255}},
+		{"4:4:4", "quality=100,subsampling=444,flatten=00ff00", color.RGBA{0, 255, 0, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, opts, err := SplitOutputOptions(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := Encode(&buf, src, opts); err != nil {
+				t.Fatal(err)
+			}
+			out, err := jpeg.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, alpha := range []int{0, 128, 255} {
+				bg := tt.background
+				want := color.RGBA{blend(255, bg.R, alpha), blend(0, bg.G, alpha), blend(0, bg.B, alpha), 255}
+				r, g, b, _ := out.At(16*i+8, 8).RGBA()
+				got := [3]int{int(r >> 8), int(g >> 8), int(b >> 8)}
+				for ch, w := range []uint8{want.R, want.G, want.B} {
+					// Допуск на втрати JPEG і перетворення YCbCr
+					if d := got[ch] - int(w); d > 6 || d < -6 {
+						t.Errorf("alpha %d over %v = %v, want %v", alpha, bg, got, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
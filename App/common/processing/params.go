@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// parseKeyValueParams розбирає params у форматі "key=value,key=value".
+// Ключі, яких немає в allowed, вважаються помилкою, щоб друкарські помилки не ігнорувалися мовчки.
+func parseKeyValueParams(params string, allowed ...string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(params) == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid parameter '%s': expected key=value", pair)
+		}
+		known := false
+		for _, a := range allowed {
+			if key == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown parameter '%s': allowed %s", key, strings.Join(allowed, ", "))
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// parseHexColor розбирає колір у форматі "RRGGBB" або "RRGGBBAA" (з необов'язковим '#').
+func parseHexColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s': expected RRGGBB or RRGGBBAA hex", value)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s': expected RRGGBB or RRGGBBAA hex", value)
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
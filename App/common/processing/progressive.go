@@ -0,0 +1,409 @@
+package processing
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Власний кодувальник JPEG. Стандартний image/jpeg вміє лише базовий режим з кольором 4:2:0, тому
+// тут реалізовано прогресивний режим і колір 4:4:4. Прогресивний варіант найпростіший: спектральна
+// селекція без послідовного наближення. Спершу передаються DC-коефіцієнти всіх компонент (браузер
+// показує розмиту копію), далі низькочастотні AC яскравості, AC кольору і решта AC яскравості.
+// Таблиці квантування і Хаффмана - стандартні з додатка K ITU T.81.
+
+// zigzag[k] - індекс у природному порядку (рядок*8+стовпець) k-го коефіцієнта в зигзаг-порядку
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// baseQuant - таблиці квантування для якості 50 у природному порядку: яскравість і колір
+var baseQuant = [2][64]int{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// huffmanSpec - таблиця Хаффмана у вигляді сегмента DHT: кількість кодів кожної довжини 1-16 і символи
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+// Порядок таблиць: DC яскравості, AC яскравості, DC кольору, AC кольору
+var huffmanSpecs = [4]huffmanSpec{
+	{
+		counts: [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		counts: [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		values: []byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12, 0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08, 0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		counts: [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		values: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		counts: [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		values: []byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21, 0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91, 0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34, 0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// huffmanCode - канонічні коди Хаффмана для кожного символу таблиці
+type huffmanCode struct {
+	code [256]uint32
+	size [256]uint
+}
+
+func buildHuffmanCode(spec huffmanSpec) *huffmanCode {
+	h := &huffmanCode{}
+	code, k := uint32(0), 0
+	for length := 1; length <= 16; length++ {
+		for i := 0; i < int(spec.counts[length-1]); i++ {
+			h.code[spec.values[k]] = code
+			h.size[spec.values[k]] = uint(length)
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return h
+}
+
+// progressiveScan - одне сканування AC: компонента (0 - Y, 1 - Cb, 2 - Cr) і діапазон коефіцієнтів
+type progressiveScan struct {
+	component int
+	ss, se    int
+}
+
+var progressiveACScans = []progressiveScan{
+	{0, 1, 5},
+	{1, 1, 63},
+	{2, 1, 63},
+	{0, 6, 63},
+}
+
+// dctCos[u][x] = C(u)/2 * cos((2x+1)uπ/16) - множники прямого ДКП 8x8
+var dctCos = func() (t [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		c := 0.5
+		if u == 0 {
+			c = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			t[u][x] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// jpegBitWriter пише коди старшими бітами вперед, вставляючи 0x00 після кожного байта 0xFF
+type jpegBitWriter struct {
+	w    *bufio.Writer
+	bits uint32
+	n    uint
+}
+
+func (b *jpegBitWriter) emit(value uint32, size uint) {
+	value &= 1<<size - 1
+	total := b.n + size
+	acc := b.bits | value<<(32-total)
+	for total >= 8 {
+		c := byte(acc >> 24)
+		b.w.WriteByte(c)
+		if c == 0xff {
+			b.w.WriteByte(0)
+		}
+		acc <<= 8
+		total -= 8
+	}
+	b.bits, b.n = acc, total
+}
+
+// emitValue кодує коефіцієнт (або різницю DC) символом Хаффмана з категорією розміру та додатковими бітами
+func (b *jpegBitWriter) emitValue(h *huffmanCode, run int, v int32) {
+	a := v
+	if a < 0 {
+		a, v = -a, v-1
+	}
+	size := uint(bits.Len32(uint32(a)))
+	symbol := byte(run<<4) | byte(size)
+	b.emit(h.code[symbol], h.size[symbol])
+	if size > 0 {
+		b.emit(uint32(v), size)
+	}
+}
+
+// flush доповнює останній байт одиничними бітами наприкінці сканування
+func (b *jpegBitWriter) flush() {
+	b.emit(0x7f, 7)
+	b.bits, b.n = 0, 0
+}
+
+// encodeCustomJPEG кодує непрозоре RGBA-зображення у JPEG з якістю 1-100: прогресивний (SOF2) або
+// базовий (SOF0), з кольором 4:2:0 або без субдискретизації (4:4:4, subsample = false).
+func encodeCustomJPEG(w io.Writer, img *image.RGBA, quality int, progressive, subsample bool) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > 0xffff || height > 0xffff {
+		return errors.New("jpeg: image dimensions must be between 1 and 65535")
+	}
+
+	// Масштабування таблиць за якістю - як у libjpeg та image/jpeg
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var quant [2][64]int
+	for t := range quant {
+		for i, q := range baseQuant[t] {
+			quant[t][i] = min(max((q*scale+50)/100, 1), 255)
+		}
+	}
+
+	// s - кількість блоків яскравості на блок кольору по кожній осі: MCU 16x16 для 4:2:0, 8x8 для 4:4:4
+	s := 1
+	if subsample {
+		s = 2
+	}
+	mcuSize := 8 * s
+
+	// Коефіцієнти всіх блоків (у зигзаг-порядку) потрібні для кількох сканувань.
+	// Сітка Y покриває MCU повністю, краї зображення повторюються.
+	mcuCols, mcuRows := (width+mcuSize-1)/mcuSize, (height+mcuSize-1)/mcuSize
+	yCols := s * mcuCols
+	coeffs := [3][][64]int16{
+		make([][64]int16, yCols*s*mcuRows),
+		make([][64]int16, mcuCols*mcuRows),
+		make([][64]int16, mcuCols*mcuRows),
+	}
+
+	var planes [3][16][16]float64
+	for my := 0; my < mcuRows; my++ {
+		for mx := 0; mx < mcuCols; mx++ {
+			for y := 0; y < mcuSize; y++ {
+				py := min(my*mcuSize+y, height-1)
+				for x := 0; x < mcuSize; x++ {
+					px := min(mx*mcuSize+x, width-1)
+					off := img.PixOffset(bounds.Min.X+px, bounds.Min.Y+py)
+					r, g, b := float64(img.Pix[off]), float64(img.Pix[off+1]), float64(img.Pix[off+2])
+					planes[0][y][x] = 0.299*r + 0.587*g + 0.114*b - 128
+					planes[1][y][x] = -0.168736*r - 0.331264*g + 0.5*b
+					planes[2][y][x] = 0.5*r - 0.418688*g - 0.081312*b
+				}
+			}
+
+			for i := 0; i < s*s; i++ {
+				bx, by := i%s, i/s
+				var block [8][8]float64
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						block[y][x] = planes[0][by*8+y][bx*8+x]
+					}
+				}
+				coeffs[0][(my*s+by)*yCols+mx*s+bx] = forwardDCT(&block, &quant[0])
+			}
+			for c := 1; c < 3; c++ {
+				// Блок кольору - середнє s x s пікселів (для 4:4:4 - самі пікселі)
+				var block [8][8]float64
+				p := &planes[c]
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						var sum float64
+						for dy := 0; dy < s; dy++ {
+							for dx := 0; dx < s; dx++ {
+								sum += p[s*y+dy][s*x+dx]
+							}
+						}
+						block[y][x] = sum / float64(s*s)
+					}
+				}
+				coeffs[c][my*mcuCols+mx] = forwardDCT(&block, &quant[1])
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{0xff, 0xd8})
+
+	// DQT: обидві таблиці у зигзаг-порядку
+	bw.Write([]byte{0xff, 0xdb, 0, 2 + 2*65})
+	for t := range quant {
+		bw.WriteByte(byte(t))
+		for k := 0; k < 64; k++ {
+			bw.WriteByte(byte(quant[t][zigzag[k]]))
+		}
+	}
+
+	// SOF0 або SOF2: Y s x s з таблицею 0, Cb і Cr 1x1 з таблицею 1
+	sof := byte(0xc0)
+	if progressive {
+		sof = 0xc2
+	}
+	bw.Write([]byte{0xff, sof, 0, 17, 8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 3,
+		1, byte(s<<4 | s), 0, 2, 0x11, 1, 3, 0x11, 1})
+
+	// DHT: класи/ідентифікатори DC0, AC0, DC1, AC1 відповідають порядку huffmanSpecs
+	dhtLen := 2
+	for _, spec := range huffmanSpecs {
+		dhtLen += 17 + len(spec.values)
+	}
+	bw.Write([]byte{0xff, 0xc4, byte(dhtLen >> 8), byte(dhtLen)})
+	var codes [4]*huffmanCode
+	for i, spec := range huffmanSpecs {
+		bw.WriteByte([]byte{0x00, 0x10, 0x01, 0x11}[i])
+		bw.Write(spec.counts[:])
+		bw.Write(spec.values)
+		codes[i] = buildHuffmanCode(spec)
+	}
+	dcCode := func(c int) *huffmanCode { return codes[min(c, 1)*2] }
+	acCode := func(c int) *huffmanCode { return codes[min(c, 1)*2+1] }
+
+	enc := &jpegBitWriter{w: bw}
+
+	// Перше сканування - усі компоненти разом, по MCU: лише DC у прогресивному режимі,
+	// усі 64 коефіцієнти - у базовому (тоді воно й єдине)
+	se := byte(63)
+	if progressive {
+		se = 0
+	}
+	bw.Write([]byte{0xff, 0xda, 0, 12, 3, 1, 0x00, 2, 0x11, 3, 0x11, 0, se, 0})
+	var pred [3]int32
+	encodeBlock := func(c int, block *[64]int16) {
+		dc := int32(block[0])
+		enc.emitValue(dcCode(c), 0, dc-pred[c])
+		pred[c] = dc
+		if !progressive {
+			enc.emitAC(acCode(c), block, 1, 63)
+		}
+	}
+	for my := 0; my < mcuRows; my++ {
+		for mx := 0; mx < mcuCols; mx++ {
+			for i := 0; i < s*s; i++ {
+				encodeBlock(0, &coeffs[0][(my*s+i/s)*yCols+mx*s+i%s])
+			}
+			for c := 1; c < 3; c++ {
+				encodeBlock(c, &coeffs[c][my*mcuCols+mx])
+			}
+		}
+	}
+	enc.flush()
+
+	if progressive {
+		// Сканування AC: по одній компоненті; блоки - лише ті, що перетинають зображення
+		for _, scan := range progressiveACScans {
+			table := byte(0x00)
+			cols, rows, stride := (width+7)/8, (height+7)/8, yCols
+			if scan.component > 0 {
+				table = 0x11
+				cols, rows, stride = mcuCols, mcuRows, mcuCols
+			}
+			bw.Write([]byte{0xff, 0xda, 0, 8, 1, byte(scan.component + 1), table, byte(scan.ss), byte(scan.se), 0})
+
+			h := acCode(scan.component)
+			for by := 0; by < rows; by++ {
+				for bx := 0; bx < cols; bx++ {
+					enc.emitAC(h, &coeffs[scan.component][by*stride+bx], scan.ss, scan.se)
+				}
+			}
+			enc.flush()
+		}
+	}
+
+	bw.Write([]byte{0xff, 0xd9})
+	return bw.Flush()
+}
+
+// emitAC кодує AC-коефіцієнти блоку з діапазону ss-se довжинами серій нулів
+func (b *jpegBitWriter) emitAC(h *huffmanCode, block *[64]int16, ss, se int) {
+	run := 0
+	for k := ss; k <= se; k++ {
+		if block[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			b.emit(h.code[0xf0], h.size[0xf0])
+		}
+		b.emitValue(h, run, int32(block[k]))
+		run = 0
+	}
+	if run > 0 {
+		// EOB: решта коефіцієнтів діапазону в цьому блоці нульові
+		b.emit(h.code[0x00], h.size[0x00])
+	}
+}
+
+// forwardDCT виконує пряме ДКП блоку 8x8 і квантує коефіцієнти, повертаючи їх у зигзаг-порядку
+func forwardDCT(block *[8][8]float64, quant *[64]int) [64]int16 {
+	var tmp [8][8]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += dctCos[u][x] * block[y][x]
+			}
+			tmp[y][u] = s
+		}
+	}
+
+	var out [64]int16
+	for k := 0; k < 64; k++ {
+		i := zigzag[k]
+		v, u := i/8, i%8
+		var s float64
+		for y := 0; y < 8; y++ {
+			s += dctCos[v][y] * tmp[y][u]
+		}
+		out[k] = int16(math.Round(s / float64(quant[i])))
+	}
+	return out
+}
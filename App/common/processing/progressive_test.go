@@ -0,0 +1,116 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegFrame повертає маркер SOFn першого кадру (0xC0 - базовий, 0xC2 - прогресивний) і байт
+// коефіцієнтів дискретизації першої компоненти (0x22 - колір 4:2:0, 0x11 - 4:4:4)
+func jpegFrame(data []byte) (marker, sampling byte, err error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, 0, fmt.Errorf("missing SOI")
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return 0, 0, fmt.Errorf("expected a marker at %d", pos)
+		}
+		marker := data[pos+1]
+		if marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc {
+			// SOFn: довжина(2), точність(1), висота(2), ширина(2), кількість компонент(1), id(1), дискретизація(1)
+			if pos+12 > len(data) {
+				return 0, 0, fmt.Errorf("truncated SOF")
+			}
+			return marker, data[pos+11], nil
+		}
+		pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+	}
+	return 0, 0, fmt.Errorf("no SOF marker")
+}
+
+func TestProgressiveJPEG(t *testing.T) {
+	// 67x45 - розміри не кратні MCU 16x16, тож перевіряються і крайові блоки
+	img := photoImage(67, 45)
+	for _, quality := range []int{30, 50, 75, 90} {
+		t.Run(fmt.Sprintf("quality %d", quality), func(t *testing.T) {
+			var baseline, progressive bytes.Buffer
+			if err := Encode(&baseline, img, OutputOptions{Format: "jpeg", Quality: quality}); err != nil {
+				t.Fatal(err)
+			}
+			if err := Encode(&progressive, img, OutputOptions{Format: "jpeg", Quality: quality, Progressive: true}); err != nil {
+				t.Fatal(err)
+			}
+
+			if marker, _, err := jpegFrame(progressive.Bytes()); err != nil || marker != 0xc2 {
+				t.Fatalf("progressive frame marker = %#x, %v; want SOF2 (0xc2)", marker, err)
+			}
+			if marker, _, err := jpegFrame(baseline.Bytes()); err != nil || marker != 0xc0 {
+				t.Fatalf("default frame marker = %#x, %v; want baseline SOF0 (0xc0)", marker, err)
+			}
+
+			decodedProgressive, err := jpeg.Decode(bytes.NewReader(progressive.Bytes()))
+			if err != nil {
+				t.Fatalf("progressive output does not decode: %v", err)
+			}
+			if decodedProgressive.Bounds() != img.Bounds() {
+				t.Fatalf("decoded bounds = %v, want %v", decodedProgressive.Bounds(), img.Bounds())
+			}
+			decodedBaseline, err := jpeg.Decode(bytes.NewReader(baseline.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Ті самі таблиці квантування і субдискретизація: похибка має бути порівнянною з базовою
+			got, want := psnr(img, decodedProgressive), psnr(img, decodedBaseline)
+			if got < want-1.5 {
+				t.Fatalf("progressive PSNR %.2f dB, baseline %.2f dB", got, want)
+			}
+		})
+	}
+}
+
+func TestJPEGSubsampling444(t *testing.T) {
+	// 67x45 - розміри не кратні MCU 8x8, тож перевіряються і крайові блоки
+	img := photoImage(67, 45)
+	var subsampled bytes.Buffer
+	if err := Encode(&subsampled, img, OutputOptions{Format: "jpeg", Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	decodedSubsampled, err := jpeg.Decode(bytes.NewReader(subsampled.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, progressive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("progressive %v", progressive), func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := OutputOptions{Format: "jpeg", Quality: 90, Subsampling: "444", Progressive: progressive}
+			if err := Encode(&buf, img, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			wantMarker := byte(0xc0)
+			if progressive {
+				wantMarker = 0xc2
+			}
+			if marker, sampling, err := jpegFrame(buf.Bytes()); err != nil || marker != wantMarker || sampling != 0x11 {
+				t.Fatalf("frame = %#x with sampling %#x, %v; want %#x with 4:4:4 (0x11)", marker, sampling, err, wantMarker)
+			}
+
+			decoded, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("4:4:4 output does not decode: %v", err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("decoded bounds = %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+			// Без субдискретизації колір точніший, тож похибка не більша, ніж у 4:2:0
+			if got, want := psnr(img, decoded), psnr(img, decodedSubsampled); got < want {
+				t.Fatalf("4:4:4 PSNR %.2f dB, 4:2:0 %.2f dB", got, want)
+			}
+		})
+	}
+}
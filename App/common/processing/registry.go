@@ -0,0 +1,394 @@
+// Package processing містить дії обробки зображень і їхній реєстр, спільні для API та Worker.
+// Нова дія додається одним записом у actions: API використовує його для перевірки params,
+// Worker - для виконання.
+package processing
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// Action описує одну дію обробки зображень.
+type Action struct {
+	// RequiresParams - чи обов'язкові params для цієї дії
+	RequiresParams bool
+	// Params - опис формату params для клієнтів і повідомлень про помилки ("" - дія без params)
+	Params string
+	// Validate перевіряє params до постановки завдання в чергу (без декодування зображення)
+	Validate func(params string) error
+	// Apply виконує дію і повертає одне зображення
+	Apply func(img image.Image, params string) (image.Image, error)
+	// ApplyMulti виконує дію, що створює кілька іменованих результатів (замість Apply)
+	ApplyMulti func(img image.Image, params string) ([]NamedImage, error)
+	// Combine виконує дію над кількома вхідними зображеннями (замість Apply)
+	Combine func(imgs []image.Image, params string) (image.Image, error)
+	// ApplyFrames виконує дію над усіма кадрами анімованого зображення (замість Apply)
+	ApplyFrames func(frames []image.Image, params string) (image.Image, error)
+	// FrameLimit, якщо задано, - скільки рівномірно розподілених кадрів потрібно ApplyFrames
+	// (див. DecodeGIFFrames); без нього передаються всі кадри
+	FrameLimit func(params string) int
+	// OutputFormat, якщо задано, завжди використовується для результату замість format з params
+	OutputFormat string
+	// InputFormats - формати вхідного файлу (як їх називає image.Decode), з якими працює дія;
+	// порожній список означає будь-який підтримуваний формат
+	InputFormats []string
+}
+
+// NamedImage - один з результатів дії, що створює кілька вихідних файлів.
+type NamedImage struct {
+	Name  string
+	Image image.Image
+}
+
+// actions - реєстр усіх підтримуваних дій
+var actions = map[string]Action{
+	"grayscale": {
+		Params:   "[mode=luma|average|red|green|blue]",
+		Validate: func(params string) error { _, err := parseGrayscaleParams(params); return err },
+		Apply:    applyGrayscale,
+	},
+	"convert": {
+		Apply: applyConvert,
+	},
+	"resize": {
+		Params:         "[max:|min:]widthxheight[ pad[ #RRGGBB]][ only-shrink][ linear=true][ round=nearest|up|down] or N max",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseResizeParams(params); return err },
+		Apply:          applyResize,
+	},
+	"crop": {
+		Params:         "startX,startY,endX,endY",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseCropParams(params); return err },
+		Apply:          applyCrop,
+	},
+	"cropresize": {
+		Params:         "startX,startY,endX,endY;widthxheight (any resize params)",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, _, err := parseCropResizeParams(params); return err },
+		Apply:          applyCropResize,
+	},
+	"smartcrop": {
+		Params:         "widthxheight or W:H",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseSmartCropParams(params); return err },
+		Apply:          applySmartCrop,
+	},
+	"multicrop": {
+		Params:         "JSON array of {\"name\",\"x\",\"y\",\"w\",\"h\"}",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseMultiCropParams(params); return err },
+		ApplyMulti:     applyMultiCrop,
+	},
+	"border": {
+		Params:         "width=N[,color=RRGGBB][,mode=expand|inset]",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseBorderParams(params); return err },
+		Apply:          applyBorder,
+	},
+	"montage": {
+		Params:         "cols=N,rows=N,cell=WxH[,background=RRGGBB]",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseMontageParams(params); return err },
+		Combine:        applyMontage,
+	},
+	"enhance": {
+		Params:   "[strength 0-1]",
+		Validate: func(params string) error { _, err := parseEnhanceParams(params); return err },
+		Apply:    applyEnhance,
+	},
+	"spritesheet": {
+		Params:         "frames=N,cols=N[,cell=WxH][,background=RRGGBB]",
+		RequiresParams: true,
+		Validate:       func(params string) error { _, err := parseSpriteParams(params); return err },
+		ApplyFrames:    applySpriteSheet,
+		FrameLimit:     spriteFrameLimit,
+		OutputFormat:   "png",
+		InputFormats:   []string{"gif"},
+	},
+	"autostraighten": {
+		Params:   "[max angle in degrees 0-45]",
+		Validate: func(params string) error { _, err := parseStraightenParams(params); return err },
+		Apply:    applyAutoStraighten,
+	},
+}
+
+// disabled - дії, вимкнені на цьому екземплярі через SetEnabled
+var disabled = map[string]bool{}
+
+// SetEnabled залишає увімкненими лише перелічені дії (змінна ENABLED_ACTIONS); порожній
+// список вмикає всі дії. Невідома назва - помилка, щоб друкарська помилка не вимкнула все мовчки.
+func SetEnabled(names []string) error {
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := actions[name]; !ok {
+			return fmt.Errorf("unknown action '%s'", name)
+		}
+		enabled[name] = true
+	}
+
+	disabled = map[string]bool{}
+	if len(enabled) == 0 {
+		return nil
+	}
+	for name := range actions {
+		if !enabled[name] {
+			disabled[name] = true
+		}
+	}
+	return nil
+}
+
+// Enabled перевіряє, що дія існує і не вимкнена на цьому екземплярі.
+func Enabled(name string) error {
+	lower := strings.ToLower(name)
+	if _, ok := actions[lower]; !ok {
+		return fmt.Errorf("unknown image processing action: %s", name)
+	}
+	if disabled[lower] {
+		return fmt.Errorf("action '%s' is disabled on this instance", lower)
+	}
+	return nil
+}
+
+// Lookup повертає увімкнену дію за назвою (без урахування регістру).
+func Lookup(name string) (Action, bool) {
+	lower := strings.ToLower(name)
+	action, ok := actions[lower]
+	if !ok || disabled[lower] {
+		return Action{}, false
+	}
+	return action, true
+}
+
+// Names повертає відсортований список назв усіх увімкнених дій.
+func Names() []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		if !disabled[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActionInfo - опис дії для клієнтів (GET /actions), побудований з реєстру.
+type ActionInfo struct {
+	Name           string `json:"name"`
+	RequiresParams bool   `json:"requires_params"`
+	// Params - формат params дії ("" - дія без params); параметри кодування (format, quality...)
+	// можна додати після ';' для будь-якої дії
+	Params string `json:"params,omitempty"`
+	// Kind - single (одне зображення), multi (кілька результатів), combine (кілька входів)
+	// або frames (усі кадри анімації)
+	Kind          string   `json:"kind"`
+	InputFormats  []string `json:"input_formats"`
+	OutputFormats []string `json:"output_formats"`
+}
+
+// Describe повертає опис усіх увімкнених дій у порядку назв.
+func Describe() []ActionInfo {
+	names := Names()
+	infos := make([]ActionInfo, 0, len(names))
+	for _, name := range names {
+		action := actions[name]
+		info := ActionInfo{
+			Name:           name,
+			RequiresParams: action.RequiresParams,
+			Params:         action.Params,
+			Kind:           "single",
+			InputFormats:   action.InputFormats,
+			OutputFormats:  OutputFormats,
+		}
+		switch {
+		case action.ApplyMulti != nil:
+			info.Kind = "multi"
+		case action.Combine != nil:
+			info.Kind = "combine"
+		case action.ApplyFrames != nil:
+			info.Kind = "frames"
+		}
+		if len(info.InputFormats) == 0 {
+			info.InputFormats = InputFormats()
+		}
+		if action.OutputFormat != "" {
+			info.OutputFormats = []string{action.OutputFormat}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// FieldError - помилка перевірки одного поля запиту.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate перевіряє назву дії та її params (разом з параметрами кодування в кінці params)
+// і повертає першу знайдену помилку.
+func Validate(name, params string) error {
+	if errs := ValidateFields(name, params); len(errs) > 0 {
+		return errors.New(errs[0].Message)
+	}
+	return nil
+}
+
+// ValidateFields перевіряє action і params так само, як Validate, але повертає всі знайдені
+// помилки з прив'язкою до полів запиту, щоб клієнт міг виправити їх за один раз.
+func ValidateFields(name, params string) []FieldError {
+	var errs []FieldError
+
+	action, ok := Lookup(name)
+	if !ok {
+		message := fmt.Sprintf("Invalid action. Allowed: %s", strings.Join(Names(), ", "))
+		if _, exists := actions[strings.ToLower(name)]; exists {
+			message = Enabled(name).Error()
+		}
+		errs = append(errs, FieldError{Field: "action", Message: message})
+	}
+
+	actionParams, _, err := SplitOutputOptions(params)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "params", Message: fmt.Sprintf("invalid output options: %v", err)})
+	}
+	// Params дії перевіряються лише для відомої дії з коректними параметрами кодування
+	if !ok || err != nil {
+		return errs
+	}
+
+	if action.RequiresParams && actionParams == "" {
+		return append(errs, FieldError{Field: "params", Message: fmt.Sprintf("action '%s' requires params: %s", strings.ToLower(name), action.Params)})
+	}
+	if action.Validate != nil {
+		if err := action.Validate(actionParams); err != nil {
+			errs = append(errs, FieldError{Field: "params", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Process виконує дію з одним результатом над зображенням.
+func Process(img image.Image, name, params string) (image.Image, error) {
+	if err := Enabled(name); err != nil {
+		return nil, err
+	}
+	action, _ := Lookup(name)
+	if action.Apply == nil {
+		return nil, fmt.Errorf("action '%s' does not operate on a single image", name)
+	}
+	return action.Apply(img, params)
+}
+
+// maxOutputsPerJob обмежує кількість результатів дії з кількома результатами, щоб одне завдання
+// не створило тисячі файлів і записів job_outputs; 0 - без обмеження
+var maxOutputsPerJob = 100
+
+// SetMaxOutputs задає найбільшу кількість результатів одного завдання (змінна MAX_OUTPUTS_PER_JOB)
+func SetMaxOutputs(n int) {
+	maxOutputsPerJob = n
+}
+
+// checkOutputCount перевіряє, що дія створить не більше maxOutputsPerJob результатів
+func checkOutputCount(n int) error {
+	if maxOutputsPerJob > 0 && n > maxOutputsPerJob {
+		return fmt.Errorf("too many outputs: the job would produce %d, the limit is %d (MAX_OUTPUTS_PER_JOB)", n, maxOutputsPerJob)
+	}
+	return nil
+}
+
+// ProcessMulti виконує дію з кількома результатами над зображенням.
+func ProcessMulti(img image.Image, name, params string) ([]NamedImage, error) {
+	if err := Enabled(name); err != nil {
+		return nil, err
+	}
+	action, _ := Lookup(name)
+	if action.ApplyMulti == nil {
+		return nil, fmt.Errorf("action '%s' produces a single output", name)
+	}
+	results, err := action.ApplyMulti(img, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputCount(len(results)); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// IsMultiOutput повідомляє, чи створює дія кілька результатів.
+func IsMultiOutput(name string) bool {
+	action, ok := Lookup(name)
+	return ok && action.ApplyMulti != nil
+}
+
+// ProcessCombined виконує дію, що об'єднує кілька вхідних зображень в одне.
+func ProcessCombined(imgs []image.Image, name, params string) (image.Image, error) {
+	if err := Enabled(name); err != nil {
+		return nil, err
+	}
+	action, _ := Lookup(name)
+	if action.Combine == nil {
+		return nil, fmt.Errorf("action '%s' does not combine multiple images", name)
+	}
+	return action.Combine(imgs, params)
+}
+
+// IsCombine повідомляє, чи приймає дія кілька вхідних зображень.
+func IsCombine(name string) bool {
+	action, ok := Lookup(name)
+	return ok && action.Combine != nil
+}
+
+// ProcessFrames виконує дію над кадрами анімованого зображення.
+func ProcessFrames(frames []image.Image, name, params string) (image.Image, error) {
+	if err := Enabled(name); err != nil {
+		return nil, err
+	}
+	action, _ := Lookup(name)
+	if action.ApplyFrames == nil {
+		return nil, fmt.Errorf("action '%s' does not operate on animation frames", name)
+	}
+	return action.ApplyFrames(frames, params)
+}
+
+// FrameLimit повертає, скільки кадрів анімації потрібно дії з params (0 - усі).
+func FrameLimit(name, params string) int {
+	action, ok := Lookup(name)
+	if !ok || action.FrameLimit == nil {
+		return 0
+	}
+	return action.FrameLimit(params)
+}
+
+// IsFrames повідомляє, чи працює дія з усіма кадрами анімованого зображення.
+func IsFrames(name string) bool {
+	action, ok := Lookup(name)
+	return ok && action.ApplyFrames != nil
+}
+
+// CheckInput перевіряє, що декодоване зображення підходить для дії, ще до її виконання,
+// щоб завдання завершувалося зрозумілою помилкою, а не неочікуваним результатом.
+func CheckInput(name, format string) error {
+	if err := Enabled(name); err != nil {
+		return err
+	}
+	action, _ := Lookup(name)
+	if len(action.InputFormats) == 0 {
+		return nil
+	}
+	for _, f := range action.InputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("action '%s' requires %s input, got %s", strings.ToLower(name), strings.Join(action.InputFormats, " or "), format)
+}
@@ -0,0 +1,162 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// smartCropProxySize - максимальна сторона зменшеної копії, на якій шукається вікно
+	smartCropProxySize = 256
+	// smartCropCenterBias - наскільки сильно віддається перевага вікнам ближче до центру (0 - без переваги);
+	// прибирає стрибки вікна між майже рівноцінними позиціями на однорідних зображеннях
+	smartCropCenterBias = 0.1
+)
+
+// smartCropParams - розібрані params дії smartcrop: розмір результату (Width x Height) або лише
+// пропорція (Aspect), якщо розмір не задано.
+type smartCropParams struct {
+	Width, Height uint
+	AspectW       int
+	AspectH       int
+}
+
+// parseSmartCropParams розбирає params у форматі "WxH" (обрізати до пропорції W:H і зменшити до WxH)
+// або "W:H" (найбільше вікно з такою пропорцією без зміни масштабу).
+func parseSmartCropParams(params string) (smartCropParams, error) {
+	invalid := fmt.Errorf("invalid smartcrop parameters: expected 'widthxheight' or aspect ratio 'W:H'")
+
+	sep := "x"
+	if strings.Contains(params, ":") {
+		sep = ":"
+	}
+	ws, hs, found := strings.Cut(params, sep)
+	if !found {
+		return smartCropParams{}, invalid
+	}
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return smartCropParams{}, invalid
+	}
+
+	p := smartCropParams{AspectW: w, AspectH: h}
+	if sep == "x" {
+		p.Width, p.Height = uint(w), uint(h)
+	}
+	return p, nil
+}
+
+// applySmartCrop обрізає зображення до заданої пропорції, вибираючи вікно з найбільшою
+// енергією країв (деталі, обличчя, текст), а не центр. Для params "WxH" результат зменшується до WxH.
+func applySmartCrop(img image.Image, params string) (image.Image, error) {
+	p, err := parseSmartCropParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	cropW, cropH := smartCropWindow(bounds.Dx(), bounds.Dy(), p.AspectW, p.AspectH)
+	if cropW == 0 || cropH == 0 {
+		return nil, fmt.Errorf("image %dx%d is too small for smartcrop", bounds.Dx(), bounds.Dy())
+	}
+
+	offset := findSmartCropOffset(img, cropW, cropH)
+	debugf("smartcrop: %dx%d window at %v in %dx%d image", cropW, cropH, offset, bounds.Dx(), bounds.Dy())
+	area := image.Rectangle{Min: bounds.Min.Add(offset), Max: bounds.Min.Add(offset).Add(image.Pt(cropW, cropH))}
+	cropped := cropRect(img, area)
+
+	if p.Width == 0 || (uint(cropW) == p.Width && uint(cropH) == p.Height) {
+		return cropped, nil
+	}
+	return resize.Resize(p.Width, p.Height, cropped, resizeInterpolation(p.Width, p.Height)), nil
+}
+
+// smartCropWindow повертає розмір найбільшого вікна з пропорцією aspectW:aspectH, що вміщується в width x height.
+func smartCropWindow(width, height, aspectW, aspectH int) (int, int) {
+	if int64(width)*int64(aspectH) > int64(height)*int64(aspectW) {
+		// Зображення ширше за пропорцію: вікно на всю висоту
+		return int(int64(height) * int64(aspectW) / int64(aspectH)), height
+	}
+	return width, int(int64(width) * int64(aspectH) / int64(aspectW))
+}
+
+// findSmartCropOffset повертає зсув вікна cropW x cropH відносно початку зображення.
+// Оскільки вікно максимальне, воно рухається лише вздовж однієї осі; енергія країв
+// рахується на зменшеній копії, тож вартість не залежить від розміру зображення.
+func findSmartCropOffset(img image.Image, cropW, cropH int) image.Point {
+	bounds := img.Bounds()
+	if cropW == bounds.Dx() && cropH == bounds.Dy() {
+		return image.Point{}
+	}
+
+	proxy := img
+	if bounds.Dx() > smartCropProxySize || bounds.Dy() > smartCropProxySize {
+		proxy = resize.Thumbnail(smartCropProxySize, smartCropProxySize, img, resize.Bilinear)
+	}
+	pb := proxy.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, pb.Dx(), pb.Dy()))
+	draw.Draw(gray, gray.Bounds(), proxy, pb.Min, draw.Src)
+	w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+
+	// Профіль енергії вздовж осі руху вікна: сума величин градієнта Собеля по стовпцях або рядках
+	horizontal := cropW < bounds.Dx()
+	length := h
+	if horizontal {
+		length = w
+	}
+	profile := make([]float64, length)
+	px := func(x, y int) int { return int(gray.Pix[y*gray.Stride+x]) }
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := px(x+1, y-1) + 2*px(x+1, y) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x-1, y) - px(x-1, y+1)
+			gy := px(x-1, y+1) + 2*px(x, y+1) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x, y-1) - px(x+1, y-1)
+			energy := math.Hypot(float64(gx), float64(gy))
+			if horizontal {
+				profile[x] += energy
+			} else {
+				profile[y] += energy
+			}
+		}
+	}
+
+	// Розмір вікна і діапазон зсувів у координатах копії
+	scale := float64(length) / float64(bounds.Dx())
+	full, window := bounds.Dx(), cropW
+	if !horizontal {
+		scale = float64(length) / float64(bounds.Dy())
+		full, window = bounds.Dy(), cropH
+	}
+	proxyWindow := max(1, min(length, int(math.Round(float64(window)*scale))))
+
+	// Сума у ковзному вікні за префіксними сумами, з легкою перевагою центру
+	prefix := make([]float64, length+1)
+	for i, v := range profile {
+		prefix[i+1] = prefix[i] + v
+	}
+	maxStart := length - proxyWindow
+	best, bestScore := maxStart/2, -1.0
+	for start := 0; start <= maxStart; start++ {
+		score := prefix[start+proxyWindow] - prefix[start]
+		if maxStart > 0 {
+			distance := math.Abs(float64(start)-float64(maxStart)/2) / float64(maxStart)
+			score *= 1 - smartCropCenterBias*distance
+		}
+		if score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+
+	// Повернення до координат оригіналу з обмеженням межами зображення
+	offset := min(full-window, max(0, int(math.Round(float64(best)/scale))))
+	if horizontal {
+		return image.Pt(offset, 0)
+	}
+	return image.Pt(0, offset)
+}
@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// FormatSmart - format=smart: формат результату (JPEG чи PNG) обирається за вмістом зображення
+// після обробки (див. ChooseFormat)
+const FormatSmart = "smart"
+
+// smartMaxColors - найбільша кількість різних кольорів, за якої зображення вважається графікою
+// (логотип, скриншот, схема), що стискається PNG без втрат краще, ніж JPEG
+const smartMaxColors = 256
+
+// smartSamplePixels обмежує кількість пікселів, які перевіряє ChooseFormat: великі зображення
+// проглядаються з кроком, бо точна кількість кольорів не потрібна
+const smartSamplePixels = 250_000
+
+// ChooseFormat обирає формат для format=smart: PNG для зображень з прозорістю (JPEG її втратив би)
+// або з малою кількістю кольорів, JPEG - для фотографічного вмісту.
+func ChooseFormat(img image.Image) string {
+	// Стандартні типи зображень знають, чи є в них прозорість, без перебору пікселів
+	opaque, knowsOpacity := img.(interface{ Opaque() bool })
+	if knowsOpacity && !opaque.Opaque() {
+		return "png"
+	}
+
+	b := img.Bounds()
+	step := 1
+	if n := b.Dx() * b.Dy(); n > smartSamplePixels {
+		step = int(math.Ceil(math.Sqrt(float64(n) / smartSamplePixels)))
+	}
+
+	colors := make(map[uint32]struct{}, smartMaxColors+1)
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A != 0xff {
+				return "png"
+			}
+			if len(colors) > smartMaxColors {
+				if knowsOpacity {
+					return "jpeg"
+				}
+				// Без Opaque() решта пікселів ще перевіряється на прозорість
+				continue
+			}
+			colors[uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B)] = struct{}{}
+		}
+	}
+	if len(colors) > smartMaxColors {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// ForImage повертає параметри кодування з конкретним форматом для img: format=smart
+// замінюється на вибір ChooseFormat, інші формати лишаються без змін. Викликається до
+// Extension і ContentType, які для smart не знають остаточного формату.
+func (o OutputOptions) ForImage(img image.Image) OutputOptions {
+	if o.Format == FormatSmart {
+		o.Format = ChooseFormat(img)
+	}
+	return o
+}
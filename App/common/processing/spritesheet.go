@@ -0,0 +1,108 @@
+package processing
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// maxSpriteFrames обмежує кількість кадрів у спрайт-листі
+const maxSpriteFrames = maxMontageCells
+
+// spriteParams - розібрані параметри дії spritesheet
+type spriteParams struct {
+	Frames       int
+	Cols         int
+	CellW, CellH int // 0 - розмір кадру GIF
+	Background   color.NRGBA
+}
+
+// parseSpriteParams розбирає params у форматі "frames=8,cols=4[,cell=WxH][,background=RRGGBB[AA]]".
+// За замовчуванням фон прозорий, а клітинка має розмір кадру.
+func parseSpriteParams(params string) (spriteParams, error) {
+	values, err := parseKeyValueParams(params, "frames", "cols", "cell", "background")
+	if err != nil {
+		return spriteParams{}, fmt.Errorf("invalid spritesheet parameters: %v", err)
+	}
+
+	var p spriteParams
+	p.Frames, err = strconv.Atoi(values["frames"])
+	if err != nil || p.Frames <= 0 || p.Frames > maxSpriteFrames {
+		return spriteParams{}, fmt.Errorf("invalid spritesheet frames '%s': expected integer 1-%d", values["frames"], maxSpriteFrames)
+	}
+	p.Cols, err = strconv.Atoi(values["cols"])
+	if err != nil || p.Cols <= 0 || p.Cols > p.Frames {
+		return spriteParams{}, fmt.Errorf("invalid spritesheet cols '%s': expected integer 1-%d", values["cols"], p.Frames)
+	}
+
+	if v, ok := values["cell"]; ok {
+		cellW, cellH, found := strings.Cut(v, "x")
+		p.CellW, err = strconv.Atoi(cellW)
+		if !found || err != nil || p.CellW <= 0 || p.CellW > maxMontageCellSize {
+			return spriteParams{}, fmt.Errorf("invalid spritesheet cell '%s': expected WxH up to %d", v, maxMontageCellSize)
+		}
+		p.CellH, err = strconv.Atoi(cellH)
+		if err != nil || p.CellH <= 0 || p.CellH > maxMontageCellSize {
+			return spriteParams{}, fmt.Errorf("invalid spritesheet cell '%s': expected WxH up to %d", v, maxMontageCellSize)
+		}
+	}
+
+	if v, ok := values["background"]; ok {
+		if p.Background, err = parseHexColor(v); err != nil {
+			return spriteParams{}, err
+		}
+	}
+	// З явним розміром клітинки розмір аркуша відомий ще до декодування
+	if p.CellW > 0 {
+		if err := checkSheetSize(p.Cols, (p.Frames+p.Cols-1)/p.Cols, p.CellW, p.CellH); err != nil {
+			return spriteParams{}, fmt.Errorf("invalid spritesheet parameters: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// spriteFrameLimit - скільки кадрів анімації потрібно spritesheet (DecodeGIFFrames декодує решту
+// лише для накладання). Щонайменше два: за ними applySpriteSheet відрізняє анімацію від статичного GIF.
+func spriteFrameLimit(params string) int {
+	p, err := parseSpriteParams(params)
+	if err != nil {
+		return maxSpriteFrames
+	}
+	return max(p.Frames, 2)
+}
+
+// applySpriteSheet вибирає до frames кадрів, рівномірно розподілених по анімації,
+// і розкладає їх у сітку з cols стовпців (розкладка та сама, що й у montage).
+func applySpriteSheet(frames []image.Image, params string) (image.Image, error) {
+	p, err := parseSpriteParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) < 2 {
+		return nil, fmt.Errorf("spritesheet requires an animated GIF, got a single frame")
+	}
+
+	count := min(p.Frames, len(frames))
+	sampled := make([]image.Image, count)
+	for i := range sampled {
+		sampled[i] = frames[i*len(frames)/count]
+	}
+
+	grid := montageParams{
+		Cols:       min(p.Cols, count),
+		CellW:      p.CellW,
+		CellH:      p.CellH,
+		Background: p.Background,
+	}
+	grid.Rows = (count + grid.Cols - 1) / grid.Cols
+	if grid.CellW == 0 {
+		b := frames[0].Bounds()
+		grid.CellW, grid.CellH = min(b.Dx(), maxMontageCellSize), min(b.Dy(), maxMontageCellSize)
+	}
+	if err := checkSheetSize(grid.Cols, grid.Rows, grid.CellW, grid.CellH); err != nil {
+		return nil, err
+	}
+	return composeGrid(sampled, grid), nil
+}
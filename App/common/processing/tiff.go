@@ -0,0 +1,68 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxTIFFPages обмежує обхід ланцюжка IFD, щоб зациклений файл не обходився вічно
+const maxTIFFPages = 10000
+
+// SelectPage повертає reader, з якого image.Decode прочитає вказану сторінку (з 1) багатосторінкового TIFF.
+// Декодер golang.org/x/image/tiff завжди читає лише перший IFD, тому в копії файлу зсув першого IFD
+// у заголовку замінюється на зсув потрібної сторінки; решта даних адресується абсолютно і не змінюється.
+func SelectPage(r io.ReadSeeker, format string, page int) (io.ReadSeeker, error) {
+	if page <= 1 {
+		return r, nil
+	}
+	if format != "tiff" {
+		return nil, fmt.Errorf("page %d requested, but only TIFF inputs have multiple pages (got %s)", page, format)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%w: TIFF header is too short", ErrCorruptImage)
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: invalid TIFF byte order", ErrCorruptImage)
+	}
+
+	// Проходимо ланцюжок IFD: кожен містить 2 байти кількості записів, записи по 12 байтів
+	// і 4 байти зсуву наступного IFD (0 - останній)
+	offset := order.Uint32(data[4:8])
+	for current := 1; current < page; current++ {
+		if offset == 0 || current > maxTIFFPages {
+			return nil, fmt.Errorf("page %d is out of range: the TIFF has %d page(s)", page, current)
+		}
+		if int(offset)+2 > len(data) {
+			return nil, fmt.Errorf("%w: TIFF directory offset is out of bounds", ErrCorruptImage)
+		}
+		entries := int(order.Uint16(data[offset:]))
+		next := int(offset) + 2 + entries*12
+		if next+4 > len(data) {
+			return nil, fmt.Errorf("%w: TIFF directory is truncated", ErrCorruptImage)
+		}
+		offset = order.Uint32(data[next:])
+	}
+	if offset == 0 {
+		return nil, fmt.Errorf("page %d is out of range: the TIFF has %d page(s)", page, page-1)
+	}
+
+	order.PutUint32(data[4:8], offset)
+	return bytes.NewReader(data), nil
+}
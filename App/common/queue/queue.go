@@ -0,0 +1,51 @@
+// Package queue задає назви черг Redis і налаштування клієнта Redis, спільні для API (producer)
+// та Worker (consumer), щоб обидва сервіси читали їх з тих самих змінних середовища.
+//
+// Черга - Redis Stream: API додає повідомлення (XADD), Worker читає їх у групі споживачів
+// (XREADGROUP) і підтверджує після обробки (XACK). Повідомлення Worker, який аварійно зупинився
+// до підтвердження, лишається в списку очікування групи і не губиться (at-least-once).
+package queue
+
+import (
+	"os"
+	"strings"
+)
+
+// DefaultName - черга, яка використовується, якщо QUEUE_NAME не задано
+const DefaultName = "image_processing_queue"
+
+// Names - черги з QUEUE_NAME (через кому). Worker слухає всі; якщо повідомлення є в кількох,
+// вони обробляються в порядку пріоритету черг. Окрема назва на розгортання ізолює конвеєри на одному Redis.
+var Names = parseNames(os.Getenv("QUEUE_NAME"))
+
+// Name - черга, в яку API ставить завдання (перша з Names)
+var Name = Names[0]
+
+// TaskField - поле запису stream з повідомленням завдання (Task.Encode)
+const TaskField = "task"
+
+// DefaultGroup - група споживачів Worker, якщо QUEUE_GROUP не задано
+const DefaultGroup = "image_workers"
+
+// Group - група споживачів, у якій Worker ділять повідомлення черг (QUEUE_GROUP)
+var Group = groupName(os.Getenv("QUEUE_GROUP"))
+
+func groupName(value string) string {
+	if value = strings.TrimSpace(value); value != "" {
+		return value
+	}
+	return DefaultGroup
+}
+
+func parseNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{DefaultName}
+	}
+	return names
+}
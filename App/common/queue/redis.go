@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RedisTuning - налаштування пулу та таймаутів клієнта Redis, спільні для API та Worker.
+// Нульові значення означають значення за замовчуванням go-redis (пул 10 з'єднань на CPU,
+// таймаути підключення 5s, читання і запису 3s). Блокуючі команди (XREADGROUP з BLOCK) go-redis
+// подовжує на власний таймаут команди, тож READ_TIMEOUT їх не обриває.
+type RedisTuning struct {
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// RedisTuningFromEnv читає REDIS_POOL_SIZE, REDIS_DIAL_TIMEOUT, REDIS_READ_TIMEOUT
+// і REDIS_WRITE_TIMEOUT (тривалості у форматі Go, наприклад "500ms" чи "2s").
+func RedisTuningFromEnv() (RedisTuning, error) {
+	var t RedisTuning
+	if v := os.Getenv("REDIS_POOL_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return t, fmt.Errorf("invalid REDIS_POOL_SIZE '%s': must be a positive integer", v)
+		}
+		t.PoolSize = size
+	}
+
+	for _, d := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"REDIS_DIAL_TIMEOUT", &t.DialTimeout},
+		{"REDIS_READ_TIMEOUT", &t.ReadTimeout},
+		{"REDIS_WRITE_TIMEOUT", &t.WriteTimeout},
+	} {
+		v := os.Getenv(d.name)
+		if v == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return t, fmt.Errorf("invalid %s '%s': must be a positive duration such as 2s", d.name, v)
+		}
+		*d.value = timeout
+	}
+	return t, nil
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TaskVersion - поточна версія формату повідомлення завдання. Worker відхиляє повідомлення
+// новіших версій, яких він не розуміє (наприклад, під час поступового оновлення розгортання).
+const TaskVersion = 1
+
+// Task - повідомлення завдання в черзі Redis. Кодується як JSON, тож params можуть містити
+// будь-які символи, а нові поля (лічильник спроб, контекст трасування) додаються без зміни розбору.
+type Task struct {
+	Version   int    `json:"v"`
+	JobID     string `json:"job_id"`
+	InputPath string `json:"input_path"`
+	Action    string `json:"action"`
+	Params    string `json:"params,omitempty"`
+	// Attempt - номер повторної спроби (0 - перша); повторна постановка в чергу його збільшує
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// NewTask створює повідомлення поточної версії
+func NewTask(jobID, inputPath, action, params string) Task {
+	return Task{Version: TaskVersion, JobID: jobID, InputPath: inputPath, Action: action, Params: params}
+}
+
+// Encode повертає повідомлення у вигляді, що ставиться в чергу
+func (t Task) Encode() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ParseTask розбирає повідомлення з черги. Окрім JSON, підтримується старий формат
+// "jobID|filePath|action|params", щоб завдання, поставлені до оновлення API, не загубилися.
+func ParseTask(message string) (Task, error) {
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") {
+		return parseLegacyTask(message)
+	}
+
+	var t Task
+	if err := json.Unmarshal([]byte(message), &t); err != nil {
+		return Task{}, fmt.Errorf("invalid task message: %w", err)
+	}
+	if t.Version < 1 || t.Version > TaskVersion {
+		return Task{}, fmt.Errorf("unsupported task message version %d (this worker supports up to %d)", t.Version, TaskVersion)
+	}
+	if t.JobID == "" || t.InputPath == "" || t.Action == "" {
+		return Task{}, fmt.Errorf("invalid task message: job_id, input_path and action are required")
+	}
+	return t, nil
+}
+
+// parseLegacyTask розбирає старий формат. Params - останнє поле, тому SplitN
+// зберігає в них символ "|" (старий розбір через Split його губив).
+func parseLegacyTask(message string) (Task, error) {
+	parts := strings.SplitN(message, "|", 4)
+	if len(parts) < 3 {
+		return Task{}, fmt.Errorf("invalid task format: expected <jobID>|<filePath>|<action>|<params>")
+	}
+	t := Task{Version: 0, JobID: parts[0], InputPath: parts[1], Action: parts[2]}
+	if len(parts) > 3 {
+		t.Params = parts[3]
+	}
+	return t, nil
+}
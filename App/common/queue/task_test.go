@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaskRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{"empty params", ""},
+		{"plain params", "800x600"},
+		{"pipe in params", "text=a|b|c,mode=red"},
+		{"pipe only", "|"},
+		{"json params", `[{"name":"a|b","x":0,"y":0,"w":2,"h":2}]`},
+		{"quotes and newlines", "caption=\"x\"\nnext=\\|"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := NewTask("job-1", "/data/in/job-1.png", "resize", tt.params)
+			want.Attempt = 2
+			message, err := want.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseTask(message)
+			if err != nil {
+				t.Fatalf("ParseTask(%q) = %v", message, err)
+			}
+			if got != want {
+				t.Fatalf("ParseTask(Encode()) = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseLegacyTask(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    Task
+		wantErr bool
+	}{
+		{"without params", "job-1|/in/a.png|grayscale", Task{JobID: "job-1", InputPath: "/in/a.png", Action: "grayscale"}, false},
+		{"with params", "job-1|/in/a.png|resize|800x600", Task{JobID: "job-1", InputPath: "/in/a.png", Action: "resize", Params: "800x600"}, false},
+		{"pipe in params", "job-1|/in/a.png|resize|a|b||c", Task{JobID: "job-1", InputPath: "/in/a.png", Action: "resize", Params: "a|b||c"}, false},
+		{"empty params", "job-1|/in/a.png|resize|", Task{JobID: "job-1", InputPath: "/in/a.png", Action: "resize"}, false},
+		{"too few fields", "job-1|/in/a.png", Task{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTask(tt.message)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTask(%q) = %+v, want an error", tt.message, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ParseTask(%q) = %+v, %v; want %+v", tt.message, got, err, tt.want)
+			}
+
+			// Повторна постановка (NewTask) переводить завдання старого формату в JSON без втрат
+			requeued := NewTask(got.JobID, got.InputPath, got.Action, got.Params)
+			message, err := requeued.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, err := ParseTask(message); err != nil || again != requeued {
+				t.Fatalf("ParseTask(%q) = %+v, %v; want %+v", message, again, err, requeued)
+			}
+		})
+	}
+}
+
+func TestParseTaskRejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name, message, wantErr string
+	}{
+		{"newer version", `{"v":99,"job_id":"j","input_path":"p","action":"a"}`, "unsupported task message version"},
+		{"missing action", `{"v":1,"job_id":"j","input_path":"p"}`, "required"},
+		{"broken json", `{"v":1,`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTask(tt.message)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseTask(%q) = %v, want error containing %q", tt.message, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Package storage задає каталоги файлового сховища, спільні для API та Worker: оригінали
+// завантажень (вхідне сховище) і результати обробки (вихідне сховище). Їх можна розмістити
+// на різних томах - наприклад, оригінали на дешевому повільному диску, а результати, які
+// часто завантажують, на швидкому. Шляхи файлів зберігаються в jobs повністю, тож обидва
+// сервіси мають бачити каталоги за тими самими шляхами.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultPath - каталог сховища, якщо окремі каталоги не задано
+const DefaultPath = "./storage"
+
+// InputPath - каталог оригіналів (STORAGE_INPUT_PATH): сюди API зберігає завантаження,
+// а Worker читає їх звідси
+var InputPath = pathFromEnv("STORAGE_INPUT_PATH")
+
+// OutputPath - каталог результатів і маніфестів (STORAGE_OUTPUT_PATH): сюди пише Worker,
+// а API віддає файли звідси
+var OutputPath = pathFromEnv("STORAGE_OUTPUT_PATH")
+
+func pathFromEnv(name string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return DefaultPath
+}
+
+// Ensure створює каталоги сховища, яких ще немає
+func Ensure() error {
+	for _, dir := range []string{InputPath, OutputPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create storage directory '%s': %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// OutputFilePath повертає шлях для нового результату завдання:
+// <job_id>_<action>[_<name>]_<HHMMSS>_<випадковий суфікс><ext>. Час лишено для зручності читання,
+// а унікальність забезпечує суфікс: повторна обробка того самого завдання в ту саму секунду
+// (паралельні Worker або Worker і API) не перезапише попередній результат. 64 випадкові біти
+// роблять збіг практично неможливим навіть для тисяч результатів за секунду.
+func OutputFilePath(jobID, action, name, ext string) string {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	parts := []string{jobID, action}
+	if name != "" {
+		parts = append(parts, name)
+	}
+	parts = append(parts, time.Now().Format("150405"), hex.EncodeToString(suffix))
+	return filepath.Join(OutputPath, strings.Join(parts, "_")+ext)
+}
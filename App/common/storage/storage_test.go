@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestOutputFilePathFormat(t *testing.T) {
+	const jobID = "6f1d1f5e-0000-4000-8000-000000000001"
+	tests := []struct {
+		action, name, ext string
+		pattern           string
+	}{
+		{"resize", "", ".jpg", `^` + jobID + `_resize_\d{6}_[0-9a-f]{16}\.jpg$`},
+		{"multicrop", "face_1", ".png", `^` + jobID + `_multicrop_face_1_\d{6}_[0-9a-f]{16}\.png$`},
+	}
+	for _, tt := range tests {
+		path := OutputFilePath(jobID, tt.action, tt.name, tt.ext)
+		if filepath.Dir(path) != filepath.Clean(OutputPath) {
+			t.Errorf("OutputFilePath = %s, want a file in %s", path, OutputPath)
+		}
+		if !regexp.MustCompile(tt.pattern).MatchString(filepath.Base(path)) {
+			t.Errorf("OutputFilePath = %s, want a name matching %s", filepath.Base(path), tt.pattern)
+		}
+	}
+}
+
+func TestOutputFilePathUnique(t *testing.T) {
+	// Повторна обробка того самого завдання тією самою дією з кількох горутин в одну секунду
+	const (
+		workers = 8
+		perJob  = 500
+	)
+	var (
+		mu    sync.Mutex
+		seen  = make(map[string]bool, workers*perJob)
+		wg    sync.WaitGroup
+		dupes []string
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perJob {
+				path := OutputFilePath("6f1d1f5e-0000-4000-8000-000000000001", "resize", "", ".jpg")
+				mu.Lock()
+				if seen[path] {
+					dupes = append(dupes, path)
+				}
+				seen[path] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(dupes) > 0 {
+		t.Fatalf("%d duplicate output paths among %d, e.g. %s", len(dupes), workers*perJob, dupes[0])
+	}
+}
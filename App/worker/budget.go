@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+
+	"image_common/queue"
+)
+
+// minJobPixels - найменша вартість завдання в бюджеті пікселів: навіть мініатюра займає пам'ять
+// під декодування й кодування, а бюджет не повинен допускати необмежену кількість дрібних завдань
+const minJobPixels = 1_000_000
+
+// pixelBudget - зважений семафор за кількістю пікселів декодованих входів (PIXEL_BUDGET).
+// nil - бюджет вимкнено, завдання обробляються по одному, як раніше.
+var pixelBudget *semaphore.Weighted
+
+// pixelBudgetSize - загальний розмір pixelBudget у пікселях
+var pixelBudgetSize int64
+
+// setPixelBudget вмикає паралельну обробку в межах size пікселів одночасно
+func setPixelBudget(size int64) {
+	pixelBudget, pixelBudgetSize = semaphore.NewWeighted(size), size
+}
+
+// estimateTaskPixels оцінює вартість завдання за заголовками вхідних файлів (DecodeConfig),
+// не декодуючи пікселів: сума площ усіх входів, не менше minJobPixels і не більше всього бюджету,
+// щоб завелике зображення все ж оброблялося (наодинці).
+func estimateTaskPixels(taskMessage string) int64 {
+	task, err := queue.ParseTask(taskMessage)
+	if err != nil {
+		return minJobPixels
+	}
+	inputPath := task.InputPath
+
+	paths := []string{inputPath}
+	if entries, err := os.ReadDir(inputPath); err == nil {
+		// Входи /job/combine - каталог файлів
+		paths = paths[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(inputPath, entry.Name()))
+			}
+		}
+	}
+
+	var total int64
+	for _, path := range paths {
+		total += imagePixels(path)
+	}
+	return min(max(total, minJobPixels), pixelBudgetSize)
+}
+
+// imagePixels повертає площу зображення за заголовком файлу (0, якщо його не вдалося прочитати -
+// таке завдання швидко завершиться помилкою декодування)
+func imagePixels(path string) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0
+	}
+	return int64(config.Width) * int64(config.Height)
+}
+
+// runWithinBudget запускає обробку повідомлення у фоні, щойно в бюджеті пікселів знайдеться місце для
+// завдання. Поки місця немає, нові завдання з черги не беруться - вони лишаються в Redis для
+// інших Worker. Повертає false, якщо очікування перервано зупинкою Worker.
+func runWithinBudget(ctx context.Context, wg *sync.WaitGroup, msg queueMessage) bool {
+	cost := estimateTaskPixels(msg.Task)
+	if err := pixelBudget.Acquire(ctx, cost); err != nil {
+		return false
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer pixelBudget.Release(cost)
+		handleMessage(ctx, msg)
+	}()
+	return true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"image_common/processing"
+)
+
+func TestDecodeHEICToJPEG(t *testing.T) {
+	// testdata/sample.heic - 8-бітний HEIC з тестових даних github.com/gen2brain/heic
+	const path = "testdata/sample.heic"
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, format, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil || format != "heic" {
+		t.Fatalf("DecodeConfig = %q, %v; want heic", format, err)
+	}
+
+	img, err := decodeImageFile(path, "convert", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(config.Width, config.Height) {
+		t.Fatalf("decoded size = %v, want %dx%d", got, config.Width, config.Height)
+	}
+
+	var buf bytes.Buffer
+	if err := processing.Encode(&buf, img, processing.DefaultOutputOptions); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("JPEG size = %v, want %v", out.Bounds().Size(), img.Bounds().Size())
+	}
+
+	// Середній колір після JPEG близький до декодованого HEIC, тобто пікселі не втрачено
+	mean := func(img image.Image) [3]float64 {
+		var sum [3]float64
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				sum[0], sum[1], sum[2] = sum[0]+float64(r>>8), sum[1]+float64(g>>8), sum[2]+float64(b>>8)
+			}
+		}
+		n := float64(b.Dx() * b.Dy())
+		return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+	}
+	want, got := mean(img), mean(out)
+	for i := range want {
+		if d := got[i] - want[i]; d > 3 || d < -3 {
+			t.Fatalf("mean color after JPEG = %.1f, want %.1f", got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// failedInputTTL - скільки зберігається вхідний файл завдання FAILED (FAILED_INPUT_TTL), щоб його
+// можна було повторити через /admin/requeue; 0 - файл видаляється одразу після невдачі
+var failedInputTTL = 72 * time.Hour
+
+// failedInputSweepInterval - як часто Worker видаляє прострочені вхідні файли завдань FAILED
+const failedInputSweepInterval = 10 * time.Minute
+
+// failedInputBatchSize обмежує кількість файлів, що видаляються за один прохід
+const failedInputBatchSize = 100
+
+// keepFailedInput залишає вхідний файл завдання FAILED до failedInputTTL (видаляє його
+// startFailedInputSweeper або очищення даних власника). Якщо TTL не задано або термін не вдалося
+// записати, файл видаляється одразу, щоб не лишитися на диску назавжди.
+func keepFailedInput(ctx context.Context, jobID, inputPath string) {
+	if failedInputTTL <= 0 {
+		removeInput(inputPath)
+		return
+	}
+	_, err := pgDB.Exec(ctx, `UPDATE jobs SET input_expires_at = NOW() + make_interval(secs => $1) WHERE id = $2`,
+		failedInputTTL.Seconds(), jobID)
+	if err != nil {
+		log.Printf("FAILED to record input expiry for job %s, removing its input: %v", jobID, err)
+		removeInput(inputPath)
+	}
+}
+
+// startFailedInputSweeper періодично видаляє вхідні файли завдань FAILED, термін зберігання
+// яких минув, поки ctx не скасовано
+func startFailedInputSweeper(ctx context.Context) {
+	if failedInputTTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(failedInputSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := sweepFailedInputs(ctx)
+		if err != nil {
+			log.Printf("ERROR: Failed input sweep failed after removing %d input(s): %v", n, err)
+		} else if n > 0 {
+			log.Printf("Failed input sweep: removed %d expired input(s) of failed jobs", n)
+		}
+	}
+}
+
+// sweepFailedInputs видаляє до failedInputBatchSize прострочених вхідних файлів і скидає їхній
+// термін. Завдання, повторно поставлені в чергу, вже не FAILED, тож їхні файли не видаляються.
+func sweepFailedInputs(ctx context.Context) (int, error) {
+	tx, err := pgDB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, input_path FROM jobs
+		WHERE status = 'FAILED' AND input_expires_at < NOW()
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, failedInputBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids, paths []string
+	for rows.Next() {
+		var id, path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids, paths = append(ids, id), append(paths, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE jobs SET input_expires_at = NULL WHERE id = ANY($1::uuid[])`, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	// Файли видаляються після фіксації: невдала транзакція не лишає завдання без входу
+	for _, path := range paths {
+		removeInput(path)
+	}
+	return len(paths), nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB - DB у пам'яті з таблицями jobs і job_outputs. Розуміє лише запити, які виконує
+// processTask; решта повертає помилку.
+type fakeDB struct {
+	mu         sync.Mutex
+	jobs       map[string]map[string]any
+	outputs    map[string]map[string]string // job_id -> name -> output_path
+	failInsert int                          // якщо > 0, цей за ліком INSERT у job_outputs повертає помилку
+	inserts    int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{jobs: map[string]map[string]any{}, outputs: map[string]map[string]string{}}
+}
+
+// addJob додає рядок jobs у статусі QUEUED
+func (db *fakeDB) addJob(id string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.jobs[id] = map[string]any{"id": id, "status": "QUEUED", "callback_url": sql.NullString{}}
+}
+
+func (db *fakeDB) job(id string) map[string]any {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.jobs[id]
+}
+
+// jobOutputs повертає копію рядків job_outputs завдання
+func (db *fakeDB) jobOutputs(id string) map[string]string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	outputs := map[string]string{}
+	for name, path := range db.outputs[id] {
+		outputs[name] = path
+	}
+	return outputs
+}
+
+func (db *fakeDB) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "UPDATE jobs SET status = $1, output_path = $2, error_message = $3 WHERE id = $4"):
+		return db.updateJob(fmt.Sprint(args[3]), map[string]any{"status": args[0], "output_path": args[1], "error_message": args[2]})
+	case strings.HasPrefix(query, "UPDATE jobs SET status = $1, output_path = $2, error_message = NULL"):
+		return db.updateJob(fmt.Sprint(args[5]), map[string]any{"status": args[0], "output_path": args[1], "output_format": args[2]})
+	case strings.HasPrefix(query, "UPDATE jobs SET input_expires_at"):
+		return db.updateJob(fmt.Sprint(args[1]), map[string]any{"input_expires_at": args[0]})
+	case strings.HasPrefix(query, "INSERT INTO job_outputs"):
+		db.inserts++
+		if db.inserts == db.failInsert {
+			return pgconn.CommandTag{}, errors.New("fakeDB: insert failed")
+		}
+		jobID, name := fmt.Sprint(args[0]), fmt.Sprint(args[1])
+		if _, exists := db.outputs[jobID][name]; exists && !strings.Contains(query, "ON CONFLICT") {
+			return pgconn.CommandTag{}, fmt.Errorf("fakeDB: duplicate key (%s, %s)", jobID, name)
+		}
+		if db.outputs[jobID] == nil {
+			db.outputs[jobID] = map[string]string{}
+		}
+		db.outputs[jobID][name] = fmt.Sprint(args[2])
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.HasPrefix(query, "DELETE FROM job_outputs WHERE job_id = $1"):
+		n := len(db.outputs[fmt.Sprint(args[0])])
+		delete(db.outputs, fmt.Sprint(args[0]))
+		return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", n)), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("fakeDB: unsupported statement %q", query)
+}
+
+func (db *fakeDB) updateJob(id string, columns map[string]any) (pgconn.CommandTag, error) {
+	job, ok := db.jobs[id]
+	if !ok {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+	for k, v := range columns {
+		job[k] = v
+	}
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (db *fakeDB) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	if query != "SELECT output_path FROM job_outputs WHERE job_id = $1" {
+		return nil, fmt.Errorf("fakeDB: unsupported query %q", query)
+	}
+	rows := &fakeRows{pos: -1}
+	for _, path := range db.outputs[fmt.Sprint(args[0])] {
+		rows.rows = append(rows.rows, path)
+	}
+	return rows, nil
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	var column string
+	if _, err := fmt.Sscanf(query, "SELECT %s FROM jobs WHERE id = $1", &column); err != nil {
+		return fakeRow{err: fmt.Errorf("fakeDB: unsupported query %q", query)}
+	}
+	job, ok := db.jobs[fmt.Sprint(args[0])]
+	if !ok {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	return fakeRow{value: job[column]}
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("fakeDB: transactions are not supported")
+}
+
+// fakeRow - результат QueryRow з однією колонкою
+type fakeRow struct {
+	value any
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	switch d := dest[0].(type) {
+	case *string:
+		*d = fmt.Sprint(r.value)
+	case *sql.NullString:
+		*d, _ = r.value.(sql.NullString)
+	default:
+		return fmt.Errorf("fakeDB: unsupported scan destination %T", dest[0])
+	}
+	return nil
+}
+
+// fakeRows - результат Query з колонкою output_path
+type fakeRows struct {
+	rows []string
+	pos  int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+func (r *fakeRows) Values() ([]any, error)                       { return []any{r.rows[r.pos]}, nil }
+
+func (r *fakeRows) Scan(dest ...any) error {
+	d, ok := dest[0].(*string)
+	if !ok {
+		return fmt.Errorf("fakeDB: unsupported scan destination %T", dest[0])
+	}
+	*d = r.rows[r.pos]
+	return nil
+}
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.rows)
+}
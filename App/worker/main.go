@@ -2,23 +2,29 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
-	"image/jpeg"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	_ "image/gif"
 	_ "image/png"
@@ -26,10 +32,27 @@ import (
 	_ "golang.org/x/image/bmp"
 	_ "golang.org/x/image/tiff"
 
+	// HEIC/HEIF (формат фото за замовчуванням на iPhone); декодер на WASM, без cgo
+	_ "github.com/gen2brain/heic"
+
 	"github.com/go-redis/redis/v8"
-	"github.com/nfnt/resize"
+
+	"image_common/manifest"
+	"image_common/metrics"
+	"image_common/migrations"
+	"image_common/processing"
+	"image_common/queue"
+	"image_common/storage"
 )
 
+// DB - операції PostgreSQL, які використовує обробка завдань (реалізується *pgxpool.Pool).
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 var (
 	// Redis environment variables
 	RedisHost     = os.Getenv("REDIS_HOST")
@@ -43,41 +66,81 @@ var (
 	PGPassword = os.Getenv("PG_PASSWORD")
 	PGDBName   = os.Getenv("PG_DBNAME")
 
-	ctx  = context.Background()
-	rdb  *redis.Client
-	pgDB *pgx.Conn // PostgreSQL Connection
+	// Повний рядок підключення; якщо заданий, має пріоритет над окремими PG_* змінними
+	DatabaseURL = os.Getenv("DATABASE_URL")
+	PGDSN       = os.Getenv("PG_DSN")
+
+	// Сувора перевірка цілісності вхідних файлів (завершальні маркери JPEG/PNG)
+	StrictDecode = os.Getenv("STRICT_DECODE") == "true"
+
+	// Що робити з анімованим GIF для дії, яка обробляє один кадр (ANIMATED_INPUT_POLICY)
+	animatedInputPolicy = processing.AnimationFirstFrame
+
+	rdb    *redis.Client
+	pgPool *pgxpool.Pool // PostgreSQL Connection Pool (завдання можуть оброблятися паралельно, див. PIXEL_BUDGET)
+	pgDB   DB            // запити до PostgreSQL (pgPool; тести підставляють fake)
 
 	// Метрики Prometheus
 	jobsProcessed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "worker_jobs_processed_total",
-			Help: "Total number of jobs processed by action (e.g., grayscale, blur) and status.",
+			Namespace: metrics.Namespace,
+			Name:      "worker_jobs_processed_total",
+			Help:      "Total number of jobs processed by action (e.g., grayscale, blur) and status.",
 		},
-		[]string{"action", "status"}, // status: completed, failed
+		[]string{"action", "outcome"}, // outcome: metrics.OutcomeCompleted, metrics.OutcomeFailed
 	)
 
 	jobDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
-		Name:    "worker_job_duration_seconds",
-		Help:    "Histogram of job processing duration in seconds.",
-		Buckets: prometheus.DefBuckets,
+		Namespace: metrics.Namespace,
+		Name:      "worker_job_duration_seconds",
+		Help:      "Histogram of job processing duration in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	storageErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "worker_storage_errors_total",
+			Help:      "Total number of failed writes to storage because the disk is full or read-only.",
+		},
+		[]string{"reason"}, // reason: disk_full, read_only
+	)
+
+	jobsInProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "worker_jobs_in_progress",
+		Help:      "Number of jobs currently being processed by this worker.",
 	})
+
+	tasksReclaimed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "worker_tasks_reclaimed_total",
+			Help:      "Total number of queue messages taken over from workers that did not acknowledge them.",
+		},
+		[]string{"outcome"}, // outcome: retried, abandoned
+	)
 )
 
 func init() {
 	// Реєстрація метрик
 	prometheus.MustRegister(jobsProcessed)
 	prometheus.MustRegister(jobDuration)
+	prometheus.MustRegister(jobsInProgress)
+	prometheus.MustRegister(storageErrors)
+	prometheus.MustRegister(tasksReclaimed)
+	registerBuildInfo()
 }
 
-// Константа для шляху до спільного Volume всередині контейнера
-const storagePath = "./storage"
 const statusInProgress = "PROCESSING"
 const statusCompleted = "COMPLETED"
 const statusFailed = "FAILED"
 const metricsPort = "9091" // Порт для експорту метрик
+const callbackTimeout = 10 * time.Second
+const queuePollTimeout = 5 * time.Second
 
 // connectToRedis намагається підключитися до Redis з циклом повторних спроб.
-func connectToRedis() {
+func connectToRedis(ctx context.Context) {
 	if RedisHost == "" {
 		RedisHost = "redis"
 		log.Println("REDIS_HOST not set. Defaulting to 'redis'")
@@ -88,10 +151,19 @@ func connectToRedis() {
 
 	redisAddr := fmt.Sprintf("%s:%s", RedisHost, RedisPort)
 
+	redisTuning, err := queue.RedisTuningFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Redis configuration: %v", err)
+	}
+
 	rdb = redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: RedisPassword,
-		DB:       0,
+		Addr:         redisAddr,
+		Password:     RedisPassword,
+		DB:           0,
+		PoolSize:     redisTuning.PoolSize,
+		DialTimeout:  redisTuning.DialTimeout,
+		ReadTimeout:  redisTuning.ReadTimeout,
+		WriteTimeout: redisTuning.WriteTimeout,
 	})
 
 	const maxRetries = 15
@@ -108,23 +180,46 @@ func connectToRedis() {
 	log.Fatalf("CRITICAL: Failed to connect to Redis after %d attempts. Terminating.", maxRetries)
 }
 
+// runMigrations застосовує міграції схеми на окремому з'єднанні пулу
+// (advisory lock міграцій тримається на рівні з'єднання)
+func runMigrations(ctx context.Context) error {
+	conn, err := pgPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return migrations.Run(ctx, conn.Conn())
+}
+
 // connectToPostgres намагається підключитися до PostgreSQL з циклом повторних спроб.
-func connectToPostgres() {
-	if PGHost == "" || PGUser == "" || PGDBName == "" {
-		log.Fatalf("PostgreSQL environment variables (PG_HOST, PG_USER, PG_DBNAME) must be set in Worker.")
+func connectToPostgres(ctx context.Context) {
+	connStr := DatabaseURL
+	if connStr == "" {
+		connStr = PGDSN
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
-		PGUser, PGPassword, PGHost, PGPort, PGDBName)
+	if connStr == "" {
+		if PGHost == "" || PGUser == "" || PGDBName == "" {
+			log.Fatalf("PostgreSQL environment variables (DATABASE_URL, or PG_HOST, PG_USER, PG_DBNAME) must be set in Worker.")
+		}
+
+		connStr = fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
+			PGUser, PGPassword, PGHost, PGPort, PGDBName)
+	}
 
 	const maxRetries = 15
 	var err error
 
 	for i := 0; i < maxRetries; i++ {
-		pgDB, err = pgx.Connect(ctx, connStr)
-		if err == nil && pgDB.Ping(ctx) == nil {
-			log.Println("SUCCESS: Successfully connected to PostgreSQL.")
-			return
+		pgPool, err = pgxpool.New(ctx, connStr)
+		if err == nil {
+			// Пул підключається ліниво, тож доступність бази перевіряє Ping
+			if err = pgPool.Ping(ctx); err == nil {
+				log.Println("SUCCESS: Successfully connected to PostgreSQL.")
+				pgDB = pgPool
+				return
+			}
+			pgPool.Close()
 		}
 
 		log.Printf("WAITING: Failed to connect to PostgreSQL (Attempt %d/%d): %v. Retrying in 3 seconds...", i+1, maxRetries, err)
@@ -134,11 +229,17 @@ func connectToPostgres() {
 }
 
 // updatePGStatus оновлює статус та результат (шлях або помилку) у PostgreSQL
-func updatePGStatus(jobID, status, resultData string) {
-	// Для FAILED статус записуємо помилку у output_path, для COMPLETED - шлях
-	query := `UPDATE jobs SET status = $1, output_path = $2 WHERE id = $3`
+func updatePGStatus(ctx context.Context, jobID, status, resultData string) {
+	// Для FAILED resultData - текст помилки (error_message), для інших статусів - шлях результату
+	var outputPath, errorMessage sql.NullString
+	if status == statusFailed {
+		errorMessage = sql.NullString{String: resultData, Valid: true}
+	} else if resultData != "" {
+		outputPath = sql.NullString{String: resultData, Valid: true}
+	}
+	query := `UPDATE jobs SET status = $1, output_path = $2, error_message = $3 WHERE id = $4`
 
-	_, err := pgDB.Exec(ctx, query, status, resultData, jobID)
+	_, err := pgDB.Exec(ctx, query, status, outputPath, errorMessage, jobID)
 	if err != nil {
 		log.Printf("FAILED to update PostgreSQL status for job %s to %s: %v", jobID, status, err)
 	} else {
@@ -146,185 +247,623 @@ func updatePGStatus(jobID, status, resultData string) {
 	}
 }
 
-// saveImageToJPEG зберігає image.Image у вказаний шлях у форматі JPEG.
-func saveImageToJPEG(img image.Image, outputPath string) error {
-	outputFile, err := os.Create(outputPath)
+// jobFinished повідомляє, чи завдання вже має підсумковий статус (COMPLETED або FAILED).
+// Якщо статус прочитати не вдалося, завдання обробляється.
+func jobFinished(ctx context.Context, jobID string) bool {
+	var status string
+	if err := pgDB.QueryRow(ctx, `SELECT status FROM jobs WHERE id = $1`, jobID).Scan(&status); err != nil {
+		return false
+	}
+	return status == statusCompleted || status == statusFailed
+}
+
+// completeJob позначає завдання COMPLETED і записує шлях, формат (для format=smart - обраний
+// за вмістом) і розміри основного результату
+func completeJob(ctx context.Context, jobID, outputPath, format string, size image.Point) {
+	query := `UPDATE jobs SET status = $1, output_path = $2, error_message = NULL, output_format = $3,
+		output_width = $4, output_height = $5 WHERE id = $6`
+
+	_, err := pgDB.Exec(ctx, query, statusCompleted, outputPath, format, size.X, size.Y, jobID)
+	if err != nil {
+		log.Printf("FAILED to update PostgreSQL status for job %s to %s: %v", jobID, statusCompleted, err)
+	} else {
+		log.Printf("SUCCESS: Job %s status updated in PG to %s. Data: %s (%s)", jobID, statusCompleted, outputPath, format)
+	}
+}
+
+// notifyCallback надсилає підсумковий статус завдання на callback_url, якщо клієнт його вказав.
+// Доставка best-effort: помилки лише логуються і не змінюють статус завдання.
+func notifyCallback(ctx context.Context, jobID, status string) {
+	var callbackURL sql.NullString
+	err := pgDB.QueryRow(ctx, `SELECT callback_url FROM jobs WHERE id = $1`, jobID).Scan(&callbackURL)
+	if err != nil {
+		log.Printf("Warning: Failed to read callback_url for job %s: %v", jobID, err)
+		return
+	}
+	if !callbackURL.Valid || callbackURL.String == "" {
+		return
+	}
+
+	payload := fmt.Sprintf(`{"job_id": "%s", "status": "%s"}`, jobID, status)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL.String, strings.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("error creating output file %s: %v", outputPath, err)
+		log.Printf("Warning: Invalid callback_url for job %s: %v", jobID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: callbackTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Warning: Callback for job %s to %s failed: %v", jobID, callbackURL.String, err)
+		return
 	}
-	defer outputFile.Close()
+	resp.Body.Close()
+	log.Printf("Callback for job %s delivered to %s (HTTP %d)", jobID, callbackURL.String, resp.StatusCode)
+}
 
-	bounds := img.Bounds()
-	rgbaImg := image.NewRGBA(bounds)
-	draw.Draw(rgbaImg, bounds, img, bounds.Min, draw.Src)
+// saveImage зберігає image.Image у вказаний шлях у форматі з параметрів кодування.
+// Переповнений або доступний лише для читання диск повідомляється окремою помилкою та метрикою.
+func saveImage(img image.Image, outputPath string, opts processing.OutputOptions) error {
+	// O_EXCL: наявний файл (зіткнення імен) - помилка, а не тихий перезапис чужого результату
+	outputFile, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return storageError(fmt.Errorf("error creating output file %s: %w", outputPath, err))
+	}
 
-	if err := jpeg.Encode(outputFile, rgbaImg, &jpeg.Options{Quality: 90}); err != nil {
-		return fmt.Errorf("error encoding and saving image: %v", err)
+	encodeErr := processing.Encode(outputFile, img, opts)
+	closeErr := outputFile.Close()
+	if encodeErr != nil || closeErr != nil {
+		os.Remove(outputPath)
+		return storageError(fmt.Errorf("error encoding and saving image: %w", errors.Join(encodeErr, closeErr)))
 	}
+
+	optimizeOutput(outputPath, opts.Format)
 	return nil
 }
 
-// applyGrayscale застосовує перетворення у відтінки сірого
-func applyGrayscale(img image.Image) image.Image {
-	bounds := img.Bounds()
-	grayImg := image.NewGray(bounds)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			originalColor := img.At(x, y)
-			grayColor := color.GrayModel.Convert(originalColor)
-			grayImg.Set(x, y, grayColor)
+// storageError позначає помилки запису через переповнений (ENOSPC) чи доступний лише для читання (EROFS)
+// диск як "storage unavailable" і рахує їх у worker_storage_errors_total
+func storageError(err error) error {
+	var reason string
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		reason = "disk_full"
+	case errors.Is(err, syscall.EROFS):
+		reason = "read_only"
+	default:
+		return err
+	}
+	storageErrors.WithLabelValues(reason).Inc()
+	return fmt.Errorf("storage unavailable (%s): %w", reason, err)
+}
+
+// saveJobOutput записує один з кількох результатів завдання у таблицю job_outputs. Рядок
+// попередньої спроби з тим самим іменем (повідомлення, повторно доставлене після зупинки Worker)
+// замінюється, а не спричиняє помилку первинного ключа.
+func saveJobOutput(ctx context.Context, jobID, name, outputPath string) error {
+	query := `INSERT INTO job_outputs (job_id, name, output_path) VALUES ($1, $2, $3)
+		ON CONFLICT (job_id, name) DO UPDATE SET output_path = EXCLUDED.output_path`
+	if _, err := pgDB.Exec(ctx, query, jobID, name, outputPath); err != nil {
+		return fmt.Errorf("error recording output '%s' in database: %v", name, err)
+	}
+	return nil
+}
+
+// discardJobOutputs видаляє записані в job_outputs результати завдання разом з їхніми файлами,
+// а також файли paths, які могли не потрапити в таблицю. Так невдала або перервана спроба не
+// залишає областей, а повторна обробка (requeue, повторна доставка) починає з чистого стану.
+func discardJobOutputs(ctx context.Context, jobID string, paths []string) {
+	rows, err := pgDB.Query(ctx, `SELECT output_path FROM job_outputs WHERE job_id = $1`, jobID)
+	if err != nil {
+		log.Printf("Warning: Failed to list outputs of job %s: %v", jobID, err)
+	} else {
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		rows.Close()
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to remove output %s of job %s: %v", path, jobID, err)
 		}
 	}
-	return grayImg
+	if _, err := pgDB.Exec(ctx, `DELETE FROM job_outputs WHERE job_id = $1`, jobID); err != nil {
+		log.Printf("Warning: Failed to delete outputs of job %s: %v", jobID, err)
+	}
 }
 
-// applyResize змінює розмір зображення. Params очікується у форматі "widthxheight".
-func applyResize(img image.Image, params string) (image.Image, error) {
-	parts := strings.Split(params, "x")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid resize parameters: expected 'widthxheight'")
+// actionLimits - обмеження розміру входу та часу обробки окремих дій (ACTION_LIMITS)
+var actionLimits = processing.ActionLimits{}
+
+// runWithActionTimeout виконує fn з обмеженням часу дії (якщо воно налаштоване).
+// Дії не можна перервати посередині, тому після тайм-ауту горутина завершиться сама,
+// а її результат буде відкинуто; завдання одразу позначається FAILED.
+func runWithActionTimeout(action string, fn func() error) error {
+	timeout := actionLimits.TimeoutFor(action)
+	if timeout <= 0 {
+		return fn()
 	}
-	width, errW := strconv.ParseUint(parts[0], 10, 32)
-	height, errH := strconv.ParseUint(parts[1], 10, 32)
-	if errW != nil || errH != nil || width == 0 || height == 0 {
-		return nil, fmt.Errorf("invalid width or height value in resize parameters or value is zero")
+
+	done := make(chan error, 1)
+	go func() {
+		// recover з processTask не діє в іншій горутині
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("PANIC in action %s: %v\n%s", action, rec, debug.Stack())
+				done <- fmt.Errorf("processing panic: %v", rec)
+			}
+		}()
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("action '%s' exceeded its processing timeout of %s", action, timeout)
 	}
-	resizedImg := resize.Resize(uint(width), uint(height), img, resize.Lanczos3)
-	return resizedImg, nil
 }
 
-// applyCrop обрізає зображення. Params очікується у форматі "startX,startY,endX,endY".
-func applyCrop(img image.Image, params string) (image.Image, error) {
-	parts := strings.Split(params, ",")
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("invalid crop parameters: expected 'startX,startY,endX,endY'")
+// decodeImageFile відкриває та декодує вхідне зображення (для TIFF - сторінку page),
+// перевіряє, що його формат підходить для дії, і переводить його у RGB
+func decodeImageFile(inputPath, action string, page int) (image.Image, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("file not found at %s: %v", inputPath, err)
 	}
+	defer file.Close()
 
-	coords := make([]int, 4)
-	for i, part := range parts {
-		val, err := strconv.Atoi(part)
-		if err != nil {
-			return nil, fmt.Errorf("invalid coordinate value in crop parameters: %s", part)
+	_, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", processing.WrapDecodeError(err))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+	reader, err := processing.SelectPage(file, format, page)
+	if err != nil {
+		return nil, err
+	}
+
+	// Формат і розміри перевіряються за заголовком, до виділення пам'яті під пікселі
+	config, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", processing.WrapDecodeError(err))
+	}
+	if err := processing.CheckInput(action, format); err != nil {
+		return nil, err
+	}
+	if err := actionLimits.CheckPixels(action, config); err != nil {
+		return nil, err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+
+	img, format, err := image.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", processing.WrapDecodeError(err))
+	}
+	if StrictDecode {
+		if err := processing.CheckTrailer(reader, format); err != nil {
+			return nil, fmt.Errorf("error decoding image: %v", err)
 		}
-		coords[i] = val
 	}
-	start_x, start_y, end_x, end_y := coords[0], coords[1], coords[2], coords[3]
+	return processing.NormalizeColorSpace(img, reader), nil
+}
+
+// readInputMetadata читає сегменти метаданих вхідного JPEG для preserve_metadata
+// (nil для інших форматів і каталогів входів). Помилка не зриває завдання - результат буде без метаданих.
+func readInputMetadata(inputPath string) []byte {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
 
-	bounds := img.Bounds()
-	if start_x >= end_x || start_y >= end_y || start_x < 0 || start_y < 0 || end_x > bounds.Max.X || end_y > bounds.Max.Y {
-		return nil, fmt.Errorf("crop coordinates are out of bounds or invalid: bounds are %s", bounds)
+	metadata, err := processing.ReadJPEGMetadata(file)
+	if err != nil {
+		log.Printf("WARNING: Failed to read metadata of %s, output will have none: %v", inputPath, err)
 	}
+	return metadata
+}
 
-	rect := image.Rect(0, 0, end_x-start_x, end_y-start_y)
-	croppedImg := image.NewRGBA(rect)
+// readInputICC читає ICC-профіль вхідного JPEG/PNG для icc=keep (nil, якщо профілю немає)
+func readInputICC(inputPath string) []byte {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	profile, err := processing.ExtractICCProfile(file)
+	if err != nil {
+		log.Printf("WARNING: Failed to read ICC profile of %s, output will have none: %v", inputPath, err)
+	}
+	return profile
+}
+
+// decodeImageDir декодує всі зображення з каталогу вхідних файлів у порядку їх імен
+func decodeImageDir(inputDir, action string) ([]image.Image, error) {
+	entries, err := os.ReadDir(inputDir)
+	if err != nil {
+		return nil, fmt.Errorf("input directory not found at %s: %v", inputDir, err)
+	}
 
-	for y := 0; y < rect.Dy(); y++ {
-		for x := 0; x < rect.Dx(); x++ {
-			croppedImg.Set(x, y, img.At(start_x+x, start_y+y))
+	imgs := make([]image.Image, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		img, err := decodeImageFile(filepath.Join(inputDir, entry.Name()), action, 1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
 		}
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+// checkAnimatedInput застосовує ANIMATED_INPUT_POLICY до GIF з кількома кадрами для дії, що обробляє
+// один кадр: reject - помилка з підказкою, first_frame - попередження, яке записується в завдання.
+// Для інших форматів і статичних GIF повертає порожнє попередження.
+func checkAnimatedInput(inputPath, action string) (string, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("file not found at %s: %v", inputPath, err)
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil || format != "gif" {
+		// Помилку декодування поверне decodeImageFile
+		return "", nil
+	}
+	// Усі кадри декодуються лише після перевірки розмірів полотна
+	if err := actionLimits.CheckPixels(action, config); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error reading image: %v", err)
+	}
+	frames, err := processing.GIFFrameCount(file)
+	if err != nil {
+		return "", fmt.Errorf("error decoding image: %v", err)
+	}
+	if frames <= 1 {
+		return "", nil
 	}
+	if animatedInputPolicy == processing.AnimationReject {
+		return "", processing.AnimatedInputError(action, frames)
+	}
+	return processing.FirstFrameWarning(frames), nil
+}
 
-	return croppedImg, nil
+// setJobWarning записує попередження обробки завдання (показується в /job/status)
+func setJobWarning(ctx context.Context, jobID, warning string) {
+	if _, err := pgDB.Exec(ctx, `UPDATE jobs SET warning = $1 WHERE id = $2`, warning, jobID); err != nil {
+		log.Printf("FAILED to record warning for job %s: %v", jobID, err)
+	}
 }
 
-// processImage виконує обробку зображення відповідно до action та params
-func processImage(img image.Image, action string, params string) (image.Image, error) {
-	switch action {
-	case "grayscale":
-		return applyGrayscale(img), nil
-	case "resize":
-		return applyResize(img, params)
-	case "crop":
-		return applyCrop(img, params)
-	default:
-		return nil, fmt.Errorf("unknown image processing action: %s", action)
+// decodeAnimationFrames декодує кадри анімованого вхідного файлу (GIF), потрібні дії з params, після перевірки,
+// що його формат підходить для дії
+func decodeAnimationFrames(inputPath, action, params string) ([]image.Image, error) {
+	reader, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("file not found at %s: %v", inputPath, err)
+	}
+	defer reader.Close()
+
+	config, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", processing.WrapDecodeError(err))
+	}
+	if err := processing.CheckInput(action, format); err != nil {
+		return nil, err
+	}
+	if err := actionLimits.CheckPixels(action, config); err != nil {
+		return nil, err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+
+	frames, err := processing.DecodeGIFFrames(reader, processing.FrameLimit(action, params))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding animation frames: %v", err)
+	}
+	return frames, nil
+}
+
+// removeInput видаляє вхідний файл (або каталог вхідних файлів) після обробки
+func removeInput(inputPath string) {
+	if err := os.RemoveAll(inputPath); err != nil {
+		log.Printf("Warning: Failed to remove original input %s: %v", inputPath, err)
 	}
 }
 
 // processTask обробляє одне завдання з черги
-func processTask(taskMessage string) {
+// Контекст скасовується під час зупинки Worker, що перериває незавершені операції з БД.
+func processTask(ctx context.Context, taskMessage string) {
 	startTime := time.Now()
 
-	parts := strings.Split(taskMessage, "|")
-	if len(parts) < 3 {
-		log.Printf("Error: Invalid task format: %s. Expected format: <jobID>|<filePath>|<action>|<params>", taskMessage)
+	// defer гарантує зменшення лічильника навіть у разі паніки під час обробки
+	jobsInProgress.Inc()
+	defer jobsInProgress.Dec()
+
+	task, err := queue.ParseTask(taskMessage)
+	if err != nil {
+		log.Printf("Error: %v: %s", err, taskMessage)
 		return
 	}
 
-	jobID := parts[0]
-	inputPath := parts[1]
-	action := parts[2]
-	params := ""
-	if len(parts) > 3 {
-		params = parts[3]
+	jobID := task.JobID
+	inputPath := task.InputPath
+	action := task.Action
+	params := task.Params
+
+	// Повідомлення може надійти повторно (at-least-once), якщо Worker зупинився між записом
+	// результату і підтвердженням: завершене завдання не обробляється вдруге
+	if jobFinished(ctx, jobID) {
+		log.Printf("Job %s is already finished; skipping redelivered task", jobID)
+		return
 	}
 
+	// Паніка в будь-якій дії не повинна зупиняти Worker: завдання позначається FAILED,
+	// а цикл startWorker продовжує з наступним завданням
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("PANIC while processing job %s: %v\n%s", jobID, rec, debug.Stack())
+			updatePGStatus(ctx, jobID, statusFailed, fmt.Sprintf("processing panic: %v", rec))
+			jobsProcessed.WithLabelValues(metrics.ActionLabel(action), metrics.OutcomeFailed).Inc()
+			notifyCallback(ctx, jobID, statusFailed)
+		}
+	}()
+
 	log.Printf("--- START PROCESSING JOB: %s (Action: %s, Params: '%s') ---", jobID, action, params)
 
 	// 1. Встановлення статусу IN_PROGRESS у PostgreSQL
-	updatePGStatus(jobID, statusInProgress, "")
+	updatePGStatus(ctx, jobID, statusInProgress, "")
 	var processErr error = nil
 
+	// Дані для маніфесту завдання: хеші входів (до їх видалення), збережені результати, час дії
+	inputs := manifest.DescribeFiles(inputPath)
+	var (
+		savedOutputs   []string
+		processingTime time.Duration
+	)
+	timedAction := func(fn func() error) error {
+		actionStart := time.Now()
+		defer func() { processingTime += time.Since(actionStart) }()
+		return runWithActionTimeout(action, fn)
+	}
+	// finishJob записує маніфест до позначення COMPLETED, щоб він уже існував, коли клієнт
+	// побачить статус, і поки вхідний файл ще не видалено
+	finishJob := func(outputPath, format string, size image.Point) {
+		var outputs []manifest.File
+		for _, path := range savedOutputs {
+			outputs = append(outputs, manifest.DescribeFiles(path)...)
+		}
+		writeManifest(manifest.Manifest{
+			JobID:         jobID,
+			Action:        action,
+			Params:        params,
+			Inputs:        inputs,
+			Outputs:       outputs,
+			ProcessingMs:  processingTime.Milliseconds(),
+			TotalMs:       time.Since(startTime).Milliseconds(),
+			WorkerVersion: version,
+			CompletedAt:   time.Now().UTC(),
+		})
+		completeJob(ctx, jobID, outputPath, format, size)
+		removeInput(inputPath)
+	}
+
 	// 2. Декодування та обробка
 	func() {
-		reader, err := os.Open(inputPath)
-		if err != nil {
-			processErr = fmt.Errorf("file not found at %s: %v", inputPath, err)
+		// Завдання могло потрапити в чергу до того, як дію вимкнули через ENABLED_ACTIONS
+		if err := processing.Enabled(action); err != nil {
+			processErr = err
 			return
 		}
-		defer reader.Close()
 
-		img, _, err := image.Decode(reader)
+		params, outOpts, err := processing.SplitOutputOptions(params)
 		if err != nil {
-			processErr = fmt.Errorf("error decoding image: %v", err)
+			processErr = fmt.Errorf("invalid output options: %v", err)
 			return
 		}
+		if a, ok := processing.Lookup(action); ok && a.OutputFormat != "" {
+			outOpts.Format = a.OutputFormat
+		}
+		if outOpts.PreserveMetadata {
+			outOpts.Metadata = readInputMetadata(inputPath)
+		}
+		if outOpts.KeepICC {
+			outOpts.ICCProfile = readInputICC(inputPath)
+		}
 
-		processedImg, err := processImage(img, action, params)
-		if err != nil {
-			processErr = fmt.Errorf("error during image processing (%s with params '%s'): %v", action, params, err)
+		var (
+			outputPath string
+			outputSize image.Point
+		)
+		if processing.IsFrames(action) {
+			// Дія над анімацією: декодуються всі кадри, а не лише перший
+			frames, err := decodeAnimationFrames(inputPath, action, params)
+			if err != nil {
+				processErr = err
+				return
+			}
+
+			var resultImg image.Image
+			err = timedAction(func() (err error) {
+				resultImg, err = processing.ProcessFrames(frames, action, params)
+				return err
+			})
+			if err != nil {
+				processErr = fmt.Errorf("error during image processing (%s with params '%s'): %v", action, params, err)
+				return
+			}
+
+			outOpts = outOpts.ForImage(resultImg)
+			outputPath, outputSize = storage.OutputFilePath(jobID, action, "", outOpts.Extension()), resultImg.Bounds().Size()
+
+			if err := saveImage(resultImg, outputPath, outOpts); err != nil {
+				processErr = fmt.Errorf("error saving processed image: %v", err)
+				return
+			}
+			savedOutputs = append(savedOutputs, outputPath)
+
+			log.Printf("Image successfully processed and saved to: %s (%dx%d)", outputPath, outputSize.X, outputSize.Y)
+			finishJob(outputPath, outOpts.Format, outputSize)
+			return
+		}
+
+		if processing.IsCombine(action) {
+			// Дія з кількома входами: inputPath - каталог з файлами у порядку їх імен
+			imgs, err := decodeImageDir(inputPath, action)
+			if err != nil {
+				processErr = err
+				return
+			}
+
+			var combinedImg image.Image
+			err = timedAction(func() (err error) {
+				combinedImg, err = processing.ProcessCombined(imgs, action, params)
+				return err
+			})
+			if err != nil {
+				processErr = fmt.Errorf("error during image processing (%s with params '%s'): %v", action, params, err)
+				return
+			}
+
+			outOpts = outOpts.ForImage(combinedImg)
+			outputPath, outputSize = storage.OutputFilePath(jobID, action, "", outOpts.Extension()), combinedImg.Bounds().Size()
+
+			if err := saveImage(combinedImg, outputPath, outOpts); err != nil {
+				processErr = fmt.Errorf("error saving processed image: %v", err)
+				return
+			}
+			savedOutputs = append(savedOutputs, outputPath)
+
+			log.Printf("Image successfully processed and saved to: %s (%dx%d)", outputPath, outputSize.X, outputSize.Y)
+			finishJob(outputPath, outOpts.Format, outputSize)
 			return
 		}
 
-		// 3. Зберігаємо змінений файл
-		outputFilename := fmt.Sprintf("%s_%s_%s.jpg", jobID, action, time.Now().Format("150405"))
-		outputPath := filepath.Join(storagePath, outputFilename)
+		// Анімований GIF для дії над одним кадром: помилка або перший кадр з попередженням
+		if outOpts.Page <= 1 {
+			warning, err := checkAnimatedInput(inputPath, action)
+			if err != nil {
+				processErr = err
+				return
+			}
+			if warning != "" {
+				log.Printf("Warning: job %s: %s", jobID, warning)
+				setJobWarning(ctx, jobID, warning)
+			}
+		}
 
-		if err := saveImageToJPEG(processedImg, outputPath); err != nil {
-			processErr = fmt.Errorf("error saving processed image: %v", err)
+		img, err := decodeImageFile(inputPath, action, outOpts.Page)
+		if err != nil {
+			processErr = err
 			return
 		}
 
-		log.Printf("Image successfully processed and saved to: %s", outputPath)
+		if processing.IsMultiOutput(action) {
+			// Дія з кількома результатами: кожна область зберігається окремим файлом. Області
+			// попередньої, перерваної спроби (повторна доставка після зупинки Worker) видаляються.
+			discardJobOutputs(ctx, jobID, nil)
+
+			var regions []processing.NamedImage
+			err = timedAction(func() (err error) {
+				regions, err = processing.ProcessMulti(img, action, params)
+				return err
+			})
+			if err != nil {
+				processErr = fmt.Errorf("error during image processing (%s): %v", action, err)
+				return
+			}
 
-		// 4. Встановлення статусу COMPLETED у PostgreSQL
-		updatePGStatus(jobID, statusCompleted, outputPath)
+			primaryFormat := ""
+			for _, region := range regions {
+				// З format=smart формат обирається для кожної області окремо
+				regionOpts := outOpts.ForImage(region.Image)
+				regionPath := storage.OutputFilePath(jobID, action, region.Name, regionOpts.Extension())
+
+				if err := saveImage(region.Image, regionPath, regionOpts); err != nil {
+					processErr = fmt.Errorf("error saving region '%s': %v", region.Name, err)
+					return
+				}
+				savedOutputs = append(savedOutputs, regionPath)
+				if err := saveJobOutput(ctx, jobID, region.Name, regionPath); err != nil {
+					processErr = err
+					return
+				}
+				log.Printf("Region '%s' saved to: %s", region.Name, regionPath)
+
+				// Основним результатом завдання вважається перша область
+				if outputPath == "" {
+					outputPath, primaryFormat, outputSize = regionPath, regionOpts.Format, region.Image.Bounds().Size()
+				}
+			}
+			outOpts.Format = primaryFormat
+		} else {
+			var processedImg image.Image
+			err = timedAction(func() (err error) {
+				processedImg, err = processing.Process(img, action, params)
+				return err
+			})
+			if err != nil {
+				processErr = fmt.Errorf("error during image processing (%s with params '%s'): %v", action, params, err)
+				return
+			}
 
-		// 5. Очищення: Видаляємо оригінальний файл
-		if err := os.Remove(inputPath); err != nil {
-			log.Printf("Warning: Failed to remove original input file %s: %v", inputPath, err)
+			// 3. Зберігаємо змінений файл
+			outOpts = outOpts.ForImage(processedImg)
+			outputPath, outputSize = storage.OutputFilePath(jobID, action, "", outOpts.Extension()), processedImg.Bounds().Size()
+
+			if err := saveImage(processedImg, outputPath, outOpts); err != nil {
+				processErr = fmt.Errorf("error saving processed image: %v", err)
+				return
+			}
+			savedOutputs = append(savedOutputs, outputPath)
 		}
+
+		log.Printf("Image successfully processed and saved to: %s (%dx%d)", outputPath, outputSize.X, outputSize.Y)
+
+		// 4. Маніфест, статус COMPLETED у PostgreSQL і видалення оригінального файлу
+		finishJob(outputPath, outOpts.Format, outputSize)
 	}()
 
-	// 6. Фіксація часу та статусу метрик
+	// 5. Фіксація часу та статусу метрик
 	duration := time.Since(startTime).Seconds()
 	jobDuration.Observe(duration)
 
 	if processErr != nil {
 		log.Printf("JOB FAILED %s: %v", jobID, processErr)
 		// Встановлення статусу FAILED у PostgreSQL
-		updatePGStatus(jobID, statusFailed, processErr.Error())
+		updatePGStatus(ctx, jobID, statusFailed, processErr.Error())
+		discardJobOutputs(ctx, jobID, savedOutputs)
 
 		// Інкрементування лічильника failed
-		jobsProcessed.WithLabelValues(action, "failed").Inc()
+		jobsProcessed.WithLabelValues(metrics.ActionLabel(action), metrics.OutcomeFailed).Inc()
 
-		// Спробуємо видалити оригінальний файл навіть після невдачі
-		if err := os.Remove(inputPath); err != nil {
-			log.Printf("Warning: Failed to remove original input file %s after failure: %v", inputPath, err)
-		}
+		// Вхідний файл зберігається до FAILED_INPUT_TTL, щоб завдання можна було повторити
+		keepFailedInput(ctx, jobID, inputPath)
+		notifyCallback(ctx, jobID, statusFailed)
 	} else {
 		// Інкрементування лічильника completed
-		jobsProcessed.WithLabelValues(action, "completed").Inc()
+		jobsProcessed.WithLabelValues(metrics.ActionLabel(action), metrics.OutcomeCompleted).Inc()
+		notifyCallback(ctx, jobID, statusCompleted)
 	}
 
 	log.Printf("--- FINISHED PROCESSING JOB: %s ---", jobID)
@@ -332,48 +871,214 @@ func processTask(taskMessage string) {
 
 // startMetricsServer запускає окремий сервер метрик
 func startMetricsServer() {
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle(metrics.Path, promhttp.Handler())
 	log.Printf("Starting metrics server on port %s", metricsPort)
 	log.Fatal(http.ListenAndServe(":"+metricsPort, nil))
 }
 
-// startWorker запускає основний цикл Worker
-func startWorker() {
-	log.Println("Worker started and listening for tasks...")
-
-	for {
-		// BLPop - ключовий елемент асинхронної взаємодії
-		result, err := rdb.BLPop(ctx, 0, "image_processing_queue").Result()
-
-		if err != nil {
-			if err != redis.Nil {
-				log.Printf("Error receiving task: %v. Retrying in 5 seconds.", err)
-				time.Sleep(5 * time.Second)
+// startWorker запускає основний цикл Worker; цикл завершується, коли ctx скасовано
+func startWorker(ctx context.Context) {
+	log.Printf("Worker started and listening for tasks on %s...", strings.Join(queue.Names, ", "))
+
+	var inFlight sync.WaitGroup
+
+	// Спершу - повідомлення, отримані цим Worker до перезапуску і не підтверджені
+	start := "0"
+	for ctx.Err() == nil {
+		// Повідомлення Worker, що зупинилися посеред обробки, обробляються тут же, у межах
+		// того самого бюджету, що й нові
+		messages := reclaimStaleTasks(ctx)
+
+		if len(messages) == 0 {
+			// XREADGROUP - ключовий елемент асинхронної взаємодії.
+			// Скінченний таймаут дозволяє регулярно перевіряти, чи не час зупинятися.
+			var err error
+			messages, err = readTasks(ctx, start)
+
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				if err != redis.Nil {
+					log.Printf("Error receiving task: %v. Retrying in 5 seconds.", err)
+					time.Sleep(5 * time.Second)
+				}
+				continue
+			}
+			if start == "0" {
+				if len(messages) > 0 {
+					log.Printf("Resuming %d unacknowledged task(s) from before the restart", len(messages))
+				}
+				start = ">"
 			}
-			continue
 		}
 
-		taskMessage := result[1]
-		// Передаємо завдання на обробку
-		processTask(taskMessage)
+		for _, msg := range messages {
+			if pixelBudget == nil {
+				// Передаємо завдання на обробку
+				handleMessage(ctx, msg)
+			} else if !runWithinBudget(ctx, &inFlight, msg) {
+				// Зупинка під час очікування бюджету: непідтверджені повідомлення лишаються
+				// в групі і будуть оброблені після перезапуску
+				break
+			}
+		}
 
 		time.Sleep(100 * time.Millisecond)
 	}
+
+	// Завдання, запущені в межах бюджету пікселів, завершуються до закриття з'єднань
+	inFlight.Wait()
+	log.Println("Worker stopped: shutdown requested.")
 }
 
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
+	// Необов'язковий перелік дій, дозволених на цьому екземплярі (через кому)
+	if v := os.Getenv("ENABLED_ACTIONS"); v != "" {
+		if err := processing.SetEnabled(strings.Split(v, ",")); err != nil {
+			log.Fatalf("Invalid ENABLED_ACTIONS value '%s': %v", v, err)
+		}
+		log.Printf("Enabled actions: %s", strings.Join(processing.Names(), ", "))
+	}
+
+	// Обмеження розміру входу та часу обробки для окремих дій
+	if v := os.Getenv("ACTION_LIMITS"); v != "" {
+		limits, err := processing.ParseActionLimits(v)
+		if err != nil {
+			log.Fatalf("Invalid ACTION_LIMITS value: %v", err)
+		}
+		actionLimits = limits
+	}
+
+	// Колір, яким заповнюються прозорі області при збереженні у JPEG (за замовчуванням білий)
+	if v := os.Getenv("JPEG_BACKGROUND"); v != "" {
+		if err := processing.SetDefaultBackground(v); err != nil {
+			log.Fatalf("Invalid JPEG_BACKGROUND value '%s': %v", v, err)
+		}
+	}
+
+	if v := os.Getenv("ANIMATED_INPUT_POLICY"); v != "" {
+		policy, err := processing.ParseAnimationPolicy(v)
+		if err != nil {
+			log.Fatalf("Invalid ANIMATED_INPUT_POLICY value: %v", err)
+		}
+		animatedInputPolicy = policy
+	}
+
+	// Типова якість JPEG і стиснення PNG, коли їх не задано в params
+	if v := os.Getenv("DEFAULT_JPEG_QUALITY"); v != "" {
+		if err := processing.SetDefaultJPEGQuality(v); err != nil {
+			log.Fatalf("Invalid DEFAULT_JPEG_QUALITY value '%s': %v", v, err)
+		}
+	}
+	if v := os.Getenv("DEFAULT_PNG_COMPRESSION"); v != "" {
+		if err := processing.SetDefaultPNGCompression(v); err != nil {
+			log.Fatalf("Invalid DEFAULT_PNG_COMPRESSION value '%s': %v", v, err)
+		}
+	}
+
+	// Поріг площі мініатюри, до якого resize використовує швидку інтерполяцію (0 - завжди Lanczos3)
+	if v := os.Getenv("FAST_RESIZE_MAX_PIXELS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			log.Fatalf("Invalid FAST_RESIZE_MAX_PIXELS value '%s': expected a non-negative integer", v)
+		}
+		processing.SetFastResizeThreshold(uint(n))
+	}
+
+	// Найбільша кількість результатів одного завдання (multicrop); 0 - без обмеження
+	if v := os.Getenv("MAX_OUTPUTS_PER_JOB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid MAX_OUTPUTS_PER_JOB value '%s': expected a non-negative integer", v)
+		}
+		processing.SetMaxOutputs(n)
+	}
+	processing.SetDebug(os.Getenv("LOG_LEVEL") == "debug")
+
+	if err := storage.Ensure(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Необов'язкова оптимізація збережених результатів зовнішньою утилітою
+	if v := os.Getenv("OUTPUT_OPTIMIZER"); v != "" {
+		opt, err := newOptimizer(v, os.Getenv("OPTIMIZER_COMMANDS"))
+		if err != nil {
+			log.Fatalf("Invalid OUTPUT_OPTIMIZER value '%s': %v", v, err)
+		}
+		optimizer = opt
+	}
+
+	// Необов'язковий бюджет пікселів: завдання обробляються паралельно, поки сума площ
+	// їхніх входів не перевищує PIXEL_BUDGET (наприклад, 100000000 - 100 мегапікселів)
+	if v := os.Getenv("PIXEL_BUDGET"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < minJobPixels {
+			log.Fatalf("Invalid PIXEL_BUDGET value '%s': expected an integer of at least %d pixels", v, minJobPixels)
+		}
+		setPixelBudget(n)
+		log.Printf("Pixel budget enabled: up to %d pixels in flight", n)
+	}
+
+	// Період пошуку завдань, записаних у БД, але не поставлених у чергу (0 - вимкнено)
+	if v := os.Getenv("OUTBOX_SWEEP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid OUTBOX_SWEEP_INTERVAL value '%s': expected a duration such as 30s", v)
+		}
+		outboxSweepInterval = d
+	}
+
+	// Термін зберігання вхідних файлів завдань FAILED для /admin/requeue (0 - видаляти одразу)
+	if v := os.Getenv("FAILED_INPUT_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid FAILED_INPUT_TTL value '%s': expected a duration such as 72h", v)
+		}
+		failedInputTTL = d
+	}
+
+	// Перехоплення непідтверджених повідомлень інших Worker (0 - вимкнено) і ліміт доставок
+	if v := os.Getenv("PENDING_RECLAIM_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid PENDING_RECLAIM_AFTER value '%s': expected a duration such as 15m", v)
+		}
+		reclaimIdle = d
+	}
+	if v := os.Getenv("PENDING_MAX_DELIVERIES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid PENDING_MAX_DELIVERIES value '%s': expected a positive integer", v)
+		}
+		maxDeliveries = n
+	}
+
+	// Кореневий контекст скасовується сигналом зупинки (SIGINT/SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 1. Спроба підключення до Redis (Черга)
-	connectToRedis()
+	connectToRedis(ctx)
+
+	if err := setupQueues(ctx); err != nil {
+		log.Fatalf("FATAL: Failed to set up the job queue: %v", err)
+	}
 
 	// 2. Спроба підключення до PostgreSQL (Стійке сховище)
-	connectToPostgres()
-	defer pgDB.Close(ctx) // Закриття PG підключення при виході
+	connectToPostgres(ctx)
+	defer pgPool.Close() // Закриття PG підключень при виході
+	if err := runMigrations(ctx); err != nil {
+		log.Fatalf("FATAL: Failed to apply database migrations: %v", err)
+	}
 
 	// 3. Запуск сервера метрик у фоновому режимі
 	go startMetricsServer()
+	go startOutboxSweeper(ctx)
+	go startFailedInputSweeper(ctx)
 
 	// 4. Запуск основного циклу Worker
-	startWorker()
+	startWorker(ctx)
 }
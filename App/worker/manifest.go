@@ -0,0 +1,14 @@
+package main
+
+import (
+	"log"
+
+	"image_common/manifest"
+)
+
+// writeManifest зберігає маніфест завдання. Помилка лише логується - результат уже збережено.
+func writeManifest(m manifest.Manifest) {
+	if err := manifest.Write(m); err != nil {
+		log.Printf("WARNING: Failed to write manifest for job %s: %v", m.JobID, err)
+	}
+}
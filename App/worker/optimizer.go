@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Optimizer - необов'язкова післяобробка збереженого результату (наприклад, стиснення без втрат
+// зовнішньою утилітою). Optimize змінює файл на місці; format - jpeg, png, webp або tiff.
+type Optimizer interface {
+	Optimize(path, format string) error
+}
+
+// noopOptimizer залишає файл без змін (за замовчуванням)
+type noopOptimizer struct{}
+
+func (noopOptimizer) Optimize(path, format string) error { return nil }
+
+// optimizerTimeout - найдовший час роботи зовнішнього оптимізатора для одного файлу
+const optimizerTimeout = 30 * time.Second
+
+// commandOptimizer запускає зовнішню команду для формату результату. Аргумент "{path}"
+// замінюється шляхом до файлу; формати без команди пропускаються.
+type commandOptimizer struct {
+	commands map[string][]string
+}
+
+func (o commandOptimizer) Optimize(path, format string) error {
+	command, ok := o.commands[format]
+	if !ok {
+		return nil
+	}
+
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = strings.ReplaceAll(arg, "{path}", path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), optimizerTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// optimizer вибирається змінною OUTPUT_OPTIMIZER у main
+var optimizer Optimizer = noopOptimizer{}
+
+// newOptimizer створює оптимізатор за назвою з OUTPUT_OPTIMIZER: "none" (або порожньо) чи "command".
+// Для "command" команди задаються JSON в OPTIMIZER_COMMANDS, наприклад
+// OPTIMIZER_COMMANDS='{"png":["oxipng","-o","2","{path}"],"jpeg":["jpegoptim","--strip-all","{path}"]}'
+func newOptimizer(name, commands string) (Optimizer, error) {
+	switch name {
+	case "", "none":
+		return noopOptimizer{}, nil
+	case "command":
+		var parsed map[string][]string
+		if err := json.Unmarshal([]byte(commands), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid OPTIMIZER_COMMANDS: expected JSON object of {\"format\": [\"cmd\", \"arg\", \"{path}\"]}: %v", err)
+		}
+		normalized := make(map[string][]string, len(parsed))
+		for format, command := range parsed {
+			if len(command) == 0 {
+				return nil, fmt.Errorf("invalid OPTIMIZER_COMMANDS: empty command for format '%s'", format)
+			}
+			format = strings.ToLower(format)
+			switch format {
+			case "jpg":
+				format = "jpeg"
+			case "tif":
+				format = "tiff"
+			}
+			normalized[format] = command
+		}
+		return commandOptimizer{commands: normalized}, nil
+	}
+	return nil, fmt.Errorf("unknown optimizer '%s' (expected none or command)", name)
+}
+
+// optimizeOutput запускає оптимізатор для збереженого результату. Оптимізатор працює з копією
+// файлу, яка замінює результат лише після успіху, тож обірвана утиліта не зіпсує його.
+// Помилка оптимізатора не є помилкою завдання: вона логується, а результат лишається неоптимізованим.
+func optimizeOutput(path, format string) {
+	if _, ok := optimizer.(noopOptimizer); ok {
+		return
+	}
+
+	// Копія зберігає розширення, за яким деякі утиліти визначають формат
+	tmpPath := filepath.Join(filepath.Dir(path), "opt-"+filepath.Base(path))
+	err := copyFile(path, tmpPath)
+	if err == nil {
+		err = optimizer.Optimize(tmpPath, format)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		log.Printf("WARNING: Optimizer failed for %s, keeping unoptimized output: %v", path, err)
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(out, in)
+	return errors.Join(copyErr, out.Close())
+}
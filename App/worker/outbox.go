@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"image_common/queue"
+)
+
+// outboxSweepInterval - як часто Worker шукає завдання, записані в БД, але не поставлені в чергу
+// (OUTBOX_SWEEP_INTERVAL); 0 вимикає пошук
+var outboxSweepInterval = 30 * time.Second
+
+// outboxGrace - вік запису, після якого він вважається забутим: API ставить завдання в чергу
+// одразу після INSERT, тож молодші записи ще можуть бути в процесі
+const outboxGrace = time.Minute
+
+// outboxBatchSize обмежує кількість завдань, які ставляться в чергу за один прохід
+const outboxBatchSize = 100
+
+// startOutboxSweeper періодично ставить у чергу завдання з enqueued = FALSE, поки ctx не скасовано
+func startOutboxSweeper(ctx context.Context) {
+	if outboxSweepInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(outboxSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := sweepOutbox(ctx)
+		if err != nil {
+			log.Printf("ERROR: Outbox sweep failed after enqueuing %d job(s): %v", n, err)
+		} else if n > 0 {
+			log.Printf("Outbox sweep: enqueued %d job(s) that were never pushed to the queue", n)
+		}
+	}
+}
+
+// sweepOutbox в одній транзакції ставить у чергу до outboxBatchSize забутих завдань і позначає їх
+// enqueued. FOR UPDATE SKIP LOCKED не дає кільком Worker поставити те саме завдання двічі.
+// Якщо транзакція не завершилася після XADD, завдання буде поставлене повторно - повторне
+// повідомлення для завершеного завдання Worker пропускає.
+func sweepOutbox(ctx context.Context) (int, error) {
+	tx, err := pgDB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, input_path, action, COALESCE(params, '') FROM jobs
+		WHERE NOT enqueued AND status = 'QUEUED' AND created_at < NOW() - make_interval(secs => $1)
+		ORDER BY created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, outboxGrace.Seconds(), outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var tasks []queue.Task
+	for rows.Next() {
+		var t queue.Task
+		if err := rows.Scan(&t.JobID, &t.InputPath, &t.Action, &t.Params); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var enqueued []string
+	for _, t := range tasks {
+		jobData, err := queue.NewTask(t.JobID, t.InputPath, t.Action, t.Params).Encode()
+		if err == nil {
+			err = addTask(ctx, queue.Name, jobData)
+		}
+		if err != nil {
+			// Поставлені до помилки завдання все одно позначаються нижче
+			log.Printf("ERROR: Failed to enqueue outbox job %s: %v", t.JobID, err)
+			break
+		}
+		enqueued = append(enqueued, t.JobID)
+	}
+	if len(enqueued) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE jobs SET enqueued = TRUE WHERE id = ANY($1::uuid[])`, enqueued); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(enqueued), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"image_common/metrics"
+	"image_common/queue"
+)
+
+// reclaimIdle - скільки повідомлення має пробути непідтвердженим в іншого Worker, щоб вважатися
+// покинутим (PENDING_RECLAIM_AFTER); 0 вимикає перехоплення. Має бути більшим за найдовшу обробку
+// завдання: повідомлення Worker, який ще працює над завданням, теж виглядає непідтвердженим.
+var reclaimIdle = 15 * time.Minute
+
+// maxDeliveries - найбільша кількість доставок повідомлення (PENDING_MAX_DELIVERIES). Повідомлення,
+// на якому Worker зупинялися стільки разів, вважається отруйним: завдання позначається FAILED,
+// а не перехоплюється знову, щоб один вхідний файл не зупиняв Worker по колу.
+var maxDeliveries int64 = 3
+
+// reclaimCheckInterval - як часто Worker перевіряє списки очікування груп
+const reclaimCheckInterval = 30 * time.Second
+
+// reclaimBatchSize - скільки найстаріших непідтверджених повідомлень черги перевіряється за раз
+const reclaimBatchSize = 100
+
+// Значення мітки outcome метрики tasksReclaimed
+const (
+	reclaimRetried   = "retried"   // повідомлення забране для повторної обробки
+	reclaimAbandoned = "abandoned" // ліміт доставок вичерпано, завдання позначене FAILED
+)
+
+// lastReclaimCheck - час останньої перевірки (використовується лише з циклу startWorker)
+var lastReclaimCheck time.Time
+
+// reclaimStaleTasks раз на reclaimCheckInterval забирає (XCLAIM) повідомлення, які інші Worker
+// отримали, але не підтвердили довше за reclaimIdle, і повертає їх для обробки. Повідомлення,
+// доставлені вже maxDeliveries разів, не повертаються: їхні завдання позначаються FAILED.
+func reclaimStaleTasks(ctx context.Context) []queueMessage {
+	if reclaimIdle <= 0 || time.Since(lastReclaimCheck) < reclaimCheckInterval {
+		return nil
+	}
+	lastReclaimCheck = time.Now()
+
+	var claimed []queueMessage
+	for _, stream := range queue.Names {
+		pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream, Group: queue.Group, Start: "-", End: "+", Count: reclaimBatchSize,
+		}).Result()
+		if err != nil {
+			log.Printf("Error reading pending messages of %s: %v", stream, err)
+			continue
+		}
+
+		for _, p := range pending {
+			// Власні непідтверджені повідомлення - завдання, які цей Worker зараз обробляє
+			if p.Consumer == consumerName || p.Idle < reclaimIdle {
+				continue
+			}
+			// MinIdle захищає від подвійного перехоплення: якщо інший Worker уже забрав
+			// повідомлення, його час очікування скинуто і XCLAIM нічого не поверне
+			messages, err := rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream: stream, Group: queue.Group, Consumer: consumerName, MinIdle: reclaimIdle, Messages: []string{p.ID},
+			}).Result()
+			if err != nil {
+				log.Printf("Error claiming message %s of %s: %v", p.ID, stream, err)
+				continue
+			}
+			for _, m := range messages {
+				task, _ := m.Values[queue.TaskField].(string)
+				msg := queueMessage{Stream: stream, ID: m.ID, Task: task}
+				// XCLAIM уже збільшив лічильник доставок
+				if p.RetryCount+1 > maxDeliveries {
+					abandonTask(ctx, msg, p.Consumer, p.RetryCount)
+					continue
+				}
+				log.Printf("Reclaimed message %s of %s from '%s' after %s unacknowledged (delivery %d of %d)",
+					m.ID, stream, p.Consumer, p.Idle.Round(time.Second), p.RetryCount+1, maxDeliveries)
+				tasksReclaimed.WithLabelValues(reclaimRetried).Inc()
+				claimed = append(claimed, msg)
+			}
+		}
+	}
+	return claimed
+}
+
+// abandonTask завершує отруйне повідомлення: завдання позначається FAILED (якщо воно ще не
+// завершене), а повідомлення підтверджується
+func abandonTask(ctx context.Context, msg queueMessage, consumer string, deliveries int64) {
+	log.Printf("Giving up on message %s of %s: delivered %d times, last to '%s' without acknowledgement",
+		msg.ID, msg.Stream, deliveries, consumer)
+	tasksReclaimed.WithLabelValues(reclaimAbandoned).Inc()
+
+	if task, err := queue.ParseTask(msg.Task); err == nil && !jobFinished(ctx, task.JobID) {
+		updatePGStatus(ctx, task.JobID, statusFailed,
+			fmt.Sprintf("abandoned after %d deliveries: the worker stopped while processing this job each time", deliveries))
+		jobsProcessed.WithLabelValues(metrics.ActionLabel(task.Action), metrics.OutcomeFailed).Inc()
+		keepFailedInput(ctx, task.JobID, task.InputPath)
+		notifyCallback(ctx, task.JobID, statusFailed)
+	}
+	ackTask(msg)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"image_common/queue"
+)
+
+// queueMessage - повідомлення завдання, отримане з stream черги
+type queueMessage struct {
+	Stream string
+	ID     string
+	Task   string
+}
+
+// consumerName - ім'я Worker у групі споживачів (QUEUE_CONSUMER, за замовчуванням ім'я хоста).
+// Непідтверджені повідомлення закріплені за іменем, тож Worker, перезапущений з тим самим
+// іменем, обробляє їх знову.
+var consumerName = os.Getenv("QUEUE_CONSUMER")
+
+// setupQueues готує stream і групу споживачів для кожної черги. Черга, яка ще є списком Redis
+// від попередньої версії, спершу переноситься в stream.
+func setupQueues(ctx context.Context) error {
+	if consumerName == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("QUEUE_CONSUMER is not set and the hostname is unavailable: %v", err)
+		}
+		consumerName = host
+	}
+
+	for _, name := range queue.Names {
+		if err := migrateListQueue(ctx, name); err != nil {
+			return err
+		}
+		// "0": група отримає й повідомлення, додані до її створення
+		err := rdb.XGroupCreateMkStream(ctx, name, queue.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group %s on %s: %v", queue.Group, name, err)
+		}
+	}
+	log.Printf("Consuming %s as '%s' in group '%s'", strings.Join(queue.Names, ", "), consumerName, queue.Group)
+	return nil
+}
+
+// migrateListQueue переносить повідомлення зі списку Redis (черга BLPop до переходу на Streams)
+// у stream з тією ж назвою: список перейменовується і вичитується в stream по одному повідомленню
+func migrateListQueue(ctx context.Context, name string) error {
+	keyType, err := rdb.Type(ctx, name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to inspect queue %s: %v", name, err)
+	}
+	legacy := name + ":list"
+	if keyType == "list" {
+		if err := rdb.Rename(ctx, name, legacy).Err(); err != nil {
+			return fmt.Errorf("failed to move list queue %s aside: %v", name, err)
+		}
+	} else if n, err := rdb.Exists(ctx, legacy).Result(); err != nil || n == 0 {
+		// Немає ні списку, ні незавершеного перенесення
+		return err
+	}
+
+	moved := 0
+	for {
+		task, err := rdb.LPop(ctx, legacy).Result()
+		if err == redis.Nil {
+			break
+		}
+		if err == nil {
+			err = addTask(ctx, name, task)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move queued tasks from list %s to stream %s (moved %d): %v", legacy, name, moved, err)
+		}
+		moved++
+	}
+	log.Printf("Moved %d queued task(s) from list queue %s to stream", moved, name)
+	return nil
+}
+
+// addTask додає повідомлення завдання в stream черги
+func addTask(ctx context.Context, stream, task string) error {
+	return rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{queue.TaskField: task}}).Err()
+}
+
+// readTasks читає повідомлення групи для цього Worker. start ">" - нові повідомлення (з очікуванням
+// до queuePollTimeout, по одному з кожної черги), "0" - усі отримані раніше, але не підтверджені.
+// Повідомлення повертаються в порядку пріоритету черг.
+func readTasks(ctx context.Context, start string) ([]queueMessage, error) {
+	streams := make([]string, 0, 2*len(queue.Names))
+	streams = append(streams, queue.Names...)
+	for range queue.Names {
+		streams = append(streams, start)
+	}
+	args := &redis.XReadGroupArgs{Group: queue.Group, Consumer: consumerName, Streams: streams, Block: -1}
+	if start == ">" {
+		args.Count, args.Block = 1, queuePollTimeout
+	}
+
+	result, err := rdb.XReadGroup(ctx, args).Result()
+	if err != nil {
+		return nil, err
+	}
+	var messages []queueMessage
+	for _, stream := range result {
+		for _, msg := range stream.Messages {
+			task, _ := msg.Values[queue.TaskField].(string)
+			messages = append(messages, queueMessage{Stream: stream.Stream, ID: msg.ID, Task: task})
+		}
+	}
+	return messages, nil
+}
+
+// ackTask підтверджує обробку повідомлення і видаляє його з stream, щоб довжина stream
+// відповідала кількості завдань, що чекають або обробляються (за нею API обмежує чергу).
+// Контекст Worker не використовується: підтвердження потрібне і під час зупинки.
+func ackTask(msg queueMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rdb.XAck(ctx, msg.Stream, queue.Group, msg.ID).Err(); err != nil {
+		log.Printf("ERROR: Failed to acknowledge message %s in %s: %v", msg.ID, msg.Stream, err)
+		return
+	}
+	if err := rdb.XDel(ctx, msg.Stream, msg.ID).Err(); err != nil {
+		log.Printf("Warning: Failed to delete acknowledged message %s from %s: %v", msg.ID, msg.Stream, err)
+	}
+}
+
+// handleMessage обробляє повідомлення і підтверджує його. Повідомлення без поля завдання
+// підтверджується одразу: обробити його неможливо, а без підтвердження воно лишалося б в очікуванні.
+func handleMessage(ctx context.Context, msg queueMessage) {
+	if msg.Task == "" {
+		log.Printf("Error: message %s in %s has no '%s' field; dropping it", msg.ID, msg.Stream, queue.TaskField)
+		ackTask(msg)
+		return
+	}
+	processTask(ctx, msg.Task)
+	// Зупинка під час обробки могла перервати запис статусу в БД: повідомлення лишається
+	// непідтвердженим і обробляється знову після перезапуску (завершені завдання пропускаються)
+	if ctx.Err() != nil {
+		return
+	}
+	ackTask(msg)
+}
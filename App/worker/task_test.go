@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"image_common/manifest"
+	"image_common/queue"
+	"image_common/storage"
+)
+
+const multiCropParams = `[{"name":"left","x":0,"y":0,"w":4,"h":4},{"name":"right","x":4,"y":0,"w":4,"h":4}]`
+
+// useFakeStores підставляє fakeDB і тимчасові каталоги сховища; повертає fakeDB
+func useFakeStores(t *testing.T) *fakeDB {
+	t.Helper()
+	db := newFakeDB()
+	oldDB, oldInput, oldOutput := pgDB, storage.InputPath, storage.OutputPath
+	pgDB, storage.InputPath, storage.OutputPath = db, t.TempDir(), t.TempDir()
+	t.Cleanup(func() { pgDB, storage.InputPath, storage.OutputPath = oldDB, oldInput, oldOutput })
+	return db
+}
+
+// writeInput зберігає вхідне PNG 8x4 і повертає повідомлення завдання для нього
+func writeInput(t *testing.T, jobID, action, params string) string {
+	t.Helper()
+	inputPath := filepath.Join(storage.InputPath, jobID+".png")
+	file, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	message, err := queue.NewTask(jobID, inputPath, action, params).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// outputFiles повертає відсортовані шляхи файлів у каталозі результатів, окрім маніфесту
+func outputFiles(t *testing.T, jobID string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(storage.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if path := filepath.Join(storage.OutputPath, entry.Name()); path != manifest.Path(jobID) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func sortedPaths(outputs map[string]string) []string {
+	var paths []string
+	for _, path := range outputs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestProcessTaskMultiCropTwice(t *testing.T) {
+	db := useFakeStores(t)
+	const jobID = "multicrop-twice"
+	db.addJob(jobID)
+	ctx := context.Background()
+
+	processTask(ctx, writeInput(t, jobID, "multicrop", multiCropParams))
+	if status := db.job(jobID)["status"]; status != statusCompleted {
+		t.Fatalf("first run: status = %v, want %s (error: %v)", status, statusCompleted, db.job(jobID)["error_message"])
+	}
+	first := db.jobOutputs(jobID)
+
+	// Повторна доставка того самого повідомлення, наприклад після reclaim завислого завдання
+	db.job(jobID)["status"] = statusInProgress
+	processTask(ctx, writeInput(t, jobID, "multicrop", multiCropParams))
+	if status := db.job(jobID)["status"]; status != statusCompleted {
+		t.Fatalf("second run: status = %v, want %s (error: %v)", status, statusCompleted, db.job(jobID)["error_message"])
+	}
+
+	second := db.jobOutputs(jobID)
+	if len(second) != 2 || second["left"] == "" || second["right"] == "" {
+		t.Fatalf("job_outputs = %v, want rows for left and right", second)
+	}
+	if second["left"] == first["left"] {
+		t.Fatalf("job_outputs still point to the first run's file %s", first["left"])
+	}
+	// Файли першої спроби видалено: залишаються лише ті, на які посилається job_outputs
+	if got, want := outputFiles(t, jobID), sortedPaths(second); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("output files = %v, want %v", got, want)
+	}
+}
+
+func TestProcessTaskMultiCropFailureDiscardsOutputs(t *testing.T) {
+	db := useFakeStores(t)
+	const jobID = "multicrop-failed"
+	db.addJob(jobID)
+	db.failInsert = 2 // друга область зберігається на диск, але не записується в job_outputs
+
+	processTask(context.Background(), writeInput(t, jobID, "multicrop", multiCropParams))
+	if status := db.job(jobID)["status"]; status != statusFailed {
+		t.Fatalf("status = %v, want %s", status, statusFailed)
+	}
+	if outputs := db.jobOutputs(jobID); len(outputs) != 0 {
+		t.Fatalf("job_outputs = %v, want none after failure", outputs)
+	}
+	if files := outputFiles(t, jobID); len(files) != 0 {
+		t.Fatalf("output files = %v, want none after failure", files)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"image_common/metrics"
+)
+
+// Дані збірки Worker; задаються при збірці:
+// go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.buildTime=2024-01-01T00:00:00Z"
+// version також потрапляє в маніфести завдань (worker_version).
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// registerBuildInfo реєструє метрику build_info з даними збірки у мітках
+func registerBuildInfo() {
+	info := metrics.NewBuildInfo(version, commit, buildTime)
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "worker_build_info",
+		Help:      "Build information of the running worker; the value is always 1.",
+	}, metrics.BuildInfoLabels)
+	buildInfo.WithLabelValues(info.LabelValues()...).Set(1)
+	prometheus.MustRegister(buildInfo)
+}